@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log/slog"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"linkit/internal/config"
 	"linkit/internal/db"
+	"linkit/internal/server"
+	"linkit/internal/storage"
+	"linkit/internal/task"
 )
 
 // handleCLI 用于处理仅在 CLI 模式下运行的命令。
@@ -27,6 +35,16 @@ func handleCLI(cfg config.Config, logger *slog.Logger, args []string) (bool, err
 			return false, err
 		}
 		return false, nil
+	case "gc":
+		if err := runUploadGC(cfg, logger); err != nil {
+			return false, err
+		}
+		return false, nil
+	case "storage":
+		if err := runStorageCommand(cfg, logger, args[1:]); err != nil {
+			return false, err
+		}
+		return false, nil
 	default:
 		return false, fmt.Errorf("未知命令")
 	}
@@ -84,3 +102,140 @@ func resetAdminPassword(cfg config.Config, logger *slog.Logger, newPassword stri
 	logger.Info("管理员密码重置成功", "user", adminUser.Username)
 	return nil
 }
+
+// runStorageCommand 处理 linkit storage <子命令>。
+func runStorageCommand(cfg config.Config, logger *slog.Logger, args []string) error {
+	if len(args) > 0 && args[0] == "repair" {
+		return runStorageRepair(cfg, logger)
+	}
+	if len(args) > 0 && args[0] == "tier" {
+		return runStorageTier(cfg, logger)
+	}
+	if len(args) == 0 || args[0] != "migrate" {
+		return fmt.Errorf("使用 linkit storage migrate --from <driver> --to <driver> 迁移存储，linkit storage repair 修复存储镜像，或 linkit storage tier 迁移冷数据")
+	}
+	fs := flag.NewFlagSet("storage migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "源存储，如 local 或存储配置名")
+	to := fs.String("to", "", "目标存储，如 s3 或存储配置名")
+	dryRun := fs.Bool("dry-run", false, "仅列出待迁移对象，不实际复制")
+	deleteSource := fs.Bool("delete-source", false, "迁移并校验成功后删除源对象")
+	limit := fs.Int("limit", 0, "本次最多迁移的对象数量，0 表示不限制")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*from) == "" || strings.TrimSpace(*to) == "" {
+		return fmt.Errorf("缺少 --from 或 --to 参数")
+	}
+
+	store, reg, err := openStorageRegistry(&cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	opts := task.MigrateOptions{From: *from, To: *to, DryRun: *dryRun, DeleteSource: *deleteSource, Limit: *limit}
+	report, err := task.MigrateStorage(ctx, store, reg, opts, logger, nil)
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println("迁移结果：\n" + string(b))
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d 个对象迁移失败，可重新执行命令继续迁移", report.Failed)
+	}
+	return nil
+}
+
+// runStorageRepair 立即执行一次存储镜像修复。
+func runStorageRepair(cfg config.Config, logger *slog.Logger) error {
+	store, reg, err := openStorageRegistry(&cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if len(reg.Mirrors()) == 0 {
+		return fmt.Errorf("未配置存储镜像 STORAGE_MIRRORS")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := task.RepairMirrors(ctx, store, reg, logger)
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println("修复结果：\n" + string(b))
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d 个对象修复失败", report.Failed)
+	}
+	return nil
+}
+
+// runStorageTier 立即执行一次冷数据分层，阈值与源、目标存储取自 TIERING_* 配置。
+func runStorageTier(cfg config.Config, logger *slog.Logger) error {
+	store, reg, err := openStorageRegistry(&cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := task.TierColdObjects(ctx, store, reg, cfg.AppConfig, logger)
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println("迁移结果：\n" + string(b))
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d 个对象迁移失败，可重新执行命令继续迁移", report.Failed)
+	}
+	return nil
+}
+
+// runUploadGC 立即清理一次过期的上传会话、直传对象、孤立分片与合并残留文件。
+func runUploadGC(cfg config.Config, logger *slog.Logger) error {
+	store, reg, err := openStorageRegistry(&cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := task.CleanUploads(ctx, &cfg, store, reg, logger)
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println("清理结果：\n" + string(b))
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d 个文件删除失败", len(report.Errors))
+	}
+	return nil
+}
+
+// openStorageRegistry 打开数据库、同步配置并初始化存储注册表，供存储相关命令复用。
+func openStorageRegistry(cfg *config.Config, logger *slog.Logger) (*db.DB, *storage.Registry, error) {
+	store, err := db.NewStore(*cfg, logger, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.Sync(context.Background(), store.AppConfig); err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	profiles, err := server.LoadStorageProfiles(context.Background(), store)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	reg, err := storage.SetupRegistry(*cfg, profiles, logger)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return store, reg, nil
+}
@@ -51,19 +51,30 @@ func main() {
 	b, _ = json.MarshalIndent(cfg.AppConfig, "", "  ")
 	fmt.Println("当前项目 APP 配置：\n" + string(b))
 
-	storageReg, err := storage.SetupRegistry(cfg, logger)
+	profiles, err := server.LoadStorageProfiles(context.Background(), store)
+	if err != nil {
+		logger.Error("读取存储配置失败", "err", err)
+		os.Exit(1)
+	}
+	storageReg, err := storage.SetupRegistry(cfg, profiles, logger)
 	if err != nil {
 		logger.Error("初始化存储失败", "err", err)
 		os.Exit(1)
 	}
 
-	Init(cfg, storageReg)
-	sessions := session.NewManager()
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
 	defer cleanupCancel()
+	Init(cleanupCtx, &cfg, store, storageReg)
+	migrator := task.NewStorageMigrator(store, storageReg)
+	tusUploads := server.NewTusUploads()
+	sessions := session.NewManager()
 	sessions.StartCleanup(cleanupCtx, 24*time.Hour)
+	finalizer := server.NewFinalizeQueue(store, &cfg, storageReg)
+	finalizer.Start(cleanupCtx, cfg.FinalizeWorkers)
 
 	r := gin.New()
+	// multipart 中超过该大小的部分写入临时文件，上传不会整体占用内存
+	r.MaxMultipartMemory = 8 << 20
 	corsManager := middleware.NewCORSManager(&cfg, "")
 	r.Use(middleware.CORSMiddleware(corsManager))
 	r.Use(middleware.RequestLogger(logger))
@@ -76,15 +87,28 @@ func main() {
 	{
 		api.POST("/login", server.LoginHandler(store, cfg, sessions))
 		api.GET("/share/:code", server.ShareInfoHandler(store))
-		api.GET("/upload", server.UploadQueryHandler(&cfg))
-		api.POST("/upload", server.UploadHandler(store, &cfg, storageReg))
+		api.GET("/upload", server.UploadQueryHandler(store, &cfg, finalizer))
+		api.POST("/upload", server.UploadHandler(store, &cfg, storageReg, finalizer))
+		api.GET("/upload/:id/status", server.UploadStatusHandler(store, &cfg, finalizer))
+		api.PUT("/upload/:filename", server.RawUploadHandler(store, &cfg, storageReg))
+		api.POST("/upload/session", server.CreateUploadSessionHandler(store, &cfg))
+		api.POST("/upload/batch", server.BatchUploadHandler(store, &cfg, storageReg))
+		api.POST("/upload/presign", server.PresignUploadHandler(store, &cfg, storageReg))
+		api.POST("/upload/presign/complete", server.PresignCompleteHandler(store, storageReg))
+		api.OPTIONS("/tus", server.TusOptionsHandler(&cfg))
+		api.POST("/tus", server.TusCreateHandler(store, &cfg, storageReg))
+		api.HEAD("/tus/:id", server.TusHeadHandler(&cfg))
+		api.PATCH("/tus/:id", server.TusPatchHandler(store, &cfg, storageReg, tusUploads, finalizer))
+		api.DELETE("/tus/:id", server.TusDeleteHandler(store, &cfg, tusUploads))
 
 		apiAuth := api.Group("")
 		apiAuth.Use(middleware.AuthRequired(store, cfg))
-		apiAuth.GET("/me", server.MeHandler())
+		apiAuth.GET("/me", server.MeHandler(store))
 		apiAuth.POST("/refresh", server.RefreshHandler(store, cfg, sessions))
 		apiAuth.POST("/logout", server.LogoutHandler(store, cfg, sessions))
 
+		apiAuth.POST("/upload/url", server.UploadFromURLHandler(store, &cfg, storageReg))
+
 		apiAuth.GET("/gallery", server.GalleryHandler(store))
 		apiAuth.GET("/gallery/tags", server.GalleryTagsHandler(store))
 		apiAuth.GET("/gallery/pick", server.GalleryPickHandler(store, storageReg))
@@ -98,6 +122,13 @@ func main() {
 		apiAdmin.GET("/config", server.AdminGetConfigHandler(store, &cfg))
 		apiAdmin.POST("/config", server.AdminUpsertConfigHandler(store, &cfg, storageReg, buildConfigReloader(storageReg, corsManager)))
 		apiAdmin.POST("/password", server.AdminChangePasswordHandler(store, cfg, sessions))
+		apiAdmin.GET("/users", server.AdminUsersHandler(store))
+		apiAdmin.POST("/users/:id/quota", server.AdminUpdateUserQuotaHandler(store))
+		apiAdmin.GET("/storage/profiles", server.AdminStorageProfilesHandler(store, storageReg))
+		apiAdmin.POST("/storage/profiles", server.AdminUpsertStorageProfileHandler(store, &cfg, storageReg))
+		apiAdmin.DELETE("/storage/profiles/:name", server.AdminDeleteStorageProfileHandler(store, &cfg, storageReg))
+		apiAdmin.GET("/storage/migrate", server.AdminStorageMigrateStatusHandler(migrator))
+		apiAdmin.POST("/storage/migrate", server.AdminStorageMigrateHandler(migrator))
 	}
 
 	// 静态资源
@@ -136,15 +167,21 @@ func main() {
 	logger.Info("服务器已退出")
 }
 
-func Init(cfg config.Config, storageReg *storage.Registry) {
+func Init(ctx context.Context, cfg *config.Config, store *db.DB, storageReg *storage.Registry) {
 	// 启动 S3 备份任务
-	task.StartS3DBBackup(cfg, storageReg)
+	task.StartS3DBBackup(*cfg, storageReg)
+	// 启动存储镜像修复任务
+	task.StartMirrorRepair(ctx, cfg, store, storageReg)
+	// 启动冷数据分层任务
+	task.StartTiering(ctx, cfg, store, storageReg)
+	// 启动上传临时文件清理任务
+	task.StartUploadJanitor(ctx, cfg, store, storageReg)
 }
 
 func buildConfigReloader(reg *storage.Registry, corsManager *middleware.CORSManager) func(*config.Config) error {
 	return func(cfg *config.Config) error {
 		if reg != nil {
-			if err := reg.Reload(*cfg); err != nil {
+			if err := reg.Reload(cfg.Clone()); err != nil {
 				return err
 			}
 		}
@@ -13,39 +13,77 @@ import (
 
 type AppConfig struct {
 	StorageDriver string `config:"STORAGE_DRIVER"`
+	// 对象 key 模板，如 {user}/{yyyy}/{mm}/{hash}{ext}，为空时使用默认布局
+	StorageKeyTemplate string `config:"STORAGE_KEY_TEMPLATE"`
+	// 上传路由规则（JSON 数组），按顺序匹配决定写入的存储
+	StorageRoutingRules string `config:"STORAGE_ROUTING_RULES"`
+	// 静态加密：密钥列表（id:base64key，逗号分隔，第一把用于写入）与需要加密的存储名
+	StorageEncryptKeys    string `config:"STORAGE_ENCRYPT_KEYS"`
+	StorageEncryptTargets string `config:"STORAGE_ENCRYPT_TARGETS"`
+	// 存储镜像（逗号分隔的 主存储:副存储）与修复任务间隔（小时，0 表示不自动修复）
+	StorageMirrors           string `config:"STORAGE_MIRRORS"`
+	StorageMirrorRepairHours int    `config:"STORAGE_MIRROR_REPAIR_HOURS"`
+	// 冷数据分层：超过 TieringColdDays 天未被下载的文件从 TieringSource 迁移到 TieringTarget
+	TieringEnable   bool   `config:"TIERING_ENABLE"`
+	TieringColdDays int    `config:"TIERING_COLD_DAYS"`
+	TieringSource   string `config:"TIERING_SOURCE"`
+	TieringTarget   string `config:"TIERING_TARGET"`
 	// s3 config
 	S3Bucket    string `config:"S3_BUCKET"`
 	S3AccessKey string `config:"S3_ACCESS_KEY"`
 	S3SecretKey string `config:"S3_SECRET_KEY"`
 	S3Endpoint  string `config:"S3_ENDPOINT"`
 	S3Region    string `config:"S3_REGION"`
+	// webdav config
+	WebDAVURL      string `config:"WEBDAV_URL"`
+	WebDAVUser     string `config:"WEBDAV_USER"`
+	WebDAVPassword string `config:"WEBDAV_PASSWORD"`
+	WebDAVBasePath string `config:"WEBDAV_BASE_PATH"`
+	// sftp config
+	SFTPHost       string `config:"SFTP_HOST"`
+	SFTPPort       int    `config:"SFTP_PORT"`
+	SFTPUser       string `config:"SFTP_USER"`
+	SFTPPassword   string `config:"SFTP_PASSWORD"`
+	SFTPPrivateKey string `config:"SFTP_PRIVATE_KEY"`
+	SFTPHostKey    string `config:"SFTP_HOST_KEY"`
+	SFTPRootDir    string `config:"SFTP_ROOT_DIR"`
+	// 未配置 SFTP_HOST_KEY 时必须显式开启才会跳过主机公钥校验
+	SFTPInsecureSkipHostKey bool `config:"SFTP_INSECURE_SKIP_HOST_KEY"`
 	// 访客上传白名单配置
 	GuestUploadEnable       bool   `config:"GUEST_UPLOAD_ENABLE"`
 	GuestUploadExtWhitelist string `config:"GUEST_UPLOAD_EXT_WHITELIST"`
 	GuestUploadMaxMbSize    int    `config:"GUEST_UPLOAD_MAX_MB_SIZE"`
+	// 链接上传：开关、单个文件大小上限（MB）、下载超时（秒），以及是否允许访问内网地址
+	URLUploadEnable         bool   `config:"URL_UPLOAD_ENABLE"`
+	URLUploadMaxMbSize      int    `config:"URL_UPLOAD_MAX_MB_SIZE"`
+	URLUploadTimeoutSeconds int    `config:"URL_UPLOAD_TIMEOUT_SECONDS"`
+	URLUploadAllowPrivate   bool   `config:"URL_UPLOAD_ALLOW_PRIVATE"`
 	CorsAllowedList         string `config:"CORS_ALLOWED_LIST"`
 }
 
 type Config struct {
-	Port           int
-	FrontendOrigin string
-	DatabasePath   string
-	LocalRoot      string
-	SessionCookie  string
-	CookieMaxAge   time.Duration
-	CookieSecure   bool
-	ChunkDir       string
-	MergeDir       string
-	MaxFileSize    int64
-	ChunkThreshold int64
-	CleanLimit     int64
-	CleanExpire    time.Duration
-	AdminUserId    int64
-	AdminUsername  string
-	AdminPassword  string
-	AdminEmail     string
-	LogLevel       string
-	AppConfig      AppConfig
+	Port             int
+	FrontendOrigin   string
+	DatabasePath     string
+	LocalRoot        string
+	SessionCookie    string
+	CookieMaxAge     time.Duration
+	CookieSecure     bool
+	ChunkDir         string
+	MergeDir         string
+	MaxFileSize      int64
+	ChunkThreshold   int64
+	CleanExpire      time.Duration
+	CleanInterval    time.Duration
+	UploadSessionTTL time.Duration
+	// FinalizeWorkers 后台合并分片并入库的并发数
+	FinalizeWorkers int
+	AdminUserId     int64
+	AdminUsername   string
+	AdminPassword   string
+	AdminEmail      string
+	LogLevel        string
+	AppConfig       AppConfig
 }
 
 type AppConfigDao interface {
@@ -55,6 +93,8 @@ type AppConfigDao interface {
 var (
 	appConfigKeyOnce  sync.Once
 	appConfigKeyIndex map[string][]int
+	// appConfigMu 保护管理后台热更新 AppConfig 与后台任务读取之间的并发访问
+	appConfigMu sync.RWMutex
 )
 
 func getAppConfigKeyIndex() map[string][]int {
@@ -93,13 +133,16 @@ func Load() Config {
 		ChunkDir:       getEnv("CHUNK_DIR", "./data/temp/chunk"),
 		MergeDir:       getEnv("MERGE_DIR", "./data/temp/merged"),
 
-		SessionCookie:  "session_user_id",
-		CookieMaxAge:   time.Hour * 24 * 30,
-		CookieSecure:   getEnv("COOKIE_SECURE", "false") == "true",
-		MaxFileSize:    1 << 30,                // 1GB
-		ChunkThreshold: 100 * 1024 * 1024,      // 100MB
-		CleanLimit:     2 * 1024 * 1024 * 1024, // 2GB
-		CleanExpire:    30 * time.Minute,
+		SessionCookie:    "session_user_id",
+		CookieMaxAge:     time.Hour * 24 * 30,
+		CookieSecure:     getEnv("COOKIE_SECURE", "false") == "true",
+		MaxFileSize:      1 << 30,           // 1GB
+		ChunkThreshold:   100 * 1024 * 1024, // 100MB
+		CleanExpire:      30 * time.Minute,
+		CleanInterval:    10 * time.Minute,
+		UploadSessionTTL: 24 * time.Hour,
+
+		FinalizeWorkers: getInt("UPLOAD_FINALIZE_WORKERS", 2),
 
 		AdminUserId:   1,
 		AdminUsername: getEnv("ADMIN_USERNAME", "admin"),
@@ -124,6 +167,8 @@ func (cfg *Config) SetAppConfigValue(key, value string) bool {
 	if !ok {
 		return false
 	}
+	appConfigMu.Lock()
+	defer appConfigMu.Unlock()
 	v := reflect.ValueOf(&cfg.AppConfig).Elem()
 	f := v.FieldByIndex(index)
 	if !f.IsValid() || !f.CanSet() {
@@ -168,6 +213,20 @@ func (cfg *Config) SetAppConfigValue(key, value string) bool {
 	}
 }
 
+// GetAppConfig 在读锁下返回 AppConfig 的副本，供与热更新并发运行的后台任务读取最新配置。
+func (cfg *Config) GetAppConfig() AppConfig {
+	appConfigMu.RLock()
+	defer appConfigMu.RUnlock()
+	return cfg.AppConfig
+}
+
+// Clone 在读锁下复制整个配置，用于在请求或热更新中基于当前配置构造新配置。
+func (cfg *Config) Clone() Config {
+	appConfigMu.RLock()
+	defer appConfigMu.RUnlock()
+	return *cfg
+}
+
 // GetAppConfigValue 获取 AppConfig 白名单配置的当前值（用于展示/回显）。
 func (cfg *Config) GetAppConfigValue(key string) (string, bool) {
 	key = strings.ToUpper(strings.TrimSpace(key))
@@ -175,7 +234,7 @@ func (cfg *Config) GetAppConfigValue(key string) (string, bool) {
 	if !ok {
 		return "", false
 	}
-	v := reflect.ValueOf(cfg.AppConfig)
+	v := reflect.ValueOf(cfg.GetAppConfig())
 	f := v.FieldByIndex(index)
 	if !f.IsValid() {
 		return "", false
@@ -199,17 +258,46 @@ func (cfg *Config) GetAppConfigValue(key string) (string, bool) {
 // Sync 用于在 Load() 之后同步 AppConfig。
 // 优先级：数据库 > env > 硬编码。
 func (cfg *Config) Sync(ctx context.Context, dao AppConfigDao) error {
-	cfg.AppConfig = AppConfig{
-		StorageDriver:           getEnv("STORAGE_DRIVER", "local"),
-		S3Bucket:                os.Getenv("S3_BUCKET"),
-		S3AccessKey:             os.Getenv("S3_ACCESS_KEY"),
-		S3SecretKey:             os.Getenv("S3_SECRET_KEY"),
-		S3Endpoint:              os.Getenv("S3_ENDPOINT"),
-		S3Region:                getEnv("S3_REGION", "auto"),
-		GuestUploadEnable:       getBool("GUEST_UPLOAD_ENABLE", false),
-		GuestUploadExtWhitelist: getEnv("GUEST_UPLOAD_EXT_WHITELIST", "jpg,jpeg,png,gif"),
-		GuestUploadMaxMbSize:    getInt("GUEST_UPLOAD_MAX_MB_SIZE", 5),
+	appCfg := AppConfig{
+		StorageDriver:            getEnv("STORAGE_DRIVER", "local"),
+		StorageKeyTemplate:       os.Getenv("STORAGE_KEY_TEMPLATE"),
+		StorageRoutingRules:      os.Getenv("STORAGE_ROUTING_RULES"),
+		StorageEncryptKeys:       os.Getenv("STORAGE_ENCRYPT_KEYS"),
+		StorageEncryptTargets:    os.Getenv("STORAGE_ENCRYPT_TARGETS"),
+		StorageMirrors:           os.Getenv("STORAGE_MIRRORS"),
+		StorageMirrorRepairHours: getInt("STORAGE_MIRROR_REPAIR_HOURS", 24),
+		TieringEnable:            getBool("TIERING_ENABLE", false),
+		TieringColdDays:          getInt("TIERING_COLD_DAYS", 30),
+		TieringSource:            getEnv("TIERING_SOURCE", "local"),
+		TieringTarget:            getEnv("TIERING_TARGET", "s3"),
+		S3Bucket:                 os.Getenv("S3_BUCKET"),
+		S3AccessKey:              os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:              os.Getenv("S3_SECRET_KEY"),
+		S3Endpoint:               os.Getenv("S3_ENDPOINT"),
+		S3Region:                 getEnv("S3_REGION", "auto"),
+		WebDAVURL:                os.Getenv("WEBDAV_URL"),
+		WebDAVUser:               os.Getenv("WEBDAV_USER"),
+		WebDAVPassword:           os.Getenv("WEBDAV_PASSWORD"),
+		WebDAVBasePath:           os.Getenv("WEBDAV_BASE_PATH"),
+		SFTPHost:                 os.Getenv("SFTP_HOST"),
+		SFTPPort:                 getInt("SFTP_PORT", 22),
+		SFTPUser:                 os.Getenv("SFTP_USER"),
+		SFTPPassword:             os.Getenv("SFTP_PASSWORD"),
+		SFTPPrivateKey:           os.Getenv("SFTP_PRIVATE_KEY"),
+		SFTPHostKey:              os.Getenv("SFTP_HOST_KEY"),
+		SFTPRootDir:              os.Getenv("SFTP_ROOT_DIR"),
+		SFTPInsecureSkipHostKey:  getBool("SFTP_INSECURE_SKIP_HOST_KEY", false),
+		GuestUploadEnable:        getBool("GUEST_UPLOAD_ENABLE", false),
+		GuestUploadExtWhitelist:  getEnv("GUEST_UPLOAD_EXT_WHITELIST", "jpg,jpeg,png,gif"),
+		GuestUploadMaxMbSize:     getInt("GUEST_UPLOAD_MAX_MB_SIZE", 5),
+		URLUploadEnable:          getBool("URL_UPLOAD_ENABLE", true),
+		URLUploadMaxMbSize:       getInt("URL_UPLOAD_MAX_MB_SIZE", 100),
+		URLUploadTimeoutSeconds:  getInt("URL_UPLOAD_TIMEOUT_SECONDS", 60),
+		URLUploadAllowPrivate:    getBool("URL_UPLOAD_ALLOW_PRIVATE", false),
 	}
+	appConfigMu.Lock()
+	cfg.AppConfig = appCfg
+	appConfigMu.Unlock()
 	if dao == nil {
 		return nil
 	}
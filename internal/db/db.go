@@ -34,6 +34,9 @@ type DB struct {
 	User      *UserDao
 	Resource  *ResourceDao
 	Share     *ShareDao
+	Storage   *StorageProfileDao
+	Upload    *UploadSessionDao
+	Direct    *DirectUploadDao
 }
 
 func NewStore(cfg config.Config, logger *slog.Logger, init bool) (*DB, error) {
@@ -51,6 +54,9 @@ func NewStore(cfg config.Config, logger *slog.Logger, init bool) (*DB, error) {
 	store.User = &UserDao{store: store}
 	store.AppConfig = &AppConfigDao{store: store}
 	store.Share = &ShareDao{store: store}
+	store.Storage = &StorageProfileDao{store: store}
+	store.Upload = &UploadSessionDao{store: store}
+	store.Direct = &DirectUploadDao{store: store}
 	if init {
 		if err := store.upgradeSchema(context.Background()); err != nil {
 			return nil, err
@@ -96,6 +102,9 @@ func (s *DB) upgradeSchema(ctx context.Context) error {
 		&model.Resource{},
 		&model.ResourceTag{},
 		&model.Share{},
+		&model.StorageProfile{},
+		&model.UploadSession{},
+		&model.DirectUpload{},
 	)
 }
 
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"linkit/internal/db/model"
+)
+
+const (
+	DirectUploadStatusPending    = "pending"
+	DirectUploadStatusFinalizing = "finalizing"
+)
+
+type DirectUploadDao struct {
+	store *DB
+}
+
+func (dao *DirectUploadDao) Create(ctx context.Context, item *model.DirectUpload) error {
+	return dao.store.Client.WithContext(ctx).Create(item).Error
+}
+
+// Get 按 ID 读取直传任务，不存在时返回 nil。
+func (dao *DirectUploadDao) Get(ctx context.Context, id string) (*model.DirectUpload, error) {
+	var item model.DirectUpload
+	err := dao.store.Client.WithContext(ctx).Where("id = ?", id).First(&item).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Claim 将未过期的任务从 pending 置为 finalizing，并把过期时间顺延到 lease 作为处理租约，
+// 返回是否抢占成功；同一任务只有一个请求能成功。
+func (dao *DirectUploadDao) Claim(ctx context.Context, id string, lease time.Time) (bool, error) {
+	result := dao.store.Client.WithContext(ctx).Model(&model.DirectUpload{}).
+		Where("id = ? AND status = ? AND julianday(expires_at) > julianday(?)", id, DirectUploadStatusPending, time.Now()).
+		Updates(map[string]any{"status": DirectUploadStatusFinalizing, "expires_at": lease})
+	return result.RowsAffected == 1, result.Error
+}
+
+// Release 放弃处理中的任务，客户端可在租约内重新确认。
+func (dao *DirectUploadDao) Release(ctx context.Context, id string) error {
+	return dao.store.Client.WithContext(ctx).Model(&model.DirectUpload{}).
+		Where("id = ?", id).
+		Update("status", DirectUploadStatusPending).Error
+}
+
+func (dao *DirectUploadDao) Delete(ctx context.Context, id string) error {
+	return dao.store.Client.WithContext(ctx).Where("id = ?", id).Delete(&model.DirectUpload{}).Error
+}
+
+// ListExpired 列出在 before 之前过期的直传任务，包括租约已过期的处理中任务。
+func (dao *DirectUploadDao) ListExpired(ctx context.Context, before time.Time) ([]model.DirectUpload, error) {
+	var items []model.DirectUpload
+	err := dao.store.Client.WithContext(ctx).
+		Where("julianday(expires_at) < julianday(?)", before).
+		Find(&items).Error
+	return items, err
+}
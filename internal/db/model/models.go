@@ -3,25 +3,30 @@ package model
 import "time"
 
 type User struct {
-	ID        int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	Username  string    `gorm:"column:username;type:text;not null;uniqueIndex" json:"username"`
-	Password  string    `gorm:"column:password;type:text;not null" json:"-"`
-	Email     string    `gorm:"column:email;type:text;not null;uniqueIndex" json:"email"`
-	Nickname  string    `gorm:"column:nickname;type:text;not null" json:"nickname"`
-	Token     *string   `gorm:"column:token;type:text" json:"token"`
-	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	ID       int64   `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Username string  `gorm:"column:username;type:text;not null;uniqueIndex" json:"username"`
+	Password string  `gorm:"column:password;type:text;not null" json:"-"`
+	Email    string  `gorm:"column:email;type:text;not null;uniqueIndex" json:"email"`
+	Nickname string  `gorm:"column:nickname;type:text;not null" json:"nickname"`
+	Token    *string `gorm:"column:token;type:text" json:"token"`
+	// 存储配额，0 表示不限制
+	QuotaBytes int64     `gorm:"column:quota_bytes;not null;default:0" json:"quotaBytes"`
+	QuotaFiles int64     `gorm:"column:quota_files;not null;default:0" json:"quotaFiles"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
 
 type Resource struct {
 	ID        int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
 	Filename  string    `gorm:"column:filename;type:text;not null" json:"filename"`
-	Hash      string    `gorm:"column:hash;type:text;not null" json:"hash"`
+	Hash      string    `gorm:"column:hash;type:text;not null;index" json:"hash"`
 	Type      string    `gorm:"column:type;type:text;not null" json:"type"`
-	Path      string    `gorm:"column:path;type:text;not null" json:"path"`
+	Path      string    `gorm:"column:path;type:text;not null;index" json:"path"`
 	FileSize  int64     `gorm:"column:file_size;not null;default:0" json:"fileSize"`
 	UserID    int64     `gorm:"column:user_id;not null;index" json:"user_id"`
 	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	// LastAccessAt 最近一次被下载的时间，为空表示上传后从未被访问
+	LastAccessAt *time.Time `gorm:"column:last_access_at" json:"lastAccessAt"`
 }
 
 type AppConfig struct {
@@ -30,6 +35,60 @@ type AppConfig struct {
 	Value *string `gorm:"column:value;type:text" json:"value"`
 }
 
+// StorageProfile 命名存储配置，Options 为 AppConfig 配置键到值的 JSON 对象。
+type StorageProfile struct {
+	ID        int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Name      string    `gorm:"column:name;type:text;not null;uniqueIndex" json:"name"`
+	Driver    string    `gorm:"column:driver;type:text;not null" json:"driver"`
+	Options   string    `gorm:"column:options;type:text;not null;default:'{}'" json:"options"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// UploadSession 分片上传会话，ID 由服务端生成，分片保存在 ChunkDir/<ID> 下。
+type UploadSession struct {
+	ID          string `gorm:"column:id;type:text;primaryKey" json:"uploadId"`
+	UserID      int64  `gorm:"column:user_id;not null;index" json:"-"`
+	Filename    string `gorm:"column:filename;type:text;not null" json:"filename"`
+	FileSize    int64  `gorm:"column:file_size;not null" json:"fileSize"`
+	ChunkSize   int64  `gorm:"column:chunk_size;not null" json:"chunkSize"`
+	TotalChunks int64  `gorm:"column:total_chunks;not null" json:"totalChunks"`
+	// Tags 逗号分隔的标签
+	Tags     string `gorm:"column:tags;type:text;not null;default:''" json:"-"`
+	PickIt   bool   `gorm:"column:pick_it;not null;default:false" json:"-"`
+	FileHash string `gorm:"column:file_hash;type:text;not null;default:''" json:"-"`
+	// Status 为 uploading / finalizing / done / failed，合并入库前通过条件更新抢占，保证只执行一次
+	Status     string `gorm:"column:status;type:text;not null;default:'uploading'" json:"status"`
+	ResourceID int64  `gorm:"column:resource_id;not null;default:0" json:"resourceId,omitempty"`
+	ShareCode  string `gorm:"column:share_code;type:text;not null;default:''" json:"shareCode,omitempty"`
+	Error      string `gorm:"column:error;type:text;not null;default:''" json:"error,omitempty"`
+	// Attempts 后台合并因存储等临时故障失败的次数，达到上限后标记为失败
+	Attempts  int       `gorm:"column:attempts;not null;default:0" json:"-"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+// DirectUpload 已签发、待客户端确认的直传任务，过期未确认的对象由上传清理任务删除。
+type DirectUpload struct {
+	ID          string `gorm:"column:id;type:text;primaryKey" json:"uploadId"`
+	UserID      int64  `gorm:"column:user_id;not null;index" json:"-"`
+	StorageName string `gorm:"column:storage_name;type:text;not null" json:"storageName"`
+	ObjectKey   string `gorm:"column:object_key;type:text;not null" json:"objectKey"`
+	Filename    string `gorm:"column:filename;type:text;not null" json:"filename"`
+	ContentType string `gorm:"column:content_type;type:text;not null;default:''" json:"contentType"`
+	// Hash 客户端声明的 MD5，为空表示确认时再计算
+	Hash     string `gorm:"column:hash;type:text;not null;default:''" json:"hash"`
+	FileSize int64  `gorm:"column:file_size;not null" json:"fileSize"`
+	// Tags 逗号分隔的标签
+	Tags        string `gorm:"column:tags;type:text;not null;default:''" json:"-"`
+	PickIt      bool   `gorm:"column:pick_it;not null;default:false" json:"-"`
+	MultipartID string `gorm:"column:multipart_id;type:text;not null;default:''" json:"-"`
+	// Status 为 pending / finalizing，确认前通过条件更新抢占，处理中的任务以 ExpiresAt 作为租约
+	Status    string    `gorm:"column:status;type:text;not null;default:'pending'" json:"status"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
 type ResourceTag struct {
 	ID         int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
 	ResourceID int64     `gorm:"column:resource_id;not null;uniqueIndex:idx_resource_tag_resource_id_tag,priority:1;index:idx_resource_tag_tag" json:"resource_id"`
@@ -87,6 +146,15 @@ type ShareResource struct {
 	ExpireTime *time.Time `json:"-"`
 }
 
+// StorageObject 表示一个被一个或多个资源引用的存储对象。
+type StorageObject struct {
+	Path     string `gorm:"column:path" json:"path"`
+	Hash     string `gorm:"column:hash" json:"hash"`
+	Type     string `gorm:"column:type" json:"type"`
+	FileSize int64  `gorm:"column:file_size" json:"fileSize"`
+	Refs     int64  `gorm:"column:refs" json:"refs"`
+}
+
 func (User) TableName() string {
 	return "user"
 }
@@ -99,6 +167,18 @@ func (AppConfig) TableName() string {
 	return "app_config"
 }
 
+func (StorageProfile) TableName() string {
+	return "storage_profile"
+}
+
+func (UploadSession) TableName() string {
+	return "upload_session"
+}
+
+func (DirectUpload) TableName() string {
+	return "direct_upload"
+}
+
 func (ResourceTag) TableName() string {
 	return "resource_tag"
 }
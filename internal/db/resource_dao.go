@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"gorm.io/gorm"
@@ -75,12 +77,56 @@ type ResourceDao struct {
 	store  *DB
 	pickMu sync.RWMutex
 	picks  map[int64]int64
+
+	lockMu sync.Mutex
+	locks  map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
 }
 
 func NewResourceDao(store *DB) *ResourceDao {
 	return &ResourceDao{
 		store: store,
 		picks: make(map[int64]int64),
+		locks: make(map[string]*keyLock),
+	}
+}
+
+// LockHash 按内容 hash 加锁并返回解锁函数。存储对象按 hash 去重共享，
+// “查找可复用对象 → 写入资源记录”与“删除最后一个引用 → 删除存储对象”、
+// 迁移对象等操作须持有同一把锁，避免新资源引用到正被删除或搬走的对象。
+// 服务以单实例运行（SQLite），进程内加锁即可保证互斥。
+func (r *ResourceDao) LockHash(hash string) func() {
+	return r.lockKey("hash:" + hash)
+}
+
+// LockUser 按用户加锁并返回解锁函数。配额校验与资源入库须持有同一把锁，
+// 避免同一用户的并发上传同时通过校验后超出配额。
+func (r *ResourceDao) LockUser(userID int64) func() {
+	return r.lockKey("user:" + strconv.FormatInt(userID, 10))
+}
+
+func (r *ResourceDao) lockKey(key string) func() {
+	r.lockMu.Lock()
+	l, ok := r.locks[key]
+	if !ok {
+		l = &keyLock{}
+		r.locks[key] = l
+	}
+	l.refs++
+	r.lockMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		r.lockMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(r.locks, key)
+		}
+		r.lockMu.Unlock()
 	}
 }
 
@@ -240,6 +286,22 @@ func (r *ResourceDao) GetDashboardStats(ctx context.Context) (int64, int64, int6
 	return totalFiles, fileSizeResult.Total, viewResult.Total, nil
 }
 
+// GetUsageByUser 统计用户已上传的文件数量与总大小，用于配额校验。
+func (r *ResourceDao) GetUsageByUser(ctx context.Context, userID int64) (int64, int64, error) {
+	var result struct {
+		Files int64 `gorm:"column:files"`
+		Bytes int64 `gorm:"column:bytes"`
+	}
+	if err := r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Scan(&result).Error; err != nil {
+		return 0, 0, err
+	}
+	return result.Files, result.Bytes, nil
+}
+
 func (r *ResourceDao) FindByIDAndUser(ctx context.Context, resourceID, userID int64) (*model.Resource, error) {
 	var res model.Resource
 	err := r.store.Client.WithContext(ctx).Where("id = ? AND user_id = ?", resourceID, userID).First(&res).Error
@@ -268,9 +330,106 @@ func (r *ResourceDao) FindLatestByUser(ctx context.Context, userID int64) (*mode
 	return &res, nil
 }
 
-func (r *ResourceDao) DeleteWithShare(ctx context.Context, resourceID, userID int64) (bool, error) {
-	var deleted bool
+// ListPathsByHash 返回内容相同（hash 与大小一致）的已有资源引用的存储路径，最近使用的在前，
+// 用于复用其存储对象。
+func (r *ResourceDao) ListPathsByHash(ctx context.Context, hash string, fileSize int64) ([]string, error) {
+	var paths []string
+	err := r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Where("hash = ? AND file_size = ?", hash, fileSize).
+		Group("path").
+		Order("MAX(id) DESC").
+		Pluck("path", &paths).Error
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// ListStorageObjects 按存储路径聚合资源，返回每个存储对象及其引用数量。
+func (r *ResourceDao) ListStorageObjects(ctx context.Context) ([]model.StorageObject, error) {
+	var objects []model.StorageObject
+	err := r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Select("path, MIN(hash) AS hash, MIN(type) AS type, MAX(file_size) AS file_size, COUNT(*) AS refs").
+		Group("path").
+		Order("MIN(id) ASC").
+		Scan(&objects).Error
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// ListColdStorageObjects 返回最近访问时间（未访问过则取上传时间）早于 before 的存储对象。
+// 同一对象被多个资源引用时，以其中最近的一次访问为准。
+func (r *ResourceDao) ListColdStorageObjects(ctx context.Context, before time.Time) ([]model.StorageObject, error) {
+	var objects []model.StorageObject
+	err := r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Select("path, MIN(hash) AS hash, MIN(type) AS type, MAX(file_size) AS file_size, COUNT(*) AS refs").
+		Group("path").
+		Having("MAX(julianday(COALESCE(last_access_at, created_at))) < julianday(?)", before).
+		Order("MIN(id) ASC").
+		Scan(&objects).Error
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// TouchAccess 记录存储对象被访问，引用同一对象的资源一并更新。
+func (r *ResourceDao) TouchAccess(ctx context.Context, path string) error {
+	return r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Where("path = ?", path).
+		UpdateColumn("last_access_at", time.Now()).Error
+}
+
+// UpdatePath 将引用 oldPath 的资源统一改写为 newPath，返回受影响的资源数。
+func (r *ResourceDao) UpdatePath(ctx context.Context, oldPath, newPath string) (int64, error) {
+	result := r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Where("path = ?", oldPath).
+		Update("path", newPath)
+	return result.RowsAffected, result.Error
+}
+
+// CountByPath 统计引用存储对象 path 的资源数量。
+func (r *ResourceDao) CountByPath(ctx context.Context, path string) (int64, error) {
+	var count int64
+	err := r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Where("path = ?", path).
+		Count(&count).Error
+	return count, err
+}
+
+// CountByPathPrefix 统计存储路径以 prefix 开头的资源数量。
+func (r *ResourceDao) CountByPathPrefix(ctx context.Context, prefix string) (int64, error) {
+	var count int64
+	err := r.store.Client.WithContext(ctx).
+		Model(&model.Resource{}).
+		Where("substr(path, 1, ?) = ?", len(prefix), prefix).
+		Count(&count).Error
+	return count, err
+}
+
+// DeleteWithShare 删除资源及其分享/标签。
+// 第二个返回值表示该资源是否为其存储对象的最后一个引用，调用方据此决定是否删除存储文件。
+func (r *ResourceDao) DeleteWithShare(ctx context.Context, resourceID, userID int64) (bool, bool, error) {
+	var (
+		deleted bool
+		lastRef bool
+	)
 	err := r.store.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var res model.Resource
+		if err := tx.Where("id = ? AND user_id = ?", resourceID, userID).First(&res).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
 		if err := tx.Where("resource_id = ?", resourceID).Delete(&model.Share{}).Error; err != nil {
 			return err
 		}
@@ -282,12 +441,17 @@ func (r *ResourceDao) DeleteWithShare(ctx context.Context, resourceID, userID in
 			return result.Error
 		}
 		deleted = result.RowsAffected > 0
+		var remain int64
+		if err := tx.Model(&model.Resource{}).Where("path = ?", res.Path).Count(&remain).Error; err != nil {
+			return err
+		}
+		lastRef = deleted && remain == 0
 		return nil
 	})
 	if err != nil {
-		return false, err
+		return false, false, err
 	}
-	return deleted, nil
+	return deleted, lastRef, nil
 }
 
 func (r *ResourceDao) GetUserPickResourceID(ctx context.Context, userID int64) (int64, bool, error) {
@@ -381,9 +545,13 @@ func collectResourceIDs(resources []model.Resource) []int64 {
 	return ids
 }
 
+// storageFromPath 从存储路径前缀（如 local@/、s3:bucket@/、s3+archive:bucket@/）中提取驱动名称。
 func storageFromPath(path string) string {
-	if strings.HasPrefix(path, "local@/") {
+	prefix, _, _ := strings.Cut(path, "@/")
+	platform, _, _ := strings.Cut(prefix, ":")
+	platform, _, _ = strings.Cut(platform, "+")
+	if platform == "" {
 		return "local"
 	}
-	return "s3"
+	return strings.ToLower(platform)
 }
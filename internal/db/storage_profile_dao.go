@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"linkit/internal/db/model"
+)
+
+type StorageProfileDao struct {
+	store *DB
+}
+
+// List 按创建顺序返回全部命名存储配置。
+func (dao *StorageProfileDao) List(ctx context.Context) ([]model.StorageProfile, error) {
+	var items []model.StorageProfile
+	if err := dao.store.Client.WithContext(ctx).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (dao *StorageProfileDao) FindByName(ctx context.Context, name string) (*model.StorageProfile, error) {
+	var item model.StorageProfile
+	err := dao.store.Client.WithContext(ctx).Where("name = ?", name).First(&item).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Upsert 按名称新增或更新存储配置。
+func (dao *StorageProfileDao) Upsert(ctx context.Context, name, driver, options string) error {
+	return dao.store.Client.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"driver", "options", "updated_at"}),
+	}).Create(&model.StorageProfile{
+		Name:    name,
+		Driver:  driver,
+		Options: options,
+	}).Error
+}
+
+func (dao *StorageProfileDao) Delete(ctx context.Context, name string) (bool, error) {
+	result := dao.store.Client.WithContext(ctx).Where("name = ?", name).Delete(&model.StorageProfile{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"linkit/internal/db/model"
+)
+
+const (
+	UploadStatusUploading  = "uploading"
+	UploadStatusFinalizing = "finalizing"
+	UploadStatusDone       = "done"
+	UploadStatusFailed     = "failed"
+)
+
+type UploadSessionDao struct {
+	store *DB
+}
+
+func (dao *UploadSessionDao) Create(ctx context.Context, session *model.UploadSession) error {
+	return dao.store.Client.WithContext(ctx).Create(session).Error
+}
+
+// Get 按 ID 读取上传会话，不存在时返回 nil。
+func (dao *UploadSessionDao) Get(ctx context.Context, id string) (*model.UploadSession, error) {
+	var session model.UploadSession
+	err := dao.store.Client.WithContext(ctx).Where("id = ?", id).First(&session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (dao *UploadSessionDao) Delete(ctx context.Context, id string) error {
+	return dao.store.Client.WithContext(ctx).Where("id = ?", id).Delete(&model.UploadSession{}).Error
+}
+
+// ListByStatus 列出处于指定状态的上传会话。
+func (dao *UploadSessionDao) ListByStatus(ctx context.Context, status string) ([]model.UploadSession, error) {
+	var sessions []model.UploadSession
+	err := dao.store.Client.WithContext(ctx).Where("status = ?", status).Find(&sessions).Error
+	return sessions, err
+}
+
+// ListExpired 列出在 before 之前过期且不在合并中的上传会话。
+func (dao *UploadSessionDao) ListExpired(ctx context.Context, before time.Time) ([]model.UploadSession, error) {
+	var sessions []model.UploadSession
+	err := dao.store.Client.WithContext(ctx).
+		Where("julianday(expires_at) < julianday(?) AND status <> ?", before, UploadStatusFinalizing).
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// ClaimFinalize 将会话从 uploading 置为 finalizing 并记录完整文件校验值，返回是否抢占成功；
+// 同一会话只有一个请求能成功。
+func (dao *UploadSessionDao) ClaimFinalize(ctx context.Context, id, fileHash string) (bool, error) {
+	result := dao.store.Client.WithContext(ctx).Model(&model.UploadSession{}).
+		Where("id = ? AND status = ?", id, UploadStatusUploading).
+		Updates(map[string]any{"status": UploadStatusFinalizing, "file_hash": fileHash})
+	return result.RowsAffected == 1, result.Error
+}
+
+// Complete 记录合并入库的结果，之后重复的完成请求直接返回该结果。
+func (dao *UploadSessionDao) Complete(ctx context.Context, id string, resourceID int64, shareCode string) error {
+	return dao.store.Client.WithContext(ctx).Model(&model.UploadSession{}).Where("id = ?", id).Updates(map[string]any{
+		"status":      UploadStatusDone,
+		"resource_id": resourceID,
+		"share_code":  shareCode,
+	}).Error
+}
+
+// RecordAttempt 记录一次因临时故障失败的合并，会话保持 finalizing 等待重新排队。
+func (dao *UploadSessionDao) RecordAttempt(ctx context.Context, id, msg string) error {
+	return dao.store.Client.WithContext(ctx).Model(&model.UploadSession{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts": gorm.Expr("attempts + 1"),
+		"error":    msg,
+	}).Error
+}
+
+func (dao *UploadSessionDao) MarkFailed(ctx context.Context, id, msg string) error {
+	return dao.store.Client.WithContext(ctx).Model(&model.UploadSession{}).Where("id = ?", id).Updates(map[string]any{
+		"status": UploadStatusFailed,
+		"error":  msg,
+	}).Error
+}
@@ -55,6 +55,24 @@ func (u *UserDao) UpdateToken(ctx context.Context, userID int64, token *string)
 	}).Error
 }
 
+// List 返回全部用户，按 ID 排序。
+func (u *UserDao) List(ctx context.Context) ([]model.User, error) {
+	var users []model.User
+	if err := u.store.Client.WithContext(ctx).Order("id ASC").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpdateQuota 更新用户存储配额，返回用户是否存在。
+func (u *UserDao) UpdateQuota(ctx context.Context, userID, quotaBytes, quotaFiles int64) (bool, error) {
+	result := u.store.Client.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"quota_bytes": quotaBytes,
+		"quota_files": quotaFiles,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
 func (u *UserDao) UpdatePassword(ctx context.Context, userID int64, newHash string) error {
 	return u.store.Client.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Updates(map[string]any{
 		"password": newHash,
@@ -14,6 +14,11 @@ import (
 
 var builtinWildcardDomains = []string{"xiaosm.cn", "waizx.com"}
 
+const (
+	uploadRequestHeaders  = "Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Defer-Length, Linkit-Tags, Linkit-Pick-It, Linkit-File-Hash"
+	uploadResponseHeaders = "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Linkit-Share-Code, Linkit-Resource-Id"
+)
+
 type CORSManager struct {
 	mu      sync.RWMutex
 	origins []string
@@ -92,9 +97,11 @@ func CORSMiddleware(manager *CORSManager) gin.HandlerFunc {
 			c.Header("Access-Control-Allow-Origin", origin)
 		}
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		if c.Request.Method == http.MethodOptions {
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, "+uploadRequestHeaders)
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, HEAD, DELETE, OPTIONS")
+		c.Header("Access-Control-Expose-Headers", uploadResponseHeaders)
+		// tus 客户端会发送非预检的 OPTIONS 查询服务端能力，交给对应路由处理
+		if c.Request.Method == http.MethodOptions && (c.GetHeader("Access-Control-Request-Method") != "" || c.FullPath() == "") {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"linkit/internal/db/model"
 	"linkit/internal/session"
 	"linkit/internal/storage"
+	"linkit/internal/task"
 )
 
 type adminConfigItem struct {
@@ -96,7 +98,7 @@ func AdminUpsertConfigHandler(store *db.DB, cfg *config.Config, reg *storage.Reg
 			return
 		}
 
-		nextCfg := *cfg
+		nextCfg := cfg.Clone()
 		for key, value := range updates {
 			if ok := nextCfg.SetAppConfigValue(key, value); !ok {
 				c.JSON(http.StatusBadRequest, Fail[any]("配置值格式错误", 400))
@@ -147,6 +149,40 @@ func AdminDashboardStatsHandler(store *db.DB) gin.HandlerFunc {
 	}
 }
 
+type adminStorageMigrateRequest struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	DryRun       bool   `json:"dryRun"`
+	DeleteSource bool   `json:"deleteSource"`
+	Limit        int    `json:"limit"`
+}
+
+func AdminStorageMigrateHandler(migrator *task.StorageMigrator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req adminStorageMigrateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("参数错误", 400))
+			return
+		}
+		opts := task.MigrateOptions{From: req.From, To: req.To, DryRun: req.DryRun, DeleteSource: req.DeleteSource, Limit: req.Limit}
+		if err := migrator.Start(opts); err != nil {
+			if errors.Is(err, task.ErrMigrationRunning) {
+				c.JSON(http.StatusConflict, Fail[any](err.Error(), 409))
+				return
+			}
+			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
+			return
+		}
+		c.JSON(http.StatusOK, Ok(migrator.Status(), "迁移任务已启动"))
+	}
+}
+
+func AdminStorageMigrateStatusHandler(migrator *task.StorageMigrator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, Ok(migrator.Status(), "ok"))
+	}
+}
+
 type adminChangePasswordRequest struct {
 	OldPassword  string `json:"oldPassword"`
 	NewPassword1 string `json:"newPassword"`
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminUpsertConfigRejectsInvalidKeyTemplate(t *testing.T) {
+	store, cfg, reg, _ := newTestEnv(t, nil)
+	r := gin.New()
+	r.POST("/admin/config", AdminUpsertConfigHandler(store, cfg, reg, nil))
+	save := func(tpl string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/config", strings.NewReader(`{"appConfig":{"STORAGE_KEY_TEMPLATE":"`+tpl+`"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tpl := range []string{"{yyyy}/{bogus}", "../{hash}"} {
+		w := save(tpl)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "存储配置无效") {
+			t.Fatalf("无效模板 %q 应返回 400: %d %s", tpl, w.Code, w.Body.String())
+		}
+	}
+	if tpl := cfg.GetAppConfig().StorageKeyTemplate; tpl != "" {
+		t.Fatalf("校验失败时不应修改配置: %q", tpl)
+	}
+	if saved, err := store.AppConfig.GetConfigs(context.Background()); err != nil || saved["STORAGE_KEY_TEMPLATE"] != "" {
+		t.Fatalf("校验失败时不应写入数据库: %q %v", saved["STORAGE_KEY_TEMPLATE"], err)
+	}
+
+	if w := save("{user}/{hash}{ext}"); w.Code != http.StatusOK {
+		t.Fatalf("有效模板应保存成功: %d %s", w.Code, w.Body.String())
+	}
+	if tpl := cfg.GetAppConfig().StorageKeyTemplate; tpl != "{user}/{hash}{ext}" {
+		t.Fatalf("保存后应更新配置: %q", tpl)
+	}
+}
@@ -99,14 +99,29 @@ func LogoutHandler(store *db.DB, cfg config.Config, sessions *session.Manager) g
 	}
 }
 
-func MeHandler() gin.HandlerFunc {
+type mePayload struct {
+	userPayload
+	Quota userQuota `json:"quota"`
+}
+
+func MeHandler(store *db.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user := middlewareGetUser(c)
 		if user == nil {
 			c.JSON(http.StatusUnauthorized, Fail[any]("未登录", 401))
 			return
 		}
-		c.JSON(http.StatusOK, Ok(userPayload{ID: user.ID, Username: user.Username, Nickname: user.Nickname, Email: user.Email}, "ok"))
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		quota, err := loadUserQuota(ctx, store, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取用户配额失败", 500))
+			return
+		}
+		c.JSON(http.StatusOK, Ok(mePayload{
+			userPayload: userPayload{ID: user.ID, Username: user.Username, Nickname: user.Nickname, Email: user.Email},
+			Quota:       quota,
+		}, "ok"))
 	}
 }
 
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/db/model"
+)
+
+func TestUploadDedupReferences(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, nil)
+	ctx := context.Background()
+	if err := os.MkdirAll(cfg.MergeDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	upload := func(name string, data []byte) uploadResponse {
+		t.Helper()
+		path := filepath.Join(cfg.MergeDir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := finalizeMergedFile(ctx, store, cfg, reg, admin, path, mergedUpload{Filename: name})
+		if err != nil {
+			t.Fatalf("上传 %s 失败: %v", name, err)
+		}
+		return resp
+	}
+	pathOf := func(id int64) string {
+		t.Helper()
+		res, err := store.Resource.FindByIDAndUser(ctx, id, admin.ID)
+		if err != nil || res == nil {
+			t.Fatalf("读取资源 %d 失败: %v", id, err)
+		}
+		return res.Path
+	}
+	objectExists := func(path string) bool {
+		stg, err := reg.ByStoredPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = stg.Stat(path)
+		return err == nil
+	}
+	r := gin.New()
+	r.POST("/gallery/delete", func(c *gin.Context) { c.Set("user", admin) }, GalleryDeleteHandler(store, reg))
+	deleteResource := func(id int64) {
+		t.Helper()
+		body, _ := json.Marshal(galleryDeleteRequest{ID: id})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/gallery/delete", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("删除资源 %d 失败: %d %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	// 内容相同的上传复用同一个存储对象
+	data := []byte("shared content")
+	first := upload("first.txt", data)
+	second := upload("second.txt", data)
+	third := upload("third.txt", data)
+	shared := pathOf(first.ResourceID)
+	if pathOf(second.ResourceID) != shared || pathOf(third.ResourceID) != shared {
+		t.Fatal("内容相同的上传应复用已有对象")
+	}
+
+	// 仍有其他引用时保留对象
+	deleteResource(first.ResourceID)
+	if !objectExists(shared) {
+		t.Fatal("仍有引用时不应删除存储对象")
+	}
+	deleteResource(second.ResourceID)
+	if !objectExists(shared) {
+		t.Fatal("仍有引用时不应删除存储对象")
+	}
+	// 删除最后一个引用后移除对象，再次上传写入新对象
+	deleteResource(third.ResourceID)
+	if objectExists(shared) {
+		t.Fatal("最后一个引用删除后应删除存储对象")
+	}
+	again := upload("again.txt", data)
+	if !objectExists(pathOf(again.ResourceID)) {
+		t.Fatal("对象删除后重新上传应写入新对象")
+	}
+}
+
+func TestUploadDedupRejectsMD5Collision(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, nil)
+	ctx := context.Background()
+	if err := os.MkdirAll(cfg.MergeDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("uploaded content")
+	sum := md5.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+	// 已有资源声明了相同的 MD5 与大小，但对象内容不同，模拟构造的碰撞
+	stg := reg.Storages[reg.DefaultDriver]
+	forged := bytes.Repeat([]byte("x"), len(data))
+	forgedPath, err := stg.Write("forged.txt", bytes.NewReader(forged), int64(len(forged)), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Resource.Insert(ctx, model.Resource{Filename: "forged.txt", Hash: hash, Type: "text/plain", Path: forgedPath, FileSize: int64(len(forged)), UserID: admin.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(cfg.MergeDir, "upload.txt")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := finalizeMergedFile(ctx, store, cfg, reg, admin, path, mergedUpload{Filename: "upload.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := store.Resource.FindByIDAndUser(ctx, resp.ResourceID, admin.ID)
+	if err != nil || res == nil {
+		t.Fatal(err)
+	}
+	if res.Path == forgedPath {
+		t.Fatal("内容不同的对象不应被复用")
+	}
+	got, err := stg.Open(res.Path, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(got)
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("新资源应指向本次上传的内容")
+	}
+}
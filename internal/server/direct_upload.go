@@ -0,0 +1,429 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+const (
+	directUploadTTL = time.Hour
+	// S3 要求除最后一片外每片不小于 5MB。
+	directMinPartSize     = 5 * 1024 * 1024
+	directDefaultPartSize = 8 * 1024 * 1024
+	directMaxParts        = 10000
+)
+
+var md5HexRegex = regexp.MustCompile(`^[a-f0-9]{32}$`)
+
+// directUpload 已抢占的直传任务及其存储驱动。
+type directUpload struct {
+	model.DirectUpload
+	tags     []string
+	stg      storage.Storage
+	uploader storage.DirectUploader
+}
+
+var (
+	errDirectUploadNotFound = errors.New("直传任务不存在")
+	errDirectUploadExpired  = errors.New("直传任务已过期")
+	errDirectUploadBusy     = errors.New("直传任务正在处理中")
+)
+
+// claimDirectUpload 取出待确认的直传任务并标记为处理中，仅签发者可以确认，避免同一任务被重复确认。
+// 过期未确认的任务由上传清理任务删除对象。
+func claimDirectUpload(ctx context.Context, store *db.DB, reg *storage.Registry, id string, userID int64) (*directUpload, error) {
+	record, err := store.Direct.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.UserID != userID {
+		return nil, errDirectUploadNotFound
+	}
+	if record.Status != db.DirectUploadStatusPending {
+		return nil, errDirectUploadBusy
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, errDirectUploadExpired
+	}
+	stg, ok := reg.Get(record.StorageName)
+	if !ok {
+		return nil, fmt.Errorf("存储 %s 不存在", record.StorageName)
+	}
+	uploader, ok := stg.(storage.DirectUploader)
+	if !ok {
+		return nil, fmt.Errorf("存储 %s 不支持直传", record.StorageName)
+	}
+	tags, err := db.ParseTagsFromStrings([]string{record.Tags})
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := store.Direct.Claim(ctx, id, time.Now().Add(directUploadTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errDirectUploadBusy
+	}
+	return &directUpload{DirectUpload: *record, tags: tags, stg: stg, uploader: uploader}, nil
+}
+
+type presignUploadRequest struct {
+	Filename  string `json:"filename"`
+	FileSize  int64  `json:"filesize"`
+	Hash      string `json:"hash"`
+	Tags      string `json:"tags"`
+	PickIt    bool   `json:"pickIt"`
+	Multipart bool   `json:"multipart"`
+	PartSize  int64  `json:"partSize"`
+}
+
+type presignedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	URL        string `json:"url"`
+}
+
+type presignUploadResponse struct {
+	UploadID  string            `json:"uploadId"`
+	ObjectKey string            `json:"objectKey"`
+	Method    string            `json:"method,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	PartSize  int64             `json:"partSize,omitempty"`
+	Parts     []presignedPart   `json:"parts,omitempty"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+type presignCompleteRequest struct {
+	UploadID string                 `json:"uploadId"`
+	Parts    []storage.UploadedPart `json:"parts"`
+}
+
+// PresignUploadHandler 为当前存储驱动签发直传链接，文件内容不再经过服务端。
+func PresignUploadHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := uploadUser(c)
+		var req presignUploadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("参数错误", 400))
+			return
+		}
+		fileName := filepath.Base(strings.TrimSpace(req.Filename))
+		if fileName == "" || fileName == "." || fileName == "/" || req.FileSize < 0 {
+			c.JSON(http.StatusBadRequest, Fail[any]("缺少文件名或文件大小", 400))
+			return
+		}
+		tags, err := db.ParseTagsFromStrings([]string{req.Tags})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
+			return
+		}
+		hash := strings.ToLower(strings.TrimSpace(req.Hash))
+		if hash != "" && !md5HexRegex.MatchString(hash) {
+			c.JSON(http.StatusBadRequest, Fail[any]("hash 需为 32 位 MD5", 400))
+			return
+		}
+		if !checkUploadAllowed(c, cfg, user, fileName, req.FileSize) {
+			return
+		}
+		if !checkUploadQuota(c, store, user, req.FileSize) {
+			return
+		}
+
+		storageName, stg := routeUpload(reg, user, tags, storage.GuessMime(fileName), req.FileSize)
+		uploader, ok := stg.(storage.DirectUploader)
+		if !ok {
+			c.JSON(http.StatusBadRequest, Fail[any]("当前存储不支持直传", 400))
+			return
+		}
+
+		// 未提供 hash 时以随机值占位生成对象 key，确认时再计算真实 hash。
+		keyHash := hash
+		if keyHash == "" {
+			keyHash, err = randomHex(16)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Fail[any]("生成上传任务失败", 500))
+				return
+			}
+		}
+		id, err := randomHex(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("生成上传任务失败", 500))
+			return
+		}
+		objectKey, err := buildUploadKey(cfg, storage.KeyMeta{Hash: keyHash, Filename: fileName, Username: user.Username, Tags: tags, Time: time.Now()})
+		if err != nil {
+			reg.Logger.Error("生成对象 key 失败", "err", err)
+			c.JSON(http.StatusInternalServerError, Fail[any]("生成上传任务失败", 500))
+			return
+		}
+		item := &model.DirectUpload{
+			ID:          id,
+			UserID:      user.ID,
+			StorageName: storageName,
+			ObjectKey:   objectKey,
+			Filename:    fileName,
+			ContentType: storage.GuessMime(fileName),
+			Hash:        hash,
+			FileSize:    req.FileSize,
+			Tags:        strings.Join(tags, ","),
+			PickIt:      req.PickIt,
+			Status:      db.DirectUploadStatusPending,
+			ExpiresAt:   time.Now().Add(directUploadTTL),
+		}
+		resp := presignUploadResponse{UploadID: item.ID, ObjectKey: item.ObjectKey, ExpiresAt: item.ExpiresAt}
+
+		if !req.Multipart {
+			url, err := uploader.PresignPut(item.ObjectKey, item.ContentType, item.FileSize, directUploadTTL)
+			if err != nil {
+				reg.Logger.Error("生成直传链接失败", "err", err)
+				c.JSON(http.StatusInternalServerError, Fail[any]("生成直传链接失败", 500))
+				return
+			}
+			resp.Method = http.MethodPut
+			resp.URL = url
+			resp.Headers = map[string]string{"Content-Type": item.ContentType}
+		} else {
+			partSize := req.PartSize
+			if partSize <= 0 {
+				partSize = directDefaultPartSize
+			}
+			if partSize < directMinPartSize {
+				c.JSON(http.StatusBadRequest, Fail[any]("分片大小不能小于 5MB", 400))
+				return
+			}
+			totalParts := (item.FileSize + partSize - 1) / partSize
+			if totalParts == 0 {
+				totalParts = 1
+			}
+			if totalParts > directMaxParts {
+				c.JSON(http.StatusBadRequest, Fail[any]("分片数量超过上限", 400))
+				return
+			}
+			multipartID, err := uploader.CreateMultipart(item.ObjectKey, item.ContentType)
+			if err != nil {
+				reg.Logger.Error("创建 multipart 上传失败", "err", err)
+				c.JSON(http.StatusInternalServerError, Fail[any]("生成直传链接失败", 500))
+				return
+			}
+			item.MultipartID = multipartID
+			parts := make([]presignedPart, 0, totalParts)
+			for i := int32(1); i <= int32(totalParts); i++ {
+				url, err := uploader.PresignUploadPart(item.ObjectKey, multipartID, i, directUploadTTL)
+				if err != nil {
+					_ = uploader.AbortMultipart(item.ObjectKey, multipartID)
+					reg.Logger.Error("生成分片直传链接失败", "err", err)
+					c.JSON(http.StatusInternalServerError, Fail[any]("生成直传链接失败", 500))
+					return
+				}
+				parts = append(parts, presignedPart{PartNumber: i, URL: url})
+			}
+			resp.PartSize = partSize
+			resp.Parts = parts
+		}
+
+		if err := store.Direct.Create(c.Request.Context(), item); err != nil {
+			if item.MultipartID != "" {
+				_ = uploader.AbortMultipart(item.ObjectKey, item.MultipartID)
+			}
+			reg.Logger.Error("保存直传任务失败", "err", err)
+			c.JSON(http.StatusInternalServerError, Fail[any]("生成上传任务失败", 500))
+			return
+		}
+		reg.Logger.Info("签发直传链接", "user", user.Username, "file", fileName, "size", item.FileSize, "multipart", req.Multipart, "key", item.ObjectKey)
+		c.JSON(http.StatusOK, Ok(resp, "ok"))
+	}
+}
+
+// PresignCompleteHandler 确认直传完成：校验对象大小与 hash 后按常规上传流程入库。
+func PresignCompleteHandler(store *db.DB, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := uploadUser(c)
+		var req presignCompleteRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.UploadID == "" {
+			c.JSON(http.StatusBadRequest, Fail[any]("缺少 uploadId", 400))
+			return
+		}
+		ctx := c.Request.Context()
+		item, err := claimDirectUpload(ctx, store, reg, req.UploadID, user.ID)
+		if err != nil {
+			if errors.Is(err, errDirectUploadNotFound) || errors.Is(err, errDirectUploadExpired) || errors.Is(err, errDirectUploadBusy) {
+				c.JSON(http.StatusNotFound, Fail[any](err.Error(), 404))
+				return
+			}
+			reg.Logger.Error("读取直传任务失败", "err", err, "upload", req.UploadID)
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取直传任务失败", 500))
+			return
+		}
+		// release 放弃本次确认以便客户端重试，remove 作废任务
+		release := func() {
+			if err := store.Direct.Release(ctx, item.ID); err != nil {
+				reg.Logger.Warn("释放直传任务失败", "err", err, "upload", item.ID)
+			}
+		}
+		remove := func() {
+			if err := store.Direct.Delete(ctx, item.ID); err != nil {
+				reg.Logger.Warn("删除直传任务失败", "err", err, "upload", item.ID)
+			}
+		}
+
+		storedPath, err := item.uploader.StoredPath(item.ObjectKey)
+		if err != nil {
+			remove()
+			c.JSON(http.StatusInternalServerError, Fail[any]("存储路径无效", 500))
+			return
+		}
+		if item.MultipartID != "" {
+			if len(req.Parts) == 0 {
+				release()
+				c.JSON(http.StatusBadRequest, Fail[any]("缺少分片信息", 400))
+				return
+			}
+			if err := item.uploader.CompleteMultipart(item.ObjectKey, item.MultipartID, req.Parts); err != nil {
+				release()
+				reg.Logger.Error("完成 multipart 上传失败", "err", err, "key", item.ObjectKey)
+				c.JSON(http.StatusBadRequest, Fail[any]("分片合并失败，请检查分片是否全部上传", 400))
+				return
+			}
+		}
+
+		info, err := item.stg.Stat(storedPath)
+		if err != nil {
+			release()
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				c.JSON(http.StatusBadRequest, Fail[any]("文件尚未上传", 400))
+				return
+			}
+			reg.Logger.Error("读取直传对象失败", "err", err, "key", item.ObjectKey)
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取文件失败", 500))
+			return
+		}
+		// 以下校验失败均视为上传内容无效，删除对象并作废任务。
+		reject := func(msg string) {
+			remove()
+			if err := item.stg.Delete(storedPath); err != nil {
+				reg.Logger.Warn("删除无效直传对象失败", "err", err, "path", storedPath)
+			}
+			c.JSON(http.StatusBadRequest, Fail[any](msg, 400))
+		}
+		if info.Size != item.FileSize {
+			reject("文件大小与声明不一致")
+			return
+		}
+		// 单次 PUT 的 ETag 即内容 MD5，与声明一致时无需回读；否则回读计算。
+		hash := item.Hash
+		if hash == "" || item.MultipartID != "" || info.ETag != hash {
+			sum, err := hashStoredObject(item.stg, storedPath)
+			if err != nil {
+				release()
+				reg.Logger.Error("计算直传对象摘要失败", "err", err, "path", storedPath)
+				c.JSON(http.StatusInternalServerError, Fail[any]("计算摘要失败", 500))
+				return
+			}
+			if hash != "" && sum != hash {
+				reject("文件 hash 校验失败")
+				return
+			}
+			hash = sum
+		}
+
+		// 直传内容未经过服务端，入库前回读文件头识别类型
+		contentType := item.ContentType
+		if head, err := readStoredHead(item.stg, storedPath, info.Size); err != nil {
+			reg.Logger.Warn("读取直传对象文件头失败", "err", err, "path", storedPath)
+		} else {
+			detected, consistent := storage.SniffMime(head, item.Filename)
+			if !consistent {
+				reg.Logger.Warn("文件内容与扩展名不符", "user", user.Username, "file", item.Filename, "detected", detected)
+				if user.ID == db.GuestUserID {
+					reject("文件内容与扩展名不符")
+					return
+				}
+			}
+			contentType = detected
+		}
+
+		unlock := store.Resource.LockHash(hash)
+		defer unlock()
+		uploadedPath := storedPath
+		content := func() (io.ReadCloser, error) { return storage.OpenContext(ctx, item.stg, uploadedPath, 0, -1) }
+		if existing, err := findReusablePath(ctx, store, reg, item.StorageName, hash, info.Size, content); err == nil && existing != "" && existing != storedPath {
+			if err := item.stg.Delete(storedPath); err != nil {
+				reg.Logger.Warn("删除重复直传对象失败", "err", err, "path", storedPath)
+			}
+			storedPath = existing
+		}
+
+		resID, share, err := persistResource(ctx, store, model.Resource{Filename: item.Filename, Hash: hash, Type: contentType, Path: storedPath, FileSize: info.Size, UserID: user.ID}, item.tags)
+		if err != nil {
+			var ue *uploadError
+			if errors.As(err, &ue) {
+				// 超出配额时作废任务，客户端上传的对象未被复用时一并删除
+				remove()
+				discardWritten(reg, item.stg, storedPath, storedPath == uploadedPath)
+				writeUploadError(c, err)
+				return
+			}
+			release()
+			reg.Logger.Error("写入数据库失败", "err", err)
+			c.JSON(http.StatusInternalServerError, Fail[any]("记录失败", 500))
+			return
+		}
+		remove()
+		if err := setUploadPickResource(store, user, resID, item.PickIt); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("设置 pick 资源失败", 500))
+			return
+		}
+		reg.Logger.Info("直传上传完成", "user", user.Username, "file", item.Filename, "resource_id", resID, "share", share)
+		c.JSON(http.StatusOK, Ok(uploadResponse{Merged: true, UploadID: item.ID, Filename: item.Filename, Size: info.Size, ShareCode: share, ResourceID: resID}, "ok"))
+	}
+}
+
+func readStoredHead(stg storage.Storage, storedPath string, size int64) ([]byte, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	r, err := stg.Open(storedPath, 0, min(size, storage.SniffLen)-1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, storage.SniffLen))
+}
+
+func hashStoredObject(stg storage.Storage, storedPath string) (string, error) {
+	r, err := stg.Open(storedPath, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
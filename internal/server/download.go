@@ -1,12 +1,11 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -21,49 +20,72 @@ import (
 
 func downloadForS3(c *gin.Context, reg *storage.Registry, record *model.ShareResource, storageDriver storage.Storage) {
 	// 云端文件：默认重定向到带签名链接，开启 relay 时改为服务端代理传输。
-	signed, err := storageDriver.GetURL(record.Path, 30*time.Minute)
-	if err != nil {
-		reg.Logger.Error("生成签名链接失败", "err", err)
-		c.JSON(http.StatusInternalServerError, Fail[any]("资源失效", 410))
-		return
-	}
 	if !record.Relay {
-		c.Redirect(http.StatusFound, signed)
-		return
+		signed, err := presignDownload(storageDriver, record)
+		if err == nil {
+			c.Redirect(http.StatusFound, signed)
+			return
+		}
+		// 不支持直链的驱动（如 WebDAV、加密存储）回退为服务端转发。
+		if !errors.Is(err, storage.ErrURLUnsupported) {
+			reg.Logger.Error("生成签名链接失败", "err", err)
+			c.JSON(http.StatusInternalServerError, Fail[any]("资源失效", 410))
+			return
+		}
 	}
-	if err := relayRemoteFile(c, signed, record); err != nil {
-		reg.Logger.Error("代理下载失败", "err", err, "record", record)
-		if !c.Writer.Written() {
-			c.JSON(http.StatusBadGateway, Fail[any]("文件转发失败", 502))
+	streamObject(c, reg, record, storageDriver)
+}
+
+// presignDownload 生成以附件形式下载的签名链接，HTML、SVG 等可执行内容改用 application/octet-stream。
+// 驱动无法覆盖响应头时，可执行内容返回 ErrURLUnsupported 改为服务端转发。
+func presignDownload(storageDriver storage.Storage, record *model.ShareResource) (string, error) {
+	contentType := record.Type
+	if contentType == "" {
+		contentType = storage.GuessMime(record.Filename)
+	}
+	active := storage.IsActiveContent(contentType)
+	if d, ok := storageDriver.(storage.DownloadURLer); ok {
+		opts := storage.DownloadOptions{ContentType: contentType, ContentDisposition: buildContentDisposition(filepath.Base(record.Filename))}
+		if active {
+			opts.ContentType = "application/octet-stream"
 		}
+		return d.GetDownloadURL(record.Path, 30*time.Minute, opts)
 	}
+	if active {
+		return "", storage.ErrURLUnsupported
+	}
+	return storageDriver.GetURL(record.Path, 30*time.Minute)
 }
 
 func downloadForLocal(c *gin.Context, reg *storage.Registry, record *model.ShareResource, storageDriver storage.Storage) {
 	// 本地文件：直接传输文件内容。
-	filePath, err := storageDriver.GetURL(record.Path, 0)
-	if err != nil {
-		reg.Logger.Error("获取本地文件路径失败", "err", err)
-		c.JSON(http.StatusInternalServerError, Fail[any]("资源失效", 410))
-		return
-	}
-	f, err := os.Open(filePath)
-	if err != nil {
-		reg.Logger.Error("打开文件失败", "err", err)
-		c.JSON(http.StatusGone, Fail[any]("文件已失效", 410))
+	streamObject(c, reg, record, storageDriver)
+}
+
+// streamObject 通过 Storage.Open/Stat 传输文件内容，本地与云端 relay 共用同一套缓存协商与 Range 处理。
+func streamObject(c *gin.Context, reg *storage.Registry, record *model.ShareResource, storageDriver storage.Storage) {
+	method := c.Request.Method
+	if method != http.MethodGet && method != http.MethodHead {
+		c.JSON(http.StatusMethodNotAllowed, Fail[any]("请求方法不支持", 405))
 		return
 	}
-	defer f.Close()
-	stat, err := f.Stat()
+	// 客户端断开后随请求上下文取消远端读取
+	ctx := c.Request.Context()
+	stat, err := storage.StatContext(ctx, storageDriver, record.Path)
 	if err != nil {
-		reg.Logger.Error("读取文件信息失败", "err", err)
-		c.JSON(http.StatusGone, Fail[any]("文件已失效", 410))
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			reg.Logger.Error("文件不存在", "path", record.Path)
+			c.JSON(http.StatusGone, Fail[any]("文件已失效", 410))
+			return
+		}
+		reg.Logger.Error("读取文件信息失败", "err", err, "path", record.Path)
+		c.JSON(http.StatusBadGateway, Fail[any]("读取文件信息失败", 502))
 		return
 	}
-	// 本地文件：允许浏览器缓存，并通过 ETag/Last-Modified 协商避免重复下载。
+	// 允许浏览器缓存，并通过 ETag/Last-Modified 协商避免重复下载。
 	etag := buildWeakETag(stat)
-	setCacheHeaders(c, stat, etag)
 	if isNotModified(c, stat, etag) {
+		setCacheHeaders(c, stat, etag)
 		c.Status(http.StatusNotModified)
 		return
 	}
@@ -71,58 +93,70 @@ func downloadForLocal(c *gin.Context, reg *storage.Registry, record *model.Share
 	if contentType == "" {
 		contentType = storage.GuessMime(record.Filename)
 	}
-	rangeHeader := c.GetHeader("Range")
-	if rangeHeader != "" {
-		start, end, ok := parseRange(rangeHeader, stat.Size())
+	start, end := int64(0), stat.Size-1
+	status := http.StatusOK
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
+		var ok bool
+		start, end, ok = parseRange(rangeHeader, stat.Size)
 		if !ok {
 			c.JSON(http.StatusRequestedRangeNotSatisfiable, Fail[any]("Range 无效", 416))
 			return
 		}
-		if _, err := f.Seek(start, io.SeekStart); err != nil {
-			c.JSON(http.StatusInternalServerError, Fail[any]("读取失败", 500))
-			return
-		}
-		length := end - start + 1
-		c.Status(http.StatusPartialContent)
-		c.Header("Content-Type", contentType)
-		c.Header("Content-Length", strconv.FormatInt(length, 10))
-		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, stat.Size()))
-		c.Header("Accept-Ranges", "bytes")
-		c.Header("Content-Disposition", buildContentDisposition(filepath.Base(record.Filename)))
-		if c.Request.Method == http.MethodHead {
+		status = http.StatusPartialContent
+	}
+	length := end - start + 1
+	var body io.ReadCloser
+	if method == http.MethodGet && length > 0 {
+		body, err = storage.OpenContext(ctx, storageDriver, record.Path, start, end)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			reg.Logger.Error("打开文件失败", "err", err, "path", record.Path)
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				c.JSON(http.StatusGone, Fail[any]("文件已失效", 410))
+				return
+			}
+			c.JSON(http.StatusBadGateway, Fail[any]("读取文件失败", 502))
 			return
 		}
-		io.CopyN(c.Writer, f, length)
-		return
+		defer body.Close()
+	}
+	// 打开成功后才写入实体头，避免错误响应带上文件的 Content-Length 等头部
+	setCacheHeaders(c, stat, etag)
+	if status == http.StatusPartialContent {
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, stat.Size))
 	}
-
 	c.Header("Content-Type", contentType)
-	c.Header("Content-Length", strconv.FormatInt(stat.Size(), 10))
+	c.Header("Content-Length", strconv.FormatInt(length, 10))
 	c.Header("Accept-Ranges", "bytes")
 	c.Header("Content-Disposition", buildContentDisposition(filepath.Base(record.Filename)))
-	c.Status(http.StatusOK)
-	if c.Request.Method == http.MethodHead {
+	c.Status(status)
+	if body == nil {
+		return
+	}
+	if _, err := io.CopyN(c.Writer, body, length); err != nil {
+		reg.Logger.Error("文件传输中断", "err", err, "record", record)
 		return
 	}
-	io.Copy(c.Writer, f)
-	reg.Logger.Info("完成文件传输", "record", record, "size", stat.Size())
+	reg.Logger.Info("完成文件传输", "record", record, "size", length)
 }
 
-func buildWeakETag(stat os.FileInfo) string {
+func buildWeakETag(stat storage.ObjectInfo) string {
 	// 采用弱 ETag：避免误判“强一致”；同时足以用于协商缓存，减少重复下载。
-	return fmt.Sprintf(`W/"%x-%x"`, stat.Size(), stat.ModTime().UnixNano())
+	return fmt.Sprintf(`W/"%x-%x"`, stat.Size, stat.ModTime.UnixNano())
 }
 
-func setCacheHeaders(c *gin.Context, stat os.FileInfo, etag string) {
+func setCacheHeaders(c *gin.Context, stat storage.ObjectInfo, etag string) {
 	c.Header("ETag", etag)
-	c.Header("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
+	c.Header("Last-Modified", stat.ModTime.UTC().Format(http.TimeFormat))
 	// 安全优先：允许缓存，但每次使用前必须与服务端协商；避免长期缓存导致短链复用时内容错配。
 	c.Header("Cache-Control", "public, max-age=0, must-revalidate")
 	// Range 会影响响应体，提示中间缓存按 Range 区分（浏览器也会更谨慎处理）。
 	c.Header("Vary", "Range")
 }
 
-func isNotModified(c *gin.Context, stat os.FileInfo, etag string) bool {
+func isNotModified(c *gin.Context, stat storage.ObjectInfo, etag string) bool {
 	// 优先 ETag；命中则直接 304。
 	if matchIfNoneMatch(c.GetHeader("If-None-Match"), etag) {
 		return true
@@ -131,7 +165,7 @@ func isNotModified(c *gin.Context, stat os.FileInfo, etag string) bool {
 	if ims := strings.TrimSpace(c.GetHeader("If-Modified-Since")); ims != "" {
 		t, err := http.ParseTime(ims)
 		if err == nil {
-			mod := stat.ModTime().UTC().Truncate(time.Second)
+			mod := stat.ModTime.UTC().Truncate(time.Second)
 			if !mod.After(t.UTC()) {
 				return true
 			}
@@ -188,78 +222,3 @@ func buildContentDisposition(filename string) string {
 	encoded := url.QueryEscape(filename)
 	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", safe, encoded)
 }
-
-var relayForwardRequestHeaders = []string{
-	"Range",
-	"If-Modified-Since",
-	"If-None-Match",
-}
-
-var relayForwardResponseHeaders = []string{
-	"Accept-Ranges",
-	"Cache-Control",
-	"Content-Length",
-	"Content-Range",
-	"Content-Type",
-	"Content-Disposition",
-	"ETag",
-	"Last-Modified",
-	"Expires",
-}
-
-var relayHTTPClient = &http.Client{
-	Transport: &http.Transport{
-		Proxy:               http.ProxyFromEnvironment,
-		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
-		MaxIdleConns:        100,
-		IdleConnTimeout:     90 * time.Second,
-		TLSHandshakeTimeout: 10 * time.Second,
-	},
-}
-
-func relayRemoteFile(c *gin.Context, signedURL string, record *model.ShareResource) error {
-	method := c.Request.Method
-	if method != http.MethodGet && method != http.MethodHead {
-		c.JSON(http.StatusMethodNotAllowed, Fail[any]("请求方法不支持", 405))
-		return nil
-	}
-
-	req, err := http.NewRequestWithContext(c.Request.Context(), method, signedURL, nil)
-	if err != nil {
-		return err
-	}
-	for _, header := range relayForwardRequestHeaders {
-		value := strings.TrimSpace(c.GetHeader(header))
-		if value != "" {
-			req.Header.Set(header, value)
-		}
-	}
-
-	resp, err := relayHTTPClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	for _, header := range relayForwardResponseHeaders {
-		if value := strings.TrimSpace(resp.Header.Get(header)); value != "" {
-			c.Header(header, value)
-		}
-	}
-	// 统一附件下载。
-	c.Header("Content-Disposition", buildContentDisposition(filepath.Base(record.Filename)))
-	if strings.TrimSpace(resp.Header.Get("Content-Type")) == "" {
-		contentType := record.Type
-		if contentType == "" {
-			contentType = storage.GuessMime(record.Filename)
-		}
-		c.Header("Content-Type", contentType)
-	}
-
-	c.Status(resp.StatusCode)
-	if method == http.MethodHead || resp.StatusCode == http.StatusNotModified {
-		return nil
-	}
-	_, err = io.Copy(c.Writer, resp.Body)
-	return err
-}
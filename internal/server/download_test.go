@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+// unreadableStorage 能读取对象信息但打开失败，模拟远端存储在传输前出错。
+type unreadableStorage struct{ brokenStorage }
+
+func (unreadableStorage) Stat(string) (storage.ObjectInfo, error) {
+	return storage.ObjectInfo{Size: 1024, ModTime: time.Now()}, nil
+}
+func (unreadableStorage) Open(string, int64, int64) (io.ReadCloser, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestStreamObjectSetsHeadersOnlyAfterOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := &storage.Registry{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	record := &model.ShareResource{Filename: "a.txt", Path: "s3://broken/a.txt", Type: "text/plain", Relay: true}
+
+	for _, rangeHeader := range []string{"", "bytes=0-9"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/s/code", nil)
+		if rangeHeader != "" {
+			c.Request.Header.Set("Range", rangeHeader)
+		}
+		downloadForS3(c, reg, record, unreadableStorage{})
+		if w.Code != http.StatusBadGateway {
+			t.Fatalf("打开失败应返回 502: %d", w.Code)
+		}
+		for _, h := range []string{"Content-Range", "Content-Disposition", "Accept-Ranges", "ETag"} {
+			if v := w.Header().Get(h); v != "" {
+				t.Errorf("打开失败时不应设置 %s: %q", h, v)
+			}
+		}
+		if got := w.Header().Get("Content-Length"); got != "" && got != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("Content-Length 应与错误响应体一致: %s", got)
+		}
+	}
+}
+
+// signingStorage 记录生成直链时覆盖的响应头。
+type signingStorage struct {
+	brokenStorage
+	opts *storage.DownloadOptions
+}
+
+func (s signingStorage) GetURL(string, time.Duration) (string, error) {
+	return "https://bucket.example.com/plain", nil
+}
+func (s signingStorage) GetDownloadURL(_ string, _ time.Duration, opts storage.DownloadOptions) (string, error) {
+	*s.opts = opts
+	return "https://bucket.example.com/signed", nil
+}
+
+// plainURLStorage 只能生成不带响应头覆盖的直链，对象内容可经 Open 转发。
+type plainURLStorage struct{ brokenStorage }
+
+func (plainURLStorage) GetURL(string, time.Duration) (string, error) {
+	return "https://bucket.example.com/plain", nil
+}
+func (plainURLStorage) Stat(string) (storage.ObjectInfo, error) {
+	return storage.ObjectInfo{Size: 13, ModTime: time.Now()}, nil
+}
+func (plainURLStorage) Open(string, int64, int64) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("<html></html>")), nil
+}
+
+func TestDownloadForS3ForcesAttachment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := &storage.Registry{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	download := func(stg storage.Storage, record *model.ShareResource) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/s/code", nil)
+		downloadForS3(c, reg, record, stg)
+		return w
+	}
+
+	for _, tt := range []struct {
+		filename, contentType, wantType string
+	}{
+		{"page.html", "text/html", "application/octet-stream"},
+		{"icon.svg", "image/svg+xml", "application/octet-stream"},
+		{"photo.png", "image/png", "image/png"},
+		{"notes.txt", "", "text/plain"},
+	} {
+		var opts storage.DownloadOptions
+		w := download(signingStorage{opts: &opts}, &model.ShareResource{Filename: tt.filename, Path: "s3://bucket/" + tt.filename, Type: tt.contentType})
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://bucket.example.com/signed" {
+			t.Fatalf("%s: 应重定向到签名链接: %d", tt.filename, w.Code)
+		}
+		if opts.ContentType != tt.wantType || !strings.HasPrefix(opts.ContentDisposition, "attachment;") {
+			t.Errorf("%s: 签名链接响应头 = %+v，期望类型 %s 且以附件下载", tt.filename, opts, tt.wantType)
+		}
+	}
+
+	// 驱动无法覆盖响应头时，可执行内容改为服务端转发
+	w := download(plainURLStorage{}, &model.ShareResource{Filename: "page.html", Path: "s3://bucket/page.html", Type: "text/html"})
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("可执行内容应经服务端以附件转发: %d %v", w.Code, w.Header())
+	}
+	if w := download(plainURLStorage{}, &model.ShareResource{Filename: "photo.png", Path: "s3://bucket/photo.png", Type: "image/png"}); w.Code != http.StatusFound {
+		t.Fatalf("普通内容仍可使用直链: %d", w.Code)
+	}
+}
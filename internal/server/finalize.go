@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+// 后台合并任务的阶段，pending 表示仍在接收分片。
+const (
+	finalizePending   = "pending"
+	finalizeQueued    = "queued"
+	finalizeMerging   = "merging"
+	finalizeHashing   = "hashing"
+	finalizeUploading = "uploading"
+	finalizeDone      = "done"
+	finalizeFailed    = "failed"
+)
+
+const (
+	finalizeQueueSize = 256
+	// finalizeRescanInterval 重新扫描 finalizing 会话的间隔，补回队列已满时未能入队的任务。
+	finalizeRescanInterval = time.Minute
+	// finalizeMaxAttempts 临时故障导致合并失败时的最大尝试次数
+	finalizeMaxAttempts = 5
+)
+
+// finalizeState 后台合并任务的进度，Done/Total 为当前阶段已处理与总字节数。
+type finalizeState struct {
+	Phase string `json:"phase"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+}
+
+type uploadStatusPayload struct {
+	UploadID    string  `json:"uploadId"`
+	Filename    string  `json:"filename"`
+	State       string  `json:"state"`
+	Progress    float64 `json:"progress"`
+	Uploaded    int     `json:"uploaded"`
+	TotalChunks int64   `json:"totalChunks"`
+	ResourceID  int64   `json:"resourceId,omitempty"`
+	ShareCode   string  `json:"shareCode,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// FinalizeQueue 在后台合并分片、计算摘要并写入存储，避免大文件在最后一个分片或 tus 请求内
+// 同步处理导致代理超时。任务状态以上传会话为准，内存中只记录进行中任务的进度。
+type FinalizeQueue struct {
+	store *db.DB
+	cfg   *config.Config
+	reg   *storage.Registry
+	jobs  chan string
+
+	mu     sync.Mutex
+	states map[string]*finalizeState
+}
+
+func NewFinalizeQueue(store *db.DB, cfg *config.Config, reg *storage.Registry) *FinalizeQueue {
+	return &FinalizeQueue{
+		store:  store,
+		cfg:    cfg,
+		reg:    reg,
+		jobs:   make(chan string, finalizeQueueSize),
+		states: make(map[string]*finalizeState),
+	}
+}
+
+// Start 启动 workers 个后台协程，启动时及之后每隔 finalizeRescanInterval 重新排队
+// 未完成的合并任务，包括服务重启前中断的任务与队列已满时未能入队的任务。
+func (q *FinalizeQueue) Start(ctx context.Context, workers int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.work(ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(finalizeRescanInterval)
+		defer ticker.Stop()
+		for {
+			q.requeue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// requeue 将处于 finalizing 但不在队列或处理中的会话重新加入队列，队列已满时等待下次扫描。
+func (q *FinalizeQueue) requeue(ctx context.Context) {
+	listCtx, cancel := q.store.WithTimeout(ctx, 10*time.Second)
+	pending, err := q.store.Upload.ListByStatus(listCtx, db.UploadStatusFinalizing)
+	cancel()
+	if err != nil {
+		q.reg.Logger.Warn("读取未完成的合并任务失败", "err", err)
+		return
+	}
+	for _, session := range pending {
+		if _, ok := q.State(session.ID); ok {
+			continue
+		}
+		if !q.Enqueue(session.ID) {
+			return
+		}
+		q.reg.Logger.Info("重新排队合并任务", "upload_id", session.ID)
+	}
+}
+
+// Enqueue 将已抢占合并权的会话加入队列，已在队列或处理中的会话不会重复加入。
+// 队列已满时不阻塞并返回 false，会话保持 finalizing 状态，由定期扫描重新排队。
+func (q *FinalizeQueue) Enqueue(id string) bool {
+	q.mu.Lock()
+	if _, ok := q.states[id]; ok {
+		q.mu.Unlock()
+		return true
+	}
+	q.states[id] = &finalizeState{Phase: finalizeQueued}
+	q.mu.Unlock()
+	select {
+	case q.jobs <- id:
+		return true
+	default:
+		q.clearState(id)
+		return false
+	}
+}
+
+// State 返回进行中任务的进度。
+func (q *FinalizeQueue) State(id string) (finalizeState, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	state, ok := q.states[id]
+	if !ok {
+		return finalizeState{}, false
+	}
+	return *state, true
+}
+
+func (q *FinalizeQueue) setState(id, phase string, done, total int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	state, ok := q.states[id]
+	if !ok {
+		state = &finalizeState{}
+		q.states[id] = state
+	}
+	state.Phase, state.Done, state.Total = phase, done, total
+}
+
+func (q *FinalizeQueue) setStateFunc(id string) finalizeProgress {
+	return func(phase string, done, total int64) {
+		q.setState(id, phase, done, total)
+	}
+}
+
+func (q *FinalizeQueue) clearState(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.states, id)
+}
+
+func (q *FinalizeQueue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-q.jobs:
+			q.process(ctx, id)
+		}
+	}
+}
+
+func (q *FinalizeQueue) process(ctx context.Context, id string) {
+	defer q.clearState(id)
+	session, err := q.store.Upload.Get(ctx, id)
+	if err != nil || session == nil || session.Status != db.UploadStatusFinalizing {
+		return
+	}
+	user, err := q.store.User.GetByID(ctx, session.UserID)
+	if err != nil {
+		q.fail(ctx, session, &uploadError{Status: http.StatusInternalServerError, Msg: "读取上传者失败"})
+		return
+	}
+	if user == nil {
+		q.fail(ctx, session, &uploadError{Status: http.StatusNotFound, Msg: "上传者不存在"})
+		return
+	}
+	tags, err := db.ParseTagsFromStrings([]string{session.Tags})
+	if err != nil {
+		q.fail(ctx, session, &uploadError{Status: http.StatusBadRequest, Msg: err.Error()})
+		return
+	}
+	var resp uploadResponse
+	if strings.HasPrefix(id, tusDirPrefix) {
+		resp, err = finalizeTusUpload(ctx, q.store, q.cfg, q.reg, user, session, tags, q.setStateFunc(id))
+	} else {
+		resp, err = mergeUploadSession(ctx, q.store, q.cfg, q.reg, user, session, tags, q.setStateFunc(id))
+	}
+	if err != nil {
+		q.fail(ctx, session, err)
+		return
+	}
+	if err := q.store.Upload.Complete(ctx, id, resp.ResourceID, resp.ShareCode); err != nil {
+		q.reg.Logger.Warn("更新上传会话失败", "upload_id", id, "err", err)
+	}
+}
+
+// fail 处理合并失败：存储等临时故障保留分片并计入重试次数，由定期扫描重新排队；
+// 校验类错误或重试次数达到 finalizeMaxAttempts 后标记为失败并删除分片。
+func (q *FinalizeQueue) fail(ctx context.Context, session *model.UploadSession, err error) {
+	if ctx.Err() != nil {
+		// 服务关闭导致的中断不计入重试次数
+		return
+	}
+	msg := errStoreFailed.Msg
+	var ue *uploadError
+	if errors.As(err, &ue) {
+		msg = ue.Msg
+	}
+	if isTransientUploadError(err) && session.Attempts+1 < finalizeMaxAttempts {
+		q.reg.Logger.Warn("合并上传失败，稍后重试", "upload_id", session.ID, "attempt", session.Attempts+1, "err", err)
+		if recordErr := q.store.Upload.RecordAttempt(ctx, session.ID, msg); recordErr != nil {
+			q.reg.Logger.Warn("更新上传会话失败", "upload_id", session.ID, "err", recordErr)
+		}
+		return
+	}
+	q.reg.Logger.Warn("合并上传失败", "upload_id", session.ID, "attempts", session.Attempts+1, "err", err)
+	if markErr := q.store.Upload.MarkFailed(ctx, session.ID, msg); markErr != nil {
+		q.reg.Logger.Warn("更新上传会话失败", "upload_id", session.ID, "err", markErr)
+		return
+	}
+	_ = os.RemoveAll(filepath.Join(q.cfg.ChunkDir, session.ID))
+}
+
+// isTransientUploadError 判断错误是否由存储、数据库等服务端临时故障引起，重试可能成功；
+// 配额、校验与内容类型等客户端错误重试无意义。
+func isTransientUploadError(err error) bool {
+	var ue *uploadError
+	if !errors.As(err, &ue) {
+		return true
+	}
+	return ue.Status >= http.StatusInternalServerError
+}
+
+// UploadStatusHandler 查询上传会话的合并进度，仅会话创建者可以查询。
+func UploadStatusHandler(store *db.DB, cfg *config.Config, queue *FinalizeQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := loadUploadSession(c, store, c.Param("id"))
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, Ok(uploadStatus(cfg, queue, session), "ok"))
+	}
+}
+
+// uploadStatus 汇总会话状态与内存中的任务进度，Progress 为当前阶段的百分比。
+func uploadStatus(cfg *config.Config, queue *FinalizeQueue, session *model.UploadSession) uploadStatusPayload {
+	payload := uploadStatusPayload{
+		UploadID:    session.ID,
+		Filename:    session.Filename,
+		TotalChunks: session.TotalChunks,
+		ResourceID:  session.ResourceID,
+		ShareCode:   session.ShareCode,
+		Error:       session.Error,
+	}
+	switch session.Status {
+	case db.UploadStatusUploading:
+		payload.State = finalizePending
+		payload.Uploaded = len(listChunks(filepath.Join(cfg.ChunkDir, session.ID)))
+		payload.Progress = percent(int64(payload.Uploaded), session.TotalChunks)
+	case db.UploadStatusFinalizing:
+		payload.State = finalizeQueued
+		payload.Uploaded = int(session.TotalChunks)
+		if state, ok := queue.State(session.ID); ok {
+			payload.State = state.Phase
+			payload.Progress = percent(state.Done, state.Total)
+		}
+	case db.UploadStatusDone:
+		payload.State = finalizeDone
+		payload.Uploaded = int(session.TotalChunks)
+		payload.Progress = 100
+	default:
+		payload.State = finalizeFailed
+	}
+	return payload
+}
+
+func percent(done, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(done*10000/total) / 100
+}
+
+// finalizeProgress 上报后台任务当前阶段的已处理与总字节数，为 nil 时不上报。
+type finalizeProgress func(phase string, done, total int64)
+
+// phase 进入新阶段并返回该阶段的字节数回调。
+func (p finalizeProgress) phase(phase string, total int64) func(int64) {
+	if p == nil {
+		return func(int64) {}
+	}
+	p(phase, 0, total)
+	return func(done int64) { p(phase, done, total) }
+}
+
+// progressReader 读取时回调累计字节数，用于上报后台任务进度。
+type progressReader struct {
+	r      io.Reader
+	n      int64
+	report func(int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	p.report(p.n)
+	return n, err
+}
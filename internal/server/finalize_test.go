@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+func TestFinalizeQueueEnqueueDoesNotBlockWhenFull(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Config{DatabasePath: filepath.Join(t.TempDir(), "app.db")}
+	store, err := db.NewStore(cfg, logger, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewFinalizeQueue(store, &cfg, &storage.Registry{Logger: logger})
+	q.jobs = make(chan string, 1)
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		session := &model.UploadSession{ID: id, UserID: 1, Filename: id, Status: db.UploadStatusFinalizing, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := store.Upload.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !q.Enqueue("a") {
+		t.Fatal("队列未满时应入队成功")
+	}
+	if !q.Enqueue("a") || len(q.jobs) != 1 {
+		t.Fatalf("已在队列中的会话不应重复入队: %d", len(q.jobs))
+	}
+	done := make(chan bool)
+	go func() { done <- q.Enqueue("b") }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("队列已满时应返回 false")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("队列已满时 Enqueue 不应阻塞")
+	}
+	if _, ok := q.State("b"); ok {
+		t.Fatal("未能入队的会话不应保留进度")
+	}
+
+	// 队列腾出空间后，定期扫描补回未入队的会话，且不会重复排队仍在处理中的会话
+	<-q.jobs
+	q.requeue(ctx)
+	if len(q.jobs) != 1 || <-q.jobs != "b" {
+		t.Fatal("重新扫描应将未入队的会话加入队列")
+	}
+}
+
+// brokenStorage 写入总是失败，模拟存储后端临时故障。
+type brokenStorage struct{}
+
+func (brokenStorage) Platform() storage.BucketPlatform { return storage.PlatformS3 }
+func (brokenStorage) Bucket() string                   { return "broken" }
+func (brokenStorage) Write(string, io.Reader, int64, string) (string, error) {
+	return "", errors.New("connection reset")
+}
+func (brokenStorage) GetURL(string, time.Duration) (string, error) {
+	return "", storage.ErrURLUnsupported
+}
+func (brokenStorage) Open(string, int64, int64) (io.ReadCloser, error) {
+	return nil, storage.ErrObjectNotFound
+}
+func (brokenStorage) Stat(string) (storage.ObjectInfo, error) {
+	return storage.ObjectInfo{}, storage.ErrObjectNotFound
+}
+func (brokenStorage) Delete(string) error { return nil }
+
+func TestFinalizeQueueRetriesTransientErrors(t *testing.T) {
+	store, cfg, _, admin := newTestEnv(t, nil)
+	reg := &storage.Registry{DefaultDriver: "broken", Storages: map[string]storage.Storage{"broken": brokenStorage{}}, Logger: store.Logger}
+	q := NewFinalizeQueue(store, cfg, reg)
+	ctx := context.Background()
+
+	newSession := func(id, fileHash string) string {
+		data := []byte("finalize " + id)
+		chunkDir := filepath.Join(cfg.ChunkDir, id)
+		if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(chunkDir, "0"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		session := &model.UploadSession{ID: id, UserID: admin.ID, Filename: id + ".txt", FileSize: int64(len(data)), ChunkSize: int64(len(data)), TotalChunks: 1,
+			FileHash: fileHash, Status: db.UploadStatusFinalizing, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := store.Upload.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		return chunkDir
+	}
+	load := func(id string) *model.UploadSession {
+		session, err := store.Upload.Get(ctx, id)
+		if err != nil || session == nil {
+			t.Fatalf("读取会话失败: %v", err)
+		}
+		return session
+	}
+
+	// 存储故障时保留分片并计入重试次数，达到上限后才标记失败
+	chunkDir := newSession("transient", "")
+	for attempt := 1; attempt < finalizeMaxAttempts; attempt++ {
+		q.process(ctx, "transient")
+		session := load("transient")
+		if session.Status != db.UploadStatusFinalizing || session.Attempts != attempt {
+			t.Fatalf("第 %d 次失败后会话应保持 finalizing: %s attempts=%d", attempt, session.Status, session.Attempts)
+		}
+		if _, err := os.Stat(chunkDir); err != nil {
+			t.Fatal("临时故障后应保留分片以便重试")
+		}
+	}
+	q.process(ctx, "transient")
+	if session := load("transient"); session.Status != db.UploadStatusFailed {
+		t.Fatalf("重试次数用尽后应标记失败: %s", session.Status)
+	}
+	if _, err := os.Stat(chunkDir); !os.IsNotExist(err) {
+		t.Fatal("标记失败后应删除分片")
+	}
+
+	// 校验失败属于客户端错误，不再重试
+	chunkDir = newSession("checksum", strings.Repeat("0", 64))
+	q.process(ctx, "checksum")
+	if session := load("checksum"); session.Status != db.UploadStatusFailed || session.Attempts != 0 {
+		t.Fatalf("校验失败应直接标记失败: %s attempts=%d", session.Status, session.Attempts)
+	}
+	if _, err := os.Stat(chunkDir); !os.IsNotExist(err) {
+		t.Fatal("标记失败后应删除分片")
+	}
+}
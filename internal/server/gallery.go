@@ -93,23 +93,27 @@ func GalleryDeleteHandler(store *db.DB, reg *storage.Registry) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, Fail[any]("资源不存在", 500))
 			return
 		}
-		stg, err := reg.ByStoredPath(resource.Path)
-		if err != nil {
-			reg.Logger.Error("存储路径无效", "err", err, "path", resource.Path)
-		}
-		if stg != nil {
-			if err := stg.Delete(resource.Path); err != nil {
-				reg.Logger.Error("删除存储文件失败", "err", err, "path", resource.Path)
-				c.JSON(http.StatusInternalServerError, Fail[any]("删除资源失败", 500))
-				return
-			}
-		}
-		_, err = store.Resource.DeleteWithShare(ctx, resource.ID, user.ID)
+		// 与上传复用同一把 hash 锁：删除最后一个引用与删除存储对象之间不允许新资源复用该对象
+		unlock := store.Resource.LockHash(resource.Hash)
+		defer unlock()
+		_, lastRef, err := store.Resource.DeleteWithShare(ctx, resource.ID, user.ID)
 		if err != nil {
 			reg.Logger.Error("删除数据失败", "err", err, "resource", resource)
 			c.JSON(http.StatusInternalServerError, Fail[any]("删除资源失败", 500))
 			return
 		}
+		// 存储对象按内容去重共享，仅在最后一个引用被删除时才移除文件。
+		if lastRef {
+			stg, err := reg.ByStoredPath(resource.Path)
+			if err != nil {
+				reg.Logger.Error("存储路径无效", "err", err, "path", resource.Path)
+			}
+			if stg != nil {
+				if err := stg.Delete(resource.Path); err != nil {
+					reg.Logger.Error("删除存储文件失败", "err", err, "path", resource.Path)
+				}
+			}
+		}
 		if err := store.Resource.ClearUserPickIfMatch(ctx, user.ID, resource.ID); err != nil {
 			store.Logger.Warn("清理 pick 记录失败", "user", user.Username, "resource_id", resource.ID, "error", err)
 		}
@@ -179,6 +183,9 @@ func GalleryPickHandler(store *db.DB, reg *storage.Registry) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, Fail[any]("资源路径无效", 500))
 			return
 		}
+		if err := store.Resource.TouchAccess(ctx, resource.Path); err != nil {
+			reg.Logger.Error("更新资源访问时间失败", "err", err, "resource_id", resource.ID)
+		}
 		reg.Logger.Debug("下载资源", "user_id", user.ID, "resource_id", resource.ID, "mode", mode, "file", resource.Filename, "storage", storageDriver.Platform())
 
 		if storageDriver.Platform() != storage.PlatformLocal {
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+)
+
+// userQuota 用户配额与当前用量，配额为 0 表示不限制。
+type userQuota struct {
+	QuotaBytes int64 `json:"quotaBytes"`
+	QuotaFiles int64 `json:"quotaFiles"`
+	UsedBytes  int64 `json:"usedBytes"`
+	UsedFiles  int64 `json:"usedFiles"`
+}
+
+type adminUserItem struct {
+	userPayload
+	Quota     userQuota `json:"quota"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type adminUpdateQuotaRequest struct {
+	QuotaBytes int64 `json:"quotaBytes"`
+	QuotaFiles int64 `json:"quotaFiles"`
+}
+
+func loadUserQuota(ctx context.Context, store *db.DB, user *model.User) (userQuota, error) {
+	files, bytes, err := store.Resource.GetUsageByUser(ctx, user.ID)
+	if err != nil {
+		return userQuota{}, err
+	}
+	return userQuota{QuotaBytes: user.QuotaBytes, QuotaFiles: user.QuotaFiles, UsedBytes: bytes, UsedFiles: files}, nil
+}
+
+// checkUploadQuota 校验再上传一个 fileSize 大小的文件是否超出用户配额，不通过时直接写入错误响应。
+func checkUploadQuota(c *gin.Context, store *db.DB, user *model.User, fileSize int64) bool {
+	if err := uploadQuotaError(c.Request.Context(), store, user, fileSize); err != nil {
+		writeUploadError(c, err)
+		return false
+	}
+	return true
+}
+
+func uploadQuotaError(ctx context.Context, store *db.DB, user *model.User, fileSize int64) error {
+	ctx, cancel := store.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	// 访客使用的是占位用户，需从数据库读取配额
+	owner, err := store.User.GetByID(ctx, user.ID)
+	if err != nil {
+		return &uploadError{Status: http.StatusInternalServerError, Msg: "读取用户配额失败"}
+	}
+	if owner == nil || (owner.QuotaBytes <= 0 && owner.QuotaFiles <= 0) {
+		return nil
+	}
+	quota, err := loadUserQuota(ctx, store, owner)
+	if err != nil {
+		return &uploadError{Status: http.StatusInternalServerError, Msg: "读取用户配额失败"}
+	}
+	if quota.QuotaFiles > 0 && quota.UsedFiles+1 > quota.QuotaFiles {
+		return &uploadError{Status: http.StatusForbidden, Msg: "文件数量已达上限"}
+	}
+	if quota.QuotaBytes > 0 && quota.UsedBytes+fileSize > quota.QuotaBytes {
+		return &uploadError{Status: http.StatusForbidden, Msg: "存储空间不足"}
+	}
+	return nil
+}
+
+func AdminUsersHandler(store *db.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		users, err := store.User.List(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取用户失败", 500))
+			return
+		}
+		items := make([]adminUserItem, 0, len(users))
+		for i := range users {
+			user := &users[i]
+			quota, err := loadUserQuota(ctx, store, user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Fail[any]("读取用户配额失败", 500))
+				return
+			}
+			items = append(items, adminUserItem{
+				userPayload: userPayload{ID: user.ID, Username: user.Username, Nickname: user.Nickname, Email: user.Email},
+				Quota:       quota,
+				CreatedAt:   user.CreatedAt,
+			})
+		}
+		c.JSON(http.StatusOK, Ok(gin.H{"items": items}, "ok"))
+	}
+}
+
+// AdminUpdateUserQuotaHandler 修改用户配额，已超出新配额的用户不受影响，仅限制之后的上传。
+func AdminUpdateUserQuotaHandler(store *db.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil || userID <= 0 {
+			c.JSON(http.StatusBadRequest, Fail[any]("用户 ID 无效", 400))
+			return
+		}
+		var req adminUpdateQuotaRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("参数错误", 400))
+			return
+		}
+		if req.QuotaBytes < 0 || req.QuotaFiles < 0 {
+			c.JSON(http.StatusBadRequest, Fail[any]("配额不能为负数", 400))
+			return
+		}
+
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		found, err := store.User.UpdateQuota(ctx, userID, req.QuotaBytes, req.QuotaFiles)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("保存配额失败", 500))
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, Fail[any]("用户不存在", 404))
+			return
+		}
+		store.Logger.Info("更新用户配额", "user_id", userID, "bytes", req.QuotaBytes, "files", req.QuotaFiles)
+		c.JSON(http.StatusOK, Ok(gin.H{"success": true}, "保存成功"))
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"linkit/internal/storage"
+)
+
+// barrierStorage 等所有上传都到达写入阶段后才继续，确保它们都已通过入库前的首次配额校验。
+type barrierStorage struct {
+	storage.Storage
+	arrived sync.WaitGroup
+}
+
+func (b *barrierStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	b.arrived.Done()
+	b.arrived.Wait()
+	return b.Storage.Write(objectKey, r, size, contentType)
+}
+
+func TestConcurrentUploadsRespectFileQuota(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, nil)
+	ctx := context.Background()
+	const quotaFiles, uploads = 2, 6
+	barrier := &barrierStorage{Storage: reg.Storages[reg.DefaultDriver]}
+	barrier.arrived.Add(uploads)
+	reg.Storages[reg.DefaultDriver] = barrier
+	if _, err := store.User.UpdateQuota(ctx, admin.ID, 0, quotaFiles); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(cfg.MergeDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, uploads)
+	for i := 0; i < uploads; i++ {
+		path := filepath.Join(cfg.MergeDir, fmt.Sprintf("quota-%d.txt", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("quota content %d", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			_, errs[i] = finalizeMergedFile(ctx, store, cfg, reg, admin, path, mergedUpload{Filename: filepath.Base(path)})
+		}(i, path)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		var ue *uploadError
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.As(err, &ue) && ue.Status == http.StatusForbidden:
+		default:
+			t.Fatalf("超出配额应返回 403: %v", err)
+		}
+	}
+	files, _, err := store.Resource.GetUsageByUser(ctx, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if succeeded != quotaFiles || files != quotaFiles {
+		t.Fatalf("并发上传超出文件数配额: 成功 %d，入库 %d，配额 %d", succeeded, files, quotaFiles)
+	}
+	// 未能入库的上传不应在存储中留下对象
+	objects := 0
+	_ = filepath.WalkDir(cfg.LocalRoot, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			objects++
+		}
+		return nil
+	})
+	if objects != quotaFiles {
+		t.Fatalf("存储中对象数 = %d，期望 %d", objects, quotaFiles)
+	}
+}
@@ -71,6 +71,9 @@ func DownloadHandler(store *db.DB, reg *storage.Registry) gin.HandlerFunc {
 		if err := store.Share.IncrementShareViewCount(ctx, record.ShareID); err != nil {
 			reg.Logger.Error("更新短链访问次数失败", "err", err, "code", code)
 		}
+		if err := store.Resource.TouchAccess(ctx, record.Path); err != nil {
+			reg.Logger.Error("更新资源访问时间失败", "err", err, "code", code)
+		}
 
 		storageDriver, err := reg.ByStoredPath(record.Path)
 		if err != nil {
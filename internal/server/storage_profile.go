@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+type adminStorageProfileItem struct {
+	storage.Profile
+	Resources int64     `json:"resources"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// LoadStorageProfiles 从数据库读取命名存储配置。
+func LoadStorageProfiles(ctx context.Context, store *db.DB) ([]storage.Profile, error) {
+	rows, err := store.Storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]storage.Profile, 0, len(rows))
+	for _, row := range rows {
+		p, err := profileFromModel(row)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+func profileFromModel(row model.StorageProfile) (storage.Profile, error) {
+	p := storage.Profile{Name: row.Name, Driver: row.Driver, Options: map[string]string{}}
+	if strings.TrimSpace(row.Options) != "" {
+		if err := json.Unmarshal([]byte(row.Options), &p.Options); err != nil {
+			return p, fmt.Errorf("存储配置 %s 解析失败: %w", row.Name, err)
+		}
+	}
+	return p, nil
+}
+
+func AdminStorageProfilesHandler(store *db.DB, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := store.Storage.List(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取存储配置失败", 500))
+			return
+		}
+		active := reg.ActiveProfile()
+		items := make([]adminStorageProfileItem, 0, len(rows))
+		for _, row := range rows {
+			p, err := profileFromModel(row)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Fail[any](err.Error(), 500))
+				return
+			}
+			refs, err := store.Resource.CountByPathPrefix(ctx, p.PathPrefix())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Fail[any]("读取存储配置失败", 500))
+				return
+			}
+			items = append(items, adminStorageProfileItem{
+				Profile:   p,
+				Resources: refs,
+				Active:    p.Name == active,
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+			})
+		}
+		c.JSON(http.StatusOK, Ok(gin.H{"items": items, "active": active}, "ok"))
+	}
+}
+
+// AdminUpsertStorageProfileHandler 新增或更新命名存储配置，校验通过后立即热更新。
+func AdminUpsertStorageProfileHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req storage.Profile
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("参数错误", 400))
+			return
+		}
+		req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+		req.Driver = storage.CanonicalProfile(req.Driver)
+		options := make(map[string]string, len(req.Options))
+		for key, value := range req.Options {
+			options[strings.ToUpper(strings.TrimSpace(key))] = value
+		}
+		req.Options = options
+		if err := storage.ValidateProfile(req); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
+			return
+		}
+		next, err := storage.BuildProfile(cfg.Clone(), req, reg.Logger)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("存储配置无效: "+err.Error(), 400))
+			return
+		}
+
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 8*time.Second)
+		defer cancel()
+
+		profiles, err := LoadStorageProfiles(ctx, store)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取存储配置失败", 500))
+			return
+		}
+		replaced := false
+		for i, p := range profiles {
+			if p.Name != req.Name {
+				continue
+			}
+			// 已被资源引用的配置不能改动驱动或桶，否则旧路径将无法解析。
+			refs, err := store.Resource.CountByPathPrefix(ctx, p.PathPrefix())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Fail[any]("读取存储配置失败", 500))
+				return
+			}
+			if refs > 0 {
+				prev, ok := reg.Get(p.Name)
+				if !ok || prev.Platform() != next.Platform() || prev.Bucket() != next.Bucket() {
+					c.JSON(http.StatusBadRequest, Fail[any](fmt.Sprintf("存储配置已被 %d 个资源引用，不能修改驱动或存储桶", refs), 400))
+					return
+				}
+			}
+			profiles[i] = req
+			replaced = true
+		}
+		if !replaced {
+			profiles = append(profiles, req)
+		}
+		if err := reg.ValidateProfiles(cfg.Clone(), profiles); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("存储配置无效: "+err.Error(), 400))
+			return
+		}
+
+		raw, _ := json.Marshal(req.Options)
+		if err := store.Storage.Upsert(ctx, req.Name, req.Driver, string(raw)); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("保存存储配置失败", 500))
+			return
+		}
+		if err := reg.ReloadProfiles(cfg.Clone(), profiles); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("保存成功但热更新失败，请检查配置后重试", 500))
+			return
+		}
+		reg.Logger.Info("保存存储配置", "name", req.Name, "driver", req.Driver)
+		c.JSON(http.StatusOK, Ok(gin.H{"success": true}, "保存成功"))
+	}
+}
+
+// AdminDeleteStorageProfileHandler 删除未被引用且非默认的命名存储配置。
+func AdminDeleteStorageProfileHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.ToLower(strings.TrimSpace(c.Param("name")))
+		if name == reg.ActiveProfile() {
+			c.JSON(http.StatusBadRequest, Fail[any]("默认存储配置不能删除", 400))
+			return
+		}
+
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 8*time.Second)
+		defer cancel()
+
+		profiles, err := LoadStorageProfiles(ctx, store)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取存储配置失败", 500))
+			return
+		}
+		remaining := make([]storage.Profile, 0, len(profiles))
+		var target *storage.Profile
+		for i, p := range profiles {
+			if p.Name == name {
+				target = &profiles[i]
+				continue
+			}
+			remaining = append(remaining, p)
+		}
+		if target == nil {
+			c.JSON(http.StatusNotFound, Fail[any]("存储配置不存在", 404))
+			return
+		}
+		refs, err := store.Resource.CountByPathPrefix(ctx, target.PathPrefix())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取存储配置失败", 500))
+			return
+		}
+		if refs > 0 {
+			c.JSON(http.StatusBadRequest, Fail[any](fmt.Sprintf("存储配置仍被 %d 个资源引用，请先迁移", refs), 400))
+			return
+		}
+		// 仍被路由规则引用时拒绝删除
+		if err := reg.ValidateProfiles(cfg.Clone(), remaining); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("删除后存储配置无效: "+err.Error(), 400))
+			return
+		}
+		if _, err := store.Storage.Delete(ctx, name); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("删除存储配置失败", 500))
+			return
+		}
+		if err := reg.ReloadProfiles(cfg.Clone(), remaining); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("删除成功但热更新失败，请检查配置后重试", 500))
+			return
+		}
+		reg.Logger.Info("删除存储配置", "name", name)
+		c.JSON(http.StatusOK, Ok(gin.H{"success": true}, "删除成功"))
+	}
+}
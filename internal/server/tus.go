@@ -0,0 +1,447 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+	"linkit/internal/utli"
+)
+
+// tus 1.0 断点续传协议，支持 creation、termination 扩展，
+// 上传数据保存在 ChunkDir/tus-<id>/ 下，写满后以同名上传会话交给后台合并队列入库。
+const (
+	tusDirPrefix   = "tus-"
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination"
+	tusContentType = "application/offset+octet-stream"
+	tusInfoFile    = "info.json"
+	tusDataFile    = "data"
+)
+
+var tusIDRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// tusInfo 上传任务元数据，Result 不为空表示已完成入库。
+type tusInfo struct {
+	ID       string          `json:"id"`
+	UserID   int64           `json:"userId"`
+	Length   int64           `json:"length"`
+	Filename string          `json:"filename"`
+	Tags     []string        `json:"tags"`
+	PickIt   bool            `json:"pickIt"`
+	Result   *uploadResponse `json:"result,omitempty"`
+}
+
+// TusUploads 记录正在写入的 tus 任务，同一任务同一时间只允许一个请求写入。
+type TusUploads struct {
+	mu     sync.Mutex
+	active map[string]struct{}
+}
+
+func NewTusUploads() *TusUploads {
+	return &TusUploads{active: make(map[string]struct{})}
+}
+
+func (t *TusUploads) acquire(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, busy := t.active[id]; busy {
+		return false
+	}
+	t.active[id] = struct{}{}
+	return true
+}
+
+func (t *TusUploads) release(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.active, id)
+}
+
+// TusOptionsHandler 返回服务端支持的协议版本与扩展。
+func TusOptionsHandler(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		c.Header("Tus-Version", tusVersion)
+		c.Header("Tus-Extension", tusExtensions)
+		c.Header("Tus-Max-Size", strconv.FormatInt(cfg.MaxFileSize, 10))
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// TusCreateHandler 创建上传任务（creation 扩展），按声明的大小预先校验白名单与配额。
+func TusCreateHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkTusResumable(c) {
+			return
+		}
+		user := uploadUser(c)
+		if c.GetHeader("Upload-Defer-Length") != "" {
+			c.JSON(http.StatusBadRequest, Fail[any]("不支持延迟声明文件大小", 400))
+			return
+		}
+		length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+		if err != nil || length < 0 {
+			c.JSON(http.StatusBadRequest, Fail[any]("Upload-Length 无效", 400))
+			return
+		}
+		if length > cfg.MaxFileSize {
+			c.JSON(http.StatusRequestEntityTooLarge, Fail[any]("文件大小超过限制", 413))
+			return
+		}
+		meta := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+		// Uppy 等客户端使用 filename 或 name 传递文件名
+		fileName := filepath.Base(utli.FirstValue([]string{meta["filename"]}, meta["name"]))
+		if fileName == "" || fileName == "." || fileName == "/" {
+			c.JSON(http.StatusBadRequest, Fail[any]("缺少文件名", 400))
+			return
+		}
+		tags, err := db.ParseTagsFromStrings([]string{meta["tags"]})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
+			return
+		}
+		if !checkUploadAllowed(c, cfg, user, fileName, length) {
+			return
+		}
+		if !checkUploadQuota(c, store, user, length) {
+			return
+		}
+
+		id, err := randomHex(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("创建上传任务失败", 500))
+			return
+		}
+		info := tusInfo{ID: id, UserID: user.ID, Length: length, Filename: fileName, Tags: tags, PickIt: utli.ParseOptionalBool(meta["pickIt"])}
+		dir := tusDir(cfg, id)
+		if err := ensureDir(dir); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("准备目录失败", 500))
+			return
+		}
+		if err := os.WriteFile(filepath.Join(dir, tusDataFile), nil, 0o644); err != nil {
+			_ = os.RemoveAll(dir)
+			c.JSON(http.StatusInternalServerError, Fail[any]("创建上传任务失败", 500))
+			return
+		}
+		if err := saveTusInfo(dir, info); err != nil {
+			_ = os.RemoveAll(dir)
+			c.JSON(http.StatusInternalServerError, Fail[any]("创建上传任务失败", 500))
+			return
+		}
+		reg.Logger.Info("创建 tus 上传", "user", user.Username, "file", fileName, "size", length, "id", id)
+		c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+id)
+		c.Status(http.StatusCreated)
+	}
+}
+
+// TusHeadHandler 查询已上传的偏移量，客户端据此续传；后台入库完成后通过响应头返回结果。
+func TusHeadHandler(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkTusResumable(c) {
+			return
+		}
+		info, dir, ok := loadTusUpload(c, cfg)
+		if !ok {
+			return
+		}
+		offset := info.Length
+		if info.Result == nil {
+			stat, err := os.Stat(filepath.Join(dir, tusDataFile))
+			if err != nil {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			offset = stat.Size()
+		}
+		setTusResultHeaders(c, info)
+		c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+		c.Header("Upload-Length", strconv.FormatInt(info.Length, 10))
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+	}
+}
+
+// TusPatchHandler 从 Upload-Offset 处追加数据，写满后加入后台合并队列。
+// 传输中断时已写入的数据保留，客户端可通过 HEAD 查询偏移量后续传。
+func TusPatchHandler(store *db.DB, cfg *config.Config, reg *storage.Registry, uploads *TusUploads, queue *FinalizeQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkTusResumable(c) {
+			return
+		}
+		if c.ContentType() != tusContentType {
+			c.JSON(http.StatusUnsupportedMediaType, Fail[any]("Content-Type 需为 "+tusContentType, 415))
+			return
+		}
+		offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, Fail[any]("Upload-Offset 无效", 400))
+			return
+		}
+		info, dir, ok := loadTusUpload(c, cfg)
+		if !ok {
+			return
+		}
+		if !uploads.acquire(info.ID) {
+			c.JSON(http.StatusLocked, Fail[any]("上传任务正在写入", 423))
+			return
+		}
+		defer uploads.release(info.ID)
+		if info.Result != nil {
+			c.JSON(http.StatusForbidden, Fail[any]("上传已完成", 403))
+			return
+		}
+
+		dataPath := filepath.Join(dir, tusDataFile)
+		f, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			c.JSON(http.StatusNotFound, Fail[any]("上传任务不存在", 404))
+			return
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取上传任务失败", 500))
+			return
+		}
+		if stat.Size() != offset {
+			f.Close()
+			c.Header("Upload-Offset", strconv.FormatInt(stat.Size(), 10))
+			c.JSON(http.StatusConflict, Fail[any]("Upload-Offset 与已上传大小不一致", 409))
+			return
+		}
+		remaining := info.Length - offset
+		written, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, remaining+1))
+		if written > remaining {
+			_ = f.Truncate(info.Length)
+			written = remaining
+			copyErr = errors.New("数据超出声明的文件大小")
+		}
+		f.Close()
+		newOffset := offset + written
+		// 刷新元数据修改时间，避免进行中的上传被临时目录清理误删
+		_ = saveTusInfo(dir, info)
+		c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+		if copyErr != nil {
+			reg.Logger.Warn("tus 上传数据中断", "id", info.ID, "offset", newOffset, "err", copyErr)
+			c.JSON(http.StatusBadRequest, Fail[any]("上传数据中断: "+copyErr.Error(), 400))
+			return
+		}
+
+		user := uploadUser(c)
+		// 文件头到达后尽早校验访客上传的内容类型，与分片上传的首个分片一致
+		if user.ID == db.GuestUserID && offset < storage.SniffLen && (newOffset >= storage.SniffLen || newOffset == info.Length) {
+			head, err := readFileHead(dataPath)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Fail[any]("读取文件失败", 500))
+				return
+			}
+			if _, ok := detectUploadType(c, user, info.Filename, head); !ok {
+				_ = os.RemoveAll(dir)
+				return
+			}
+		}
+		if newOffset < info.Length {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		// 重复的 PATCH 不会重复创建会话，仅在任务不在队列中时重新入队
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		sessionID := tusSessionID(info.ID)
+		session, err := store.Upload.Get(ctx, sessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取上传任务失败", 500))
+			return
+		}
+		if session == nil {
+			session = &model.UploadSession{
+				ID:          sessionID,
+				UserID:      user.ID,
+				Filename:    info.Filename,
+				FileSize:    info.Length,
+				ChunkSize:   info.Length,
+				TotalChunks: 1,
+				Tags:        strings.Join(info.Tags, ","),
+				PickIt:      info.PickIt,
+				Status:      db.UploadStatusFinalizing,
+				ExpiresAt:   time.Now().Add(cfg.UploadSessionTTL),
+			}
+			if err := store.Upload.Create(ctx, session); err != nil {
+				c.JSON(http.StatusInternalServerError, Fail[any]("创建合并任务失败", 500))
+				return
+			}
+		}
+		if session.Status == db.UploadStatusFailed {
+			c.JSON(http.StatusConflict, Fail[any]("上传失败："+session.Error, 409))
+			return
+		}
+		if session.Status == db.UploadStatusFinalizing && !queue.Enqueue(sessionID) {
+			reg.Logger.Warn("合并队列已满，等待重新排队", "upload_id", sessionID)
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// finalizeTusUpload 由后台合并队列调用，将写满的数据文件入库并保存结果供 HEAD 查询。
+// 失败时保留数据文件，由队列决定重试或删除整个上传目录。
+func finalizeTusUpload(ctx context.Context, store *db.DB, cfg *config.Config, reg *storage.Registry, user *model.User, session *model.UploadSession, tags []string, progress finalizeProgress) (uploadResponse, error) {
+	dir := filepath.Join(cfg.ChunkDir, session.ID)
+	info, err := readTusInfo(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return uploadResponse{}, &uploadError{Status: http.StatusNotFound, Msg: "上传任务不存在"}
+		}
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "读取上传任务失败"}
+	}
+	if info.Result != nil {
+		return *info.Result, nil
+	}
+	dataPath := filepath.Join(dir, tusDataFile)
+	resp, err := finalizeMergedFile(ctx, store, cfg, reg, user, dataPath, mergedUpload{UploadID: info.ID, Filename: info.Filename, Tags: tags, PickIt: info.PickIt, Progress: progress})
+	if err != nil {
+		return uploadResponse{}, err
+	}
+	// 保留元数据以便客户端 HEAD 时拿到结果
+	_ = os.Remove(dataPath)
+	info.Result = &resp
+	if err := saveTusInfo(dir, info); err != nil {
+		reg.Logger.Warn("保存 tus 上传结果失败", "id", info.ID, "err", err)
+	}
+	return resp, nil
+}
+
+// TusDeleteHandler 终止上传并删除已上传的数据（termination 扩展），后台合并中的任务不能删除。
+func TusDeleteHandler(store *db.DB, cfg *config.Config, uploads *TusUploads) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkTusResumable(c) {
+			return
+		}
+		info, dir, ok := loadTusUpload(c, cfg)
+		if !ok {
+			return
+		}
+		if !uploads.acquire(info.ID) {
+			c.JSON(http.StatusLocked, Fail[any]("上传任务正在写入", 423))
+			return
+		}
+		defer uploads.release(info.ID)
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		session, err := store.Upload.Get(ctx, tusSessionID(info.ID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取上传任务失败", 500))
+			return
+		}
+		if session != nil && session.Status == db.UploadStatusFinalizing {
+			c.JSON(http.StatusLocked, Fail[any]("上传任务正在合并", 423))
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("删除上传任务失败", 500))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// checkTusResumable 校验客户端协议版本，并为除 OPTIONS 外的所有响应带上 Tus-Resumable。
+func checkTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") == tusVersion {
+		return true
+	}
+	c.Header("Tus-Version", tusVersion)
+	c.JSON(http.StatusPreconditionFailed, Fail[any]("不支持的 tus 协议版本", 412))
+	return false
+}
+
+// loadTusUpload 读取路径中的上传任务，仅创建者可以访问；失败时已写入错误响应。
+func loadTusUpload(c *gin.Context, cfg *config.Config) (tusInfo, string, bool) {
+	id := c.Param("id")
+	if !tusIDRegex.MatchString(id) {
+		c.JSON(http.StatusNotFound, Fail[any]("上传任务不存在", 404))
+		return tusInfo{}, "", false
+	}
+	dir := tusDir(cfg, id)
+	info, err := readTusInfo(dir)
+	if err != nil || info.UserID != uploadUser(c).ID {
+		c.JSON(http.StatusNotFound, Fail[any]("上传任务不存在", 404))
+		return tusInfo{}, "", false
+	}
+	return info, dir, true
+}
+
+func tusDir(cfg *config.Config, id string) string {
+	return filepath.Join(cfg.ChunkDir, tusSessionID(id))
+}
+
+// tusSessionID 返回 tus 上传在后台合并队列中的会话 ID，与数据目录名一致。
+func tusSessionID(id string) string {
+	return tusDirPrefix + id
+}
+
+func readTusInfo(dir string) (tusInfo, error) {
+	var info tusInfo
+	raw, err := os.ReadFile(filepath.Join(dir, tusInfoFile))
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(raw, &info)
+	return info, err
+}
+
+func saveTusInfo(dir string, info tusInfo) error {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, tusInfoFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, tusInfoFile))
+}
+
+// setTusResultHeaders 上传完成后通过响应头返回分享码与资源 ID。
+func setTusResultHeaders(c *gin.Context, info tusInfo) {
+	if info.Result == nil {
+		return
+	}
+	c.Header("Linkit-Share-Code", info.Result.ShareCode)
+	c.Header("Linkit-Resource-Id", strconv.FormatInt(info.Result.ResourceID, 10))
+}
+
+// parseTusMetadata 解析 Upload-Metadata：逗号分隔的 "key base64(value)"，value 可省略。
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			continue
+		}
+		meta[key] = string(value)
+	}
+	return meta
+}
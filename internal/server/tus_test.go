@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/db"
+	"linkit/internal/storage"
+)
+
+func TestTusUploadFinalizesInQueue(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, nil)
+	queue := NewFinalizeQueue(store, cfg, reg)
+	uploads := NewTusUploads()
+	r := gin.New()
+	asAdmin := func(c *gin.Context) { c.Set("user", admin) }
+	r.POST("/tus", asAdmin, TusCreateHandler(store, cfg, reg))
+	r.HEAD("/tus/:id", asAdmin, TusHeadHandler(cfg))
+	r.PATCH("/tus/:id", asAdmin, TusPatchHandler(store, cfg, reg, uploads, queue))
+	r.DELETE("/tus/:id", asAdmin, TusDeleteHandler(store, cfg, uploads))
+	serve := func(method, target string, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", tusVersion)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	data := "tus upload content"
+	w := serve(http.MethodPost, "/tus", "", map[string]string{
+		"Upload-Length":   strconv.Itoa(len(data)),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("tus.txt")),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建上传失败: %d %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	id := filepath.Base(location)
+	sessionID := tusSessionID(id)
+
+	w = serve(http.MethodPatch, location, data, map[string]string{"Content-Type": tusContentType, "Upload-Offset": "0"})
+	if w.Code != http.StatusNoContent || w.Header().Get("Linkit-Share-Code") != "" {
+		t.Fatalf("写满后应交给后台入库: %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := queue.State(sessionID); !ok {
+		t.Fatal("写满后应加入合并队列")
+	}
+	if w := serve(http.MethodDelete, location, "", nil); w.Code != http.StatusLocked {
+		t.Fatalf("合并中的上传不能终止: %d", w.Code)
+	}
+
+	// 存储临时故障时保留数据，会话保持 finalizing 等待重试
+	broken := &storage.Registry{DefaultDriver: "broken", Storages: map[string]storage.Storage{"broken": brokenStorage{}}, Logger: store.Logger}
+	NewFinalizeQueue(store, cfg, broken).process(context.Background(), sessionID)
+	session, err := store.Upload.Get(context.Background(), sessionID)
+	if err != nil || session == nil || session.Status != db.UploadStatusFinalizing || session.Attempts != 1 {
+		t.Fatalf("临时故障后会话应等待重试: %+v %v", session, err)
+	}
+	if _, err := os.Stat(filepath.Join(tusDir(cfg, id), tusDataFile)); err != nil {
+		t.Fatal("临时故障后应保留上传数据")
+	}
+	w = serve(http.MethodHead, location, "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(len(data)) || w.Header().Get("Linkit-Share-Code") != "" {
+		t.Fatalf("合并完成前 HEAD 不应返回结果: %d %v", w.Code, w.Header())
+	}
+
+	queue.process(context.Background(), sessionID)
+	session, _ = store.Upload.Get(context.Background(), sessionID)
+	if session == nil || session.Status != db.UploadStatusDone || session.ShareCode == "" {
+		t.Fatalf("重试后应完成入库: %+v", session)
+	}
+	w = serve(http.MethodHead, location, "", nil)
+	if w.Header().Get("Linkit-Share-Code") != session.ShareCode || w.Header().Get("Linkit-Resource-Id") != strconv.FormatInt(session.ResourceID, 10) {
+		t.Fatalf("完成后 HEAD 应返回分享码与资源 ID: %v", w.Header())
+	}
+	if w := serve(http.MethodPatch, location, "", map[string]string{"Content-Type": tusContentType, "Upload-Offset": strconv.Itoa(len(data))}); w.Code != http.StatusForbidden {
+		t.Fatalf("已完成的上传不能继续写入: %d", w.Code)
+	}
+}
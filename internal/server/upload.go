@@ -2,8 +2,10 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -28,6 +30,33 @@ const (
 	uploadField = "file"
 )
 
+// uploadError 单个文件上传失败的原因与对应的 HTTP 状态码。
+type uploadError struct {
+	Status int
+	Msg    string
+	// Retryable 表示客户端重新上传即可恢复，如校验失败
+	Retryable bool
+}
+
+func (e *uploadError) Error() string {
+	return e.Msg
+}
+
+var errStoreFailed = &uploadError{Status: http.StatusInternalServerError, Msg: "存储失败"}
+
+// writeUploadError 将上传错误写入响应，非 uploadError 按存储失败处理。
+func writeUploadError(c *gin.Context, err error) {
+	var ue *uploadError
+	if !errors.As(err, &ue) {
+		ue = errStoreFailed
+	}
+	if ue.Retryable {
+		c.JSON(ue.Status, ApiResponse[gin.H]{Msg: ue.Msg, Data: gin.H{"retryable": true}, Code: ue.Status})
+		return
+	}
+	c.JSON(ue.Status, Fail[any](ue.Msg, ue.Status))
+}
+
 type uploadResponse struct {
 	Merged      bool   `json:"merged"`
 	UploadID    string `json:"uploadId"`
@@ -39,45 +68,37 @@ type uploadResponse struct {
 	ChunkSize   *int64 `json:"chunkSize,omitempty"`
 	ShareCode   string `json:"shareCode,omitempty"`
 	ResourceID  int64  `json:"resourceId,omitempty"`
+	// Finalizing 分片已全部到齐、正在后台合并入库，结果通过 /api/upload/:id/status 查询
+	Finalizing bool `json:"finalizing,omitempty"`
 }
 
-func UploadQueryHandler(cfg *config.Config) gin.HandlerFunc {
+// UploadQueryHandler 查询上传会话中已保存的分片与合并进度，仅会话创建者可以查询。
+func UploadQueryHandler(store *db.DB, cfg *config.Config, queue *FinalizeQueue) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		uploadID := c.Query("uploadId")
 		if uploadID == "" {
 			c.JSON(http.StatusBadRequest, Fail[any]("缺少 uploadId", 400))
 			return
 		}
-		if err := ensureDir(cfg.ChunkDir); err != nil {
-			c.JSON(http.StatusInternalServerError, Fail[any]("准备目录失败", 500))
+		session, ok := loadUploadSession(c, store, uploadID)
+		if !ok {
 			return
 		}
-		cleanupChunks(cfg)
-		chunkFolder := filepath.Join(cfg.ChunkDir, uploadID)
-		entries, err := os.ReadDir(chunkFolder)
-		if err != nil {
-			c.JSON(http.StatusOK, Ok(gin.H{"uploaded": []int64{}}, "ok"))
+		if err := ensureDir(cfg.ChunkDir); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("准备目录失败", 500))
 			return
 		}
-		var uploaded []int64
-		for _, entry := range entries {
-			if !entry.Type().IsRegular() {
-				continue
-			}
-			if idx, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil && idx >= 0 {
-				uploaded = append(uploaded, idx)
-			}
+		uploaded := listChunks(filepath.Join(cfg.ChunkDir, session.ID))
+		if uploaded == nil {
+			uploaded = []int64{}
 		}
-		c.JSON(http.StatusOK, Ok(gin.H{"uploaded": uploaded}, "ok"))
+		c.JSON(http.StatusOK, Ok(gin.H{"uploaded": uploaded, "job": uploadStatus(cfg, queue, session)}, "ok"))
 	}
 }
 
-func UploadHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+func UploadHandler(store *db.DB, cfg *config.Config, reg *storage.Registry, queue *FinalizeQueue) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user := middlewareGetUser(c)
-		if user == nil {
-			user = &model.User{ID: db.GuestUserID, Username: db.GuestUsername}
-		}
+		user := uploadUser(c)
 		if err := ensureDir(cfg.ChunkDir); err != nil {
 			c.JSON(http.StatusInternalServerError, Fail[any]("准备目录失败", 500))
 			return
@@ -90,7 +111,6 @@ func UploadHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.
 			c.JSON(http.StatusInternalServerError, Fail[any]("准备目录失败", 500))
 			return
 		}
-		cleanupChunks(cfg)
 
 		form, err := c.MultipartForm()
 		if err != nil {
@@ -104,246 +124,575 @@ func UploadHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.
 		}
 		fh := files[0]
 
+		// 携带 chunkIndex 的请求为分片上传，需先通过 /api/upload/session 创建会话
+		if chunkIndexPtr := utli.ParseOptionalInt64(utli.FirstValue(form.Value["chunkIndex"], "")); chunkIndexPtr != nil {
+			session, ok := loadUploadSession(c, store, utli.FirstValue(form.Value["uploadId"], ""))
+			if !ok {
+				return
+			}
+			uploadChunk(c, store, cfg, queue, user, session, fh, *chunkIndexPtr, form.Value)
+			return
+		}
+
 		uploadID := utli.FirstValue(form.Value["uploadId"], fmt.Sprintf("%d-%s", time.Now().UnixMilli(), fh.Filename))
 		fileName := filepath.Base(utli.FirstValue(form.Value["filename"], fh.Filename))
-		fileSize := utli.ParseInt64(utli.FirstValue(form.Value["filesize"], fmt.Sprintf("%d", fh.Size)), fh.Size)
-		chunkIndexPtr := utli.ParseOptionalInt64(utli.FirstValue(form.Value["chunkIndex"], ""))
-		totalChunksPtr := utli.ParseOptionalInt64(utli.FirstValue(form.Value["totalChunks"], ""))
-		chunkSizePtr := utli.ParseOptionalInt64(utli.FirstValue(form.Value["chunkSize"], ""))
+		fileSize := fh.Size
 		pickIt := utli.ParseOptionalBool(utli.FirstValue(form.Value["pickIt"], ""))
 		tags, err := db.ParseTagsFromStrings(form.Value["tags"])
 		if err != nil {
 			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
 			return
 		}
+		fileHash, ok := normalizeChecksum(utli.FirstValue(form.Value["fileHash"], ""))
+		if !ok {
+			c.JSON(http.StatusBadRequest, Fail[any]("校验值格式错误，需为 MD5 或 SHA-256 十六进制串", 400))
+			return
+		}
+		if !checkUploadAllowed(c, cfg, user, fileName, fileSize) {
+			return
+		}
+		if fileSize > cfg.ChunkThreshold {
+			c.JSON(http.StatusBadRequest, Fail[any]("文件较大，请创建上传会话后分片上传", 400))
+			return
+		}
 
-		// 访客上传按白名单限制
-		if user.ID == db.GuestUserID {
-			guestPolicy := newGuestUploadPolicy(cfg)
-			if guestPolicy == nil {
-				c.JSON(http.StatusForbidden, Fail[any]("不允许访客上传", 403))
-				return
-			}
-			if ok, msg := guestPolicy.allow(fileName, fileSize); !ok {
-				c.JSON(http.StatusBadRequest, Fail[any](msg, 400))
+		reg.Logger.Info("接收上传请求", "user", user.Username, "file", fileName, "size", fileSize)
+
+		// 小文件直接写：先流式计算摘要，再按摘要生成对象 key 写入存储
+		hash, err := hashUploadedFile(fh, fileHash)
+		if err != nil {
+			if errors.Is(err, errFileChecksum) {
+				writeUploadError(c, err)
 				return
 			}
+			slog.Error("获取文件Hash失败", "err", err)
+			c.JSON(http.StatusInternalServerError, Fail[any]("存储失败", 500))
+			return
 		}
-
-		requireChunk := fileSize > cfg.ChunkThreshold
-		if fileSize > cfg.MaxFileSize {
-			c.JSON(http.StatusBadRequest, Fail[any]("文件大小超过限制", 400))
+		resp, err := storeDirectUpload(c, store, cfg, reg, user, fh, fileName, hash, tags, pickIt)
+		if err != nil {
+			writeUploadError(c, err)
 			return
 		}
-		fileType := storage.GuessMime(fileName)
+		resp.UploadID = uploadID
+		c.JSON(http.StatusOK, Ok(resp, "ok"))
+	}
+}
 
-		stg := reg.Active()
-		reg.Logger.Info("接收上传请求", "user", user.Username, "file", fileName, "size", fileSize, "chunk", requireChunk)
+// uploadChunk 保存会话中的一个分片，文件名、大小、标签等以会话记录为准；
+// 全部分片到齐后交由后台合并入库，结果记录在会话中。
+func uploadChunk(c *gin.Context, store *db.DB, cfg *config.Config, queue *FinalizeQueue, user *model.User, session *model.UploadSession, fh *multipart.FileHeader, chunkIndex int64, values map[string][]string) {
+	reg := queue.reg
+	// 已开始合并或已结束的会话不再接收分片，重复请求直接返回当前状态
+	if session.Status != db.UploadStatusUploading {
+		respondUploadSession(c, session)
+		return
+	}
+	uploadID := session.ID
+	fileName := session.Filename
+	totalChunks := session.TotalChunks
+	chunkSize := session.ChunkSize
+	if chunkIndex < 0 || chunkIndex >= totalChunks {
+		c.JSON(http.StatusBadRequest, Fail[any]("分片参数错误", 400))
+		return
+	}
+	if fh.Size != expectedChunkSize(session, chunkIndex) {
+		c.JSON(http.StatusBadRequest, Fail[any]("分片大小与上传会话不符", 400))
+		return
+	}
+	chunkHash, ok1 := normalizeChecksum(utli.FirstValue(values["chunkHash"], ""))
+	fileHash, ok2 := normalizeChecksum(utli.FirstValue(values["fileHash"], session.FileHash))
+	if !ok1 || !ok2 {
+		c.JSON(http.StatusBadRequest, Fail[any]("校验值格式错误，需为 MD5 或 SHA-256 十六进制串", 400))
+		return
+	}
 
-		// 小文件直接写
-		if !requireChunk && (totalChunksPtr == nil || *totalChunksPtr <= 1) {
-			hash, data, err := readAndHash(fh)
-			if err != nil {
-				slog.Error("获取文件Hash失败", "err", err)
-				c.JSON(http.StatusInternalServerError, Fail[any]("存储失败", 500))
-				return
-			}
-			fileSize := int64(len(data))
-			objectKey := storage.BuildObjectKey(hash, fileName, time.Now())
-			storedPath, err := stg.Write(objectKey, bytes.NewReader(data), int64(len(data)), fileType)
-			if err != nil {
-				slog.Error("写入文件失败", "err", err)
-				c.JSON(http.StatusInternalServerError, Fail[any]("存储失败", 500))
-				return
-			}
-			resID, share, err := persistResource(c, store, model.Resource{Filename: fileName, Hash: hash, Type: fileType, Path: storedPath, FileSize: fileSize, UserID: user.ID}, tags)
-			if err != nil {
-				slog.Error("写入数据库失败", "err", err)
-				c.JSON(http.StatusInternalServerError, Fail[any]("存储失败", 500))
-				return
-			}
-			if err := setUploadPickResource(store, user, resID, pickIt); err != nil {
-				c.JSON(http.StatusInternalServerError, Fail[any]("设置 pick 资源失败", 500))
+	chunkFolder := filepath.Join(cfg.ChunkDir, uploadID)
+	if err := ensureDir(chunkFolder); err != nil {
+		c.JSON(http.StatusInternalServerError, Fail[any]("准备分片目录失败", 500))
+		return
+	}
+	chunkPath := filepath.Join(chunkFolder, fmt.Sprintf("%d", chunkIndex))
+
+	skipped := false
+	if _, err := os.Stat(chunkPath); err == nil {
+		// 已有分片与本次携带的校验值不符时，用新上传的数据覆盖
+		if matched, err := fileMatchesChecksum(chunkPath, chunkHash); err != nil || matched {
+			skipped = true
+		}
+	}
+	if !skipped {
+		if err := saveChunk(fh, chunkPath, chunkHash); err != nil {
+			if errors.Is(err, errChunkChecksum) {
+				reg.Logger.Warn("分片校验失败", "upload_id", uploadID, "chunk", chunkIndex)
+				writeUploadError(c, err)
 				return
 			}
-			reg.Logger.Info("文件上传完成", "user", user.Username, "file", fileName, "resource_id", resID, "share", share)
-			c.JSON(http.StatusOK, Ok(uploadResponse{Merged: true, UploadID: uploadID, Filename: fileName, Size: fileSize, ShareCode: share, ResourceID: resID}, "ok"))
+			c.JSON(http.StatusInternalServerError, Fail[any]("保存分片失败", 500))
 			return
 		}
-
-		// 分片参数校验
-		if chunkIndexPtr == nil || totalChunksPtr == nil || *chunkIndexPtr < 0 || *totalChunksPtr <= 0 || *chunkIndexPtr >= *totalChunksPtr {
-			c.JSON(http.StatusBadRequest, Fail[any]("分片参数错误", 400))
+	}
+	// 首个分片包含文件头，访客上传在此提前校验内容，不符时丢弃整个上传
+	if chunkIndex == 0 && !skipped && user.ID == db.GuestUserID {
+		head, err := readFileHead(chunkPath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取分片失败", 500))
 			return
 		}
-		chunkFolder := filepath.Join(cfg.ChunkDir, uploadID)
-		if err := ensureDir(chunkFolder); err != nil {
-			c.JSON(http.StatusInternalServerError, Fail[any]("准备分片目录失败", 500))
+		if _, ok := detectUploadType(c, user, fileName, head); !ok {
+			_ = os.RemoveAll(chunkFolder)
+			_ = store.Upload.Delete(c.Request.Context(), uploadID)
 			return
 		}
-		chunkPath := filepath.Join(chunkFolder, fmt.Sprintf("%d", *chunkIndexPtr))
+	}
+
+	if !hasAllChunks(chunkFolder, totalChunks) {
+		c.JSON(http.StatusOK, Ok(uploadResponse{Skipped: skipped, Merged: false, UploadID: uploadID, Filename: fileName, ChunkIndex: &chunkIndex, TotalChunks: &totalChunks, ChunkSize: &chunkSize}, "ok"))
+		return
+	}
 
-		if _, err := os.Stat(chunkPath); err == nil {
-			chunkEntries, _ := os.ReadDir(chunkFolder)
-			isComplete := int64(len(chunkEntries)) >= *totalChunksPtr
-			c.JSON(http.StatusOK, Ok(uploadResponse{Skipped: true, Merged: isComplete, UploadID: uploadID, Filename: fileName, ChunkIndex: chunkIndexPtr, TotalChunks: totalChunksPtr, ChunkSize: chunkSizePtr}, "ok"))
+	// 多个分片并发到齐时只有抢占成功的请求提交合并任务，其余请求返回当前状态
+	claimed, err := store.Upload.ClaimFinalize(c.Request.Context(), uploadID, fileHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Fail[any]("更新上传会话失败", 500))
+		return
+	}
+	if !claimed {
+		current, err := store.Upload.Get(c.Request.Context(), uploadID)
+		if err != nil || current == nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取上传会话失败", 500))
 			return
 		}
+		respondUploadSession(c, current)
+		return
+	}
+	if !queue.Enqueue(uploadID) {
+		reg.Logger.Warn("合并队列已满，等待重新扫描后处理", "upload_id", uploadID)
+	}
+	c.JSON(http.StatusAccepted, Ok(uploadResponse{Merged: false, Finalizing: true, UploadID: uploadID, Filename: fileName, TotalChunks: &totalChunks}, "ok"))
+}
 
-		if err := c.SaveUploadedFile(fh, chunkPath); err != nil {
-			c.JSON(http.StatusInternalServerError, Fail[any]("保存分片失败", 500))
-			return
+// mergeUploadSession 合并会话的全部分片并入库，成功后清理分片；合并文件总是删除。
+// 失败时保留分片，由调用方决定重试或清理。
+func mergeUploadSession(ctx context.Context, store *db.DB, cfg *config.Config, reg *storage.Registry, user *model.User, session *model.UploadSession, tags []string, progress finalizeProgress) (uploadResponse, error) {
+	chunkFolder := filepath.Join(cfg.ChunkDir, session.ID)
+	mergedPath := filepath.Join(cfg.MergeDir, fmt.Sprintf("%s-%s", session.ID, session.Filename))
+	defer os.Remove(mergedPath)
+	if err := mergeChunks(chunkFolder, session.TotalChunks, mergedPath, progress.phase(finalizeMerging, session.FileSize)); err != nil {
+		reg.Logger.Error("合并分片失败", "upload_id", session.ID, "err", err)
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "合并失败"}
+	}
+	reg.Logger.Info("分片合并完成", "upload_id", session.ID, "file", session.Filename, "total", session.TotalChunks)
+	resp, err := finalizeMergedFile(ctx, store, cfg, reg, user, mergedPath, mergedUpload{UploadID: session.ID, Filename: session.Filename, Tags: tags, PickIt: session.PickIt, Checksum: session.FileHash, Progress: progress})
+	if err != nil {
+		return uploadResponse{}, err
+	}
+	_ = os.RemoveAll(chunkFolder)
+	return resp, nil
+}
+
+// respondUploadSession 按会话状态返回结果：已完成时返回已创建的资源，合并中时返回 202 供客户端轮询。
+func respondUploadSession(c *gin.Context, session *model.UploadSession) {
+	switch session.Status {
+	case db.UploadStatusDone:
+		c.JSON(http.StatusOK, Ok(uploadResponse{Merged: true, UploadID: session.ID, Filename: session.Filename, Size: session.FileSize, ShareCode: session.ShareCode, ResourceID: session.ResourceID}, "ok"))
+	case db.UploadStatusFailed:
+		c.JSON(http.StatusConflict, Fail[any]("上传失败："+session.Error, 409))
+	case db.UploadStatusFinalizing:
+		c.JSON(http.StatusAccepted, Ok(uploadResponse{Merged: false, Finalizing: true, UploadID: session.ID, Filename: session.Filename}, "ok"))
+	default:
+		c.JSON(http.StatusOK, Ok(uploadResponse{Merged: false, UploadID: session.ID, Filename: session.Filename}, "ok"))
+	}
+}
+
+// hasAllChunks 判断会话的分片是否已全部保存。
+func hasAllChunks(folder string, totalChunks int64) bool {
+	uploaded := listChunks(folder)
+	if int64(len(uploaded)) < totalChunks {
+		return false
+	}
+	seen := make(map[int64]struct{}, len(uploaded))
+	for _, idx := range uploaded {
+		if idx < totalChunks {
+			seen[idx] = struct{}{}
 		}
+	}
+	return int64(len(seen)) == totalChunks
+}
 
-		chunkFiles, _ := os.ReadDir(chunkFolder)
-		hasAll := int64(len(chunkFiles)) >= *totalChunksPtr
-		if hasAll {
-			// 检查是否缺失分片
-			missing := false
-			for i := int64(0); i < *totalChunksPtr; i++ {
-				if _, err := os.Stat(filepath.Join(chunkFolder, fmt.Sprintf("%d", i))); err != nil {
-					missing = true
-					break
-				}
-			}
-			if !missing {
-				mergedPath := filepath.Join(cfg.MergeDir, fmt.Sprintf("%s-%s", uploadID, fileName))
-				if err := mergeChunks(chunkFolder, *totalChunksPtr, mergedPath); err != nil {
-					c.JSON(http.StatusInternalServerError, Fail[any]("合并失败", 500))
-					return
-				}
-				reg.Logger.Info("分片合并完成", "upload_id", uploadID, "file", fileName, "total", *totalChunksPtr)
-				stat, err := os.Stat(mergedPath)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, Fail[any]("读取文件失败", 500))
-					return
-				}
-				fileSize = stat.Size()
-				hash, err := hashFile(mergedPath)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, Fail[any]("计算摘要失败", 500))
-					return
-				}
-				objectKey := storage.BuildObjectKey(hash, fileName, time.Now())
-				f, err := os.Open(mergedPath)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, Fail[any]("读取文件失败", 500))
-					return
-				}
-				defer f.Close()
-				storedPath, err := stg.Write(objectKey, f, -1, fileType)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, Fail[any]("存储失败", 500))
-					return
-				}
-				resID, share, err := persistResource(c, store, model.Resource{Filename: fileName, Hash: hash, Type: fileType, Path: storedPath, FileSize: fileSize, UserID: user.ID}, tags)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, Fail[any]("记录失败", 500))
-					return
-				}
-				if err := setUploadPickResource(store, user, resID, pickIt); err != nil {
-					c.JSON(http.StatusInternalServerError, Fail[any]("设置 pick 资源失败", 500))
-					return
-				}
-				reg.Logger.Info("分片上传完成", "user", user.Username, "file", fileName, "resource_id", resID, "share", share)
-				_ = os.Remove(mergedPath)
-				_ = os.RemoveAll(chunkFolder)
-				c.JSON(http.StatusOK, Ok(uploadResponse{Merged: true, UploadID: uploadID, Filename: fileName, Size: fileSize, ShareCode: share, ResourceID: resID}, "ok"))
-				return
-			}
+// mergedUpload 描述一个已在本地拼接完整、等待入库的上传。
+type mergedUpload struct {
+	UploadID string
+	Filename string
+	Tags     []string
+	PickIt   bool
+	// Checksum 客户端声明的完整文件校验值，为空时不校验
+	Checksum string
+	// Progress 后台任务的进度回调，同步上传时为 nil
+	Progress finalizeProgress
+}
+
+// finalizeMergedFile 校验本地完整文件的配额与内容类型，写入存储并入库。
+// 分片上传、tus 上传与链接上传共用；临时文件由调用方清理。
+func finalizeMergedFile(ctx context.Context, store *db.DB, cfg *config.Config, reg *storage.Registry, user *model.User, mergedPath string, up mergedUpload) (uploadResponse, error) {
+	stat, err := os.Stat(mergedPath)
+	if err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "读取文件失败"}
+	}
+	fileSize := stat.Size()
+	// 实际大小可能与声明不符，入库前按完整文件大小再次校验
+	if err := uploadQuotaError(ctx, store, user, fileSize); err != nil {
+		return uploadResponse{}, err
+	}
+	hash, err := hashFileProgress(mergedPath, up.Progress.phase(finalizeHashing, fileSize))
+	if err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "计算摘要失败"}
+	}
+	// 写入存储前校验合并结果，避免损坏的文件拿到分享码
+	if up.Checksum != "" && up.Checksum != hash {
+		matched, err := fileMatchesChecksum(mergedPath, up.Checksum)
+		if err != nil {
+			return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "计算摘要失败"}
+		}
+		if !matched {
+			reg.Logger.Warn("文件校验失败", "upload_id", up.UploadID, "file", up.Filename)
+			return uploadResponse{}, errFileChecksum
+		}
+	}
+	head, err := readFileHead(mergedPath)
+	if err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "读取文件失败"}
+	}
+	fileType, err := sniffUploadType(user, up.Filename, head)
+	if err != nil {
+		return uploadResponse{}, err
+	}
+	name, stg := routeUpload(reg, user, up.Tags, fileType, fileSize)
+	objectKey, err := buildUploadKey(cfg, storage.KeyMeta{Hash: hash, Filename: up.Filename, Username: user.Username, Tags: up.Tags, Time: time.Now()})
+	if err != nil {
+		reg.Logger.Error("生成对象 key 失败", "err", err)
+		return uploadResponse{}, errStoreFailed
+	}
+	f, err := os.Open(mergedPath)
+	if err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "读取文件失败"}
+	}
+	defer f.Close()
+	body := &progressReader{r: f, report: up.Progress.phase(finalizeUploading, fileSize)}
+	// 持有 hash 锁直到资源入库，避免复用的对象在此期间被删除
+	unlock := store.Resource.LockHash(hash)
+	defer unlock()
+	content := func() (io.ReadCloser, error) { return os.Open(mergedPath) }
+	storedPath, written, err := writeOrReuse(ctx, store, reg, name, stg, hash, fileSize, content, objectKey, body, fileType)
+	if err != nil {
+		reg.Logger.Error("写入文件失败", "err", err)
+		return uploadResponse{}, errStoreFailed
+	}
+	resID, share, err := persistResource(ctx, store, model.Resource{Filename: up.Filename, Hash: hash, Type: fileType, Path: storedPath, FileSize: fileSize, UserID: user.ID}, up.Tags)
+	if err != nil {
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			discardWritten(reg, stg, storedPath, written)
+			return uploadResponse{}, err
 		}
-		c.JSON(http.StatusOK, Ok(uploadResponse{Merged: false, UploadID: uploadID, Filename: fileName, ChunkIndex: chunkIndexPtr, TotalChunks: totalChunksPtr, ChunkSize: chunkSizePtr}, "ok"))
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "记录失败"}
+	}
+	if err := setUploadPickResource(store, user, resID, up.PickIt); err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "设置 pick 资源失败"}
 	}
+	reg.Logger.Info("文件上传完成", "user", user.Username, "file", up.Filename, "resource_id", resID, "share", share)
+	return uploadResponse{Merged: true, UploadID: up.UploadID, Filename: up.Filename, Size: fileSize, ShareCode: share, ResourceID: resID}, nil
 }
 
-func setUploadPickResource(store *db.DB, user *model.User, resourceID int64, pickIt bool) error {
-	if !pickIt || user == nil || user.ID == db.GuestUserID {
-		return nil
+// storeDirectUpload 将已计算摘要的上传文件校验配额与类型后写入存储并入库。
+// 文件内容从 multipart 中流式读取，较大的文件由标准库暂存在磁盘上，不会整体读入内存。
+func storeDirectUpload(c *gin.Context, store *db.DB, cfg *config.Config, reg *storage.Registry, user *model.User, fh *multipart.FileHeader, fileName, hash string, tags []string, pickIt bool) (uploadResponse, error) {
+	fileSize := fh.Size
+	if err := uploadQuotaError(c.Request.Context(), store, user, fileSize); err != nil {
+		return uploadResponse{}, err
 	}
-	return store.Resource.SetUserPickResourceID(user.ID, resourceID)
+	src, err := fh.Open()
+	if err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "读取文件失败"}
+	}
+	defer src.Close()
+	head, err := readHead(src)
+	if err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "读取文件失败"}
+	}
+	fileType, err := sniffUploadType(user, fileName, head)
+	if err != nil {
+		return uploadResponse{}, err
+	}
+	name, stg := routeUpload(reg, user, tags, fileType, fileSize)
+	objectKey, err := buildUploadKey(cfg, storage.KeyMeta{Hash: hash, Filename: fileName, Username: user.Username, Tags: tags, Time: time.Now()})
+	if err != nil {
+		slog.Error("生成对象 key 失败", "err", err)
+		return uploadResponse{}, errStoreFailed
+	}
+	unlock := store.Resource.LockHash(hash)
+	defer unlock()
+	content := func() (io.ReadCloser, error) { return fh.Open() }
+	storedPath, written, err := writeOrReuse(c.Request.Context(), store, reg, name, stg, hash, fileSize, content, objectKey, io.NewSectionReader(src, 0, fileSize), fileType)
+	if err != nil {
+		slog.Error("写入文件失败", "err", err)
+		return uploadResponse{}, errStoreFailed
+	}
+	resID, share, err := persistResource(c.Request.Context(), store, model.Resource{Filename: fileName, Hash: hash, Type: fileType, Path: storedPath, FileSize: fileSize, UserID: user.ID}, tags)
+	if err != nil {
+		var ue *uploadError
+		if errors.As(err, &ue) {
+			discardWritten(reg, stg, storedPath, written)
+			return uploadResponse{}, err
+		}
+		slog.Error("写入数据库失败", "err", err)
+		return uploadResponse{}, errStoreFailed
+	}
+	if err := setUploadPickResource(store, user, resID, pickIt); err != nil {
+		return uploadResponse{}, &uploadError{Status: http.StatusInternalServerError, Msg: "设置 pick 资源失败"}
+	}
+	reg.Logger.Info("文件上传完成", "user", user.Username, "file", fileName, "resource_id", resID, "share", share)
+	return uploadResponse{Merged: true, Filename: fileName, Size: fileSize, ShareCode: share, ResourceID: resID}, nil
 }
 
-func ensureDir(dir string) error {
-	return os.MkdirAll(dir, 0o755)
+// routeUpload 按存储路由规则选择本次上传写入的存储，返回存储名与驱动。
+func routeUpload(reg *storage.Registry, user *model.User, tags []string, contentType string, size int64) (string, storage.Storage) {
+	name, stg := reg.Route(storage.UploadMeta{Username: user.Username, Tags: tags, ContentType: contentType, Size: size})
+	reg.Logger.Debug("选择上传存储", "user", user.Username, "storage", name, "size", size, "type", contentType)
+	return name, stg
 }
 
-func cleanupChunks(cfg *config.Config) {
-	total, err := dirSize(cfg.ChunkDir)
-	if err != nil || total <= cfg.CleanLimit {
-		return
+// buildUploadKey 按 STORAGE_KEY_TEMPLATE 生成对象 key；模板不含 hash 或随机串时，
+// 同名文件可能冲突，此时总是追加 hash 后缀避免覆盖已有对象。
+func buildUploadKey(cfg *config.Config, meta storage.KeyMeta) (string, error) {
+	tpl := cfg.GetAppConfig().StorageKeyTemplate
+	key, err := storage.RenderObjectKey(tpl, meta)
+	if err != nil {
+		return "", err
 	}
-	now := time.Now()
-	entries, err := os.ReadDir(cfg.ChunkDir)
+	if storage.KeyTemplateUnique(tpl) {
+		return key, nil
+	}
+	return storage.SuffixObjectKey(key, meta.Hash), nil
+}
+
+// writeOrReuse 按内容去重：目标存储中已存在内容完全相同的对象时直接复用其路径，
+// 否则写入新对象，第二个返回值表示是否写入了新对象。对象的引用计数即引用该路径的资源数量。
+// content 重新打开本次上传的内容，用于与候选对象逐字节比较。
+// 调用方须持有 store.Resource.LockHash(hash) 直到资源入库。
+func writeOrReuse(ctx context.Context, store *db.DB, reg *storage.Registry, name string, stg storage.Storage, hash string, size int64, content func() (io.ReadCloser, error), objectKey string, r io.Reader, contentType string) (string, bool, error) {
+	existing, err := findReusablePath(ctx, store, reg, name, hash, size, content)
 	if err != nil {
+		return "", false, err
+	}
+	if existing != "" {
+		return existing, false, nil
+	}
+	storedPath, err := stg.Write(objectKey, r, size, contentType)
+	return storedPath, err == nil, err
+}
+
+// discardWritten 资源因配额等校验未能入库时删除本次新写入的对象，复用的已有对象保留。
+// 调用方须仍持有该内容的 hash 锁。
+func discardWritten(reg *storage.Registry, stg storage.Storage, storedPath string, written bool) {
+	if !written {
 		return
 	}
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	if err := stg.Delete(storedPath); err != nil {
+		reg.Logger.Warn("删除未入库的存储对象失败", "path", storedPath, "err", err)
+	}
+}
+
+// findReusablePath 返回存储 name 中可复用的已有存储路径，不存在时返回空字符串。
+// 只复用同一存储中的对象：路由到加密或镜像存储的上传不能引用其他存储里的明文副本。
+// MD5 与大小相同的候选对象还需与 content 逐字节一致，避免构造的 MD5 碰撞引用到他人的文件。
+func findReusablePath(ctx context.Context, store *db.DB, reg *storage.Registry, name, hash string, size int64, content func() (io.ReadCloser, error)) (string, error) {
+	ctx, cancel := store.WithTimeout(ctx, 5*time.Second)
+	paths, err := store.Resource.ListPathsByHash(ctx, hash, size)
+	cancel()
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		srcName, src, err := reg.Resolve(path)
+		if err != nil || srcName != name {
 			continue
 		}
-		folder := filepath.Join(cfg.ChunkDir, entry.Name())
-		files, err := os.ReadDir(folder)
+		same, err := sameContent(ctx, src, path, content)
 		if err != nil {
 			continue
 		}
-		for _, f := range files {
-			info, err := f.Info()
-			if err != nil {
-				continue
-			}
-			if now.Sub(info.ModTime()) > cfg.CleanExpire {
-				_ = os.Remove(filepath.Join(folder, f.Name()))
-			}
-		}
-		remain, _ := os.ReadDir(folder)
-		if len(remain) == 0 {
-			_ = os.RemoveAll(folder)
+		if !same {
+			reg.Logger.Warn("MD5 相同但内容不同，不复用已有对象", "hash", hash, "path", path)
+			continue
 		}
+		reg.Logger.Info("复用已有存储对象", "hash", hash, "path", path)
+		return path, nil
 	}
+	return "", nil
 }
 
-func dirSize(dir string) (int64, error) {
-	var total int64
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// sameContent 逐字节比较存储对象与 content 的内容是否一致。
+func sameContent(ctx context.Context, stg storage.Storage, storedPath string, content func() (io.ReadCloser, error)) (bool, error) {
+	existing, err := storage.OpenContext(ctx, stg, storedPath, 0, -1)
+	if err != nil {
+		return false, err
+	}
+	defer existing.Close()
+	r, err := content()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	a := make([]byte, 32*1024)
+	b := make([]byte, 32*1024)
+	for {
+		n, errA := io.ReadFull(existing, a)
+		m, errB := io.ReadFull(r, b)
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !doneA {
+			return false, errA
 		}
-		if info.Mode().IsRegular() {
-			total += info.Size()
+		if errB != nil && !doneB {
+			return false, errB
 		}
-		return nil
-	})
-	return total, err
+		if !bytes.Equal(a[:n], b[:m]) {
+			return false, nil
+		}
+		if doneA || doneB {
+			return doneA && doneB, nil
+		}
+	}
 }
 
-func readAndHash(fh *multipart.FileHeader) (string, []byte, error) {
-	file, err := fh.Open()
+// detectUploadType 按文件头识别 MIME 类型。内容与扩展名不符时记录告警，
+// 访客上传则直接拒绝，避免通过改扩展名绕过白名单；拒绝时已写入错误响应。
+func detectUploadType(c *gin.Context, user *model.User, fileName string, head []byte) (string, bool) {
+	contentType, err := sniffUploadType(user, fileName, head)
 	if err != nil {
-		return "", nil, err
+		writeUploadError(c, err)
+		return "", false
 	}
-	defer file.Close()
-	data, err := io.ReadAll(file)
+	return contentType, true
+}
+
+func sniffUploadType(user *model.User, fileName string, head []byte) (string, error) {
+	contentType, consistent := storage.SniffMime(head, fileName)
+	if consistent {
+		return contentType, nil
+	}
+	slog.Warn("文件内容与扩展名不符", "user", user.Username, "file", fileName, "detected", contentType)
+	if user.ID == db.GuestUserID {
+		return "", &uploadError{Status: http.StatusBadRequest, Msg: "文件内容与扩展名不符"}
+	}
+	return contentType, nil
+}
+
+// listChunks 返回目录中已完整保存的分片序号，忽略写入中的 .part 临时文件。
+func listChunks(folder string) []int64 {
+	entries, err := os.ReadDir(folder)
 	if err != nil {
-		return "", nil, err
+		return nil
+	}
+	var uploaded []int64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if idx, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil && idx >= 0 {
+			uploaded = append(uploaded, idx)
+		}
+	}
+	return uploaded
+}
+
+// readFileHead 读取文件开头用于类型识别。
+func readFileHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readHead(f)
+}
+
+// readHead 读取文件开头用于识别类型的部分，不移动读取位置。
+func readHead(r io.ReaderAt) ([]byte, error) {
+	head := make([]byte, storage.SniffLen)
+	n, err := io.ReadFull(io.NewSectionReader(r, 0, storage.SniffLen), head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// uploadUser 返回当前上传者，未登录时视为访客。
+func uploadUser(c *gin.Context) *model.User {
+	user := middlewareGetUser(c)
+	if user == nil {
+		user = &model.User{ID: db.GuestUserID, Username: db.GuestUsername}
+	}
+	return user
+}
+
+// checkUploadAllowed 校验访客白名单与文件大小限制，不通过时直接写入错误响应。
+func checkUploadAllowed(c *gin.Context, cfg *config.Config, user *model.User, fileName string, fileSize int64) bool {
+	if err := uploadAllowedError(cfg, user, fileName, fileSize); err != nil {
+		writeUploadError(c, err)
+		return false
+	}
+	return true
+}
+
+func uploadAllowedError(cfg *config.Config, user *model.User, fileName string, fileSize int64) error {
+	// 访客上传按白名单限制
+	if user.ID == db.GuestUserID {
+		guestPolicy := newGuestUploadPolicy(cfg)
+		if guestPolicy == nil {
+			return &uploadError{Status: http.StatusForbidden, Msg: "不允许访客上传"}
+		}
+		if ok, msg := guestPolicy.allow(fileName, fileSize); !ok {
+			return &uploadError{Status: http.StatusBadRequest, Msg: msg}
+		}
 	}
-	sum := md5.Sum(data)
-	return hex.EncodeToString(sum[:]), data, nil
+	if fileSize > cfg.MaxFileSize {
+		return &uploadError{Status: http.StatusBadRequest, Msg: "文件大小超过限制"}
+	}
+	return nil
+}
+
+func setUploadPickResource(store *db.DB, user *model.User, resourceID int64, pickIt bool) error {
+	if !pickIt || user == nil || user.ID == db.GuestUserID {
+		return nil
+	}
+	return store.Resource.SetUserPickResourceID(user.ID, resourceID)
+}
+
+func ensureDir(dir string) error {
+	return os.MkdirAll(dir, 0o755)
 }
 
 func hashFile(path string) (string, error) {
+	return hashFileProgress(path, func(int64) {})
+}
+
+// hashFileProgress 计算文件 MD5，读取过程中通过 report 上报已读字节数。
+func hashFileProgress(path string, report func(int64)) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 	h := md5.New()
-	if _, err := io.Copy(h, f); err != nil {
+	if _, err := io.Copy(h, &progressReader{r: f, report: report}); err != nil {
 		return "", err
 	}
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func mergeChunks(folder string, total int64, target string) error {
+// mergeChunks 按序拼接分片，每写完一个分片通过 report 上报已写入字节数。
+func mergeChunks(folder string, total int64, target string, report func(int64)) error {
 	if err := ensureDir(filepath.Dir(target)); err != nil {
 		return err
 	}
@@ -352,17 +701,20 @@ func mergeChunks(folder string, total int64, target string) error {
 		return err
 	}
 	defer out.Close()
+	var written int64
 	for i := int64(0); i < total; i++ {
 		chunkPath := filepath.Join(folder, fmt.Sprintf("%d", i))
 		r, err := os.Open(chunkPath)
 		if err != nil {
 			return err
 		}
-		if _, err := io.Copy(out, r); err != nil {
-			r.Close()
+		n, err := io.Copy(out, r)
+		r.Close()
+		if err != nil {
 			return err
 		}
-		r.Close()
+		written += n
+		report(written)
 	}
 	return nil
 }
@@ -373,11 +725,12 @@ type guestUploadPolicy struct {
 }
 
 func newGuestUploadPolicy(cfg *config.Config) *guestUploadPolicy {
-	if !cfg.AppConfig.GuestUploadEnable {
+	appCfg := cfg.GetAppConfig()
+	if !appCfg.GuestUploadEnable {
 		return nil
 	}
-	maxMb := cfg.AppConfig.GuestUploadMaxMbSize
-	extSet := parseExtWhitelist(cfg.AppConfig.GuestUploadExtWhitelist)
+	maxMb := appCfg.GuestUploadMaxMbSize
+	extSet := parseExtWhitelist(appCfg.GuestUploadExtWhitelist)
 	if maxMb <= 0 || len(extSet) == 0 {
 		return nil
 	}
@@ -437,8 +790,15 @@ func (p *guestUploadPolicy) allow(fileName string, fileSize int64) (bool, string
 	return true, ""
 }
 
-func persistResource(c *gin.Context, store *db.DB, res model.Resource, tags []string) (int64, string, error) {
-	ctx, cancel := store.WithTimeout(c.Request.Context(), 10*time.Second)
+// persistResource 写入资源记录、标签与分享码。入库前在用户锁内按实际大小再次校验配额，
+// 超出时返回 *uploadError 且不写入任何记录。
+func persistResource(ctx context.Context, store *db.DB, res model.Resource, tags []string) (int64, string, error) {
+	unlock := store.Resource.LockUser(res.UserID)
+	defer unlock()
+	if err := uploadQuotaError(ctx, store, &model.User{ID: res.UserID}, res.FileSize); err != nil {
+		return 0, "", err
+	}
+	ctx, cancel := store.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 	resID, err := store.Resource.Insert(ctx, res)
 	if err != nil {
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+	"linkit/internal/utli"
+)
+
+const maxBatchFiles = 50
+
+type batchUploadItem struct {
+	Filename   string `json:"filename"`
+	Success    bool   `json:"success"`
+	Code       int    `json:"code"`
+	Msg        string `json:"msg,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	ShareCode  string `json:"shareCode,omitempty"`
+	ResourceID int64  `json:"resourceId,omitempty"`
+}
+
+type batchUploadResponse struct {
+	Items     []batchUploadItem `json:"items"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+// BatchUploadHandler 一次请求上传多个小文件，标签与 pickIt 对所有文件生效。
+// 文件逐个处理，单个文件失败不影响其余文件，结果按上传顺序返回。
+func BatchUploadHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := uploadUser(c)
+		if err := ensureDir(cfg.LocalRoot); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("准备目录失败", 500))
+			return
+		}
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("上传数据格式错误", 400))
+			return
+		}
+		files := form.File[uploadField]
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, Fail[any]("未选择文件", 400))
+			return
+		}
+		if len(files) > maxBatchFiles {
+			c.JSON(http.StatusBadRequest, Fail[any]("单次最多上传 50 个文件", 400))
+			return
+		}
+		pickIt := utli.ParseOptionalBool(utli.FirstValue(form.Value["pickIt"], ""))
+		tags, err := db.ParseTagsFromStrings(form.Value["tags"])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
+			return
+		}
+		reg.Logger.Info("接收批量上传请求", "user", user.Username, "count", len(files))
+
+		result := batchUploadResponse{Items: make([]batchUploadItem, 0, len(files))}
+		for _, fh := range files {
+			fileName := filepath.Base(fh.Filename)
+			item := batchUploadItem{Filename: fileName, Code: http.StatusOK}
+			resp, err := storeBatchFile(c, store, cfg, reg, user, fh, tags, pickIt)
+			if err != nil {
+				var ue *uploadError
+				if !errors.As(err, &ue) {
+					ue = errStoreFailed
+				}
+				item.Code = ue.Status
+				item.Msg = ue.Msg
+				result.Failed++
+			} else {
+				item.Success = true
+				item.Size = resp.Size
+				item.ShareCode = resp.ShareCode
+				item.ResourceID = resp.ResourceID
+				result.Succeeded++
+			}
+			result.Items = append(result.Items, item)
+		}
+
+		msg := "ok"
+		switch {
+		case result.Succeeded == 0:
+			msg = "全部文件上传失败"
+		case result.Failed > 0:
+			msg = "部分文件上传失败"
+		}
+		c.JSON(http.StatusOK, Ok(result, msg))
+	}
+}
+
+func storeBatchFile(c *gin.Context, store *db.DB, cfg *config.Config, reg *storage.Registry, user *model.User, fh *multipart.FileHeader, tags []string, pickIt bool) (uploadResponse, error) {
+	fileName := filepath.Base(fh.Filename)
+	fileSize := fh.Size
+	if fileName == "" || fileName == "." || fileName == "/" {
+		return uploadResponse{}, &uploadError{Status: http.StatusBadRequest, Msg: "缺少文件名"}
+	}
+	if err := uploadAllowedError(cfg, user, fileName, fileSize); err != nil {
+		return uploadResponse{}, err
+	}
+	// 与单文件上传一致，大文件需走分片上传以便断点续传
+	if fileSize > cfg.ChunkThreshold {
+		return uploadResponse{}, &uploadError{Status: http.StatusRequestEntityTooLarge, Msg: "文件过大，请使用分片上传"}
+	}
+	hash, err := hashUploadedFile(fh, "")
+	if err != nil {
+		slog.Error("获取文件Hash失败", "err", err)
+		return uploadResponse{}, errStoreFailed
+	}
+	return storeDirectUpload(c, store, cfg, reg, user, fh, fileName, hash, tags, pickIt)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/storage"
+	"linkit/internal/utli"
+)
+
+// RawUploadHandler 将请求体原样保存为资源，便于脚本通过 curl -T 上传而无需构造 multipart 表单。
+// 标签、pick 与校验值通过查询参数或 Linkit-* 请求头传递；默认返回纯文本分享链接，
+// 请求 JSON（Accept: application/json 或 ?format=json）时返回与其他上传接口相同的结果。
+func RawUploadHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		asJSON := c.Query("format") == "json" || strings.Contains(c.GetHeader("Accept"), "application/json")
+		fail := func(err error) {
+			if asJSON {
+				writeUploadError(c, err)
+				return
+			}
+			var ue *uploadError
+			if !errors.As(err, &ue) {
+				ue = errStoreFailed
+			}
+			c.String(ue.Status, ue.Msg+"\n")
+		}
+
+		user := uploadUser(c)
+		fileName := filepath.Base(strings.ReplaceAll(c.Param("filename"), "\\", "/"))
+		if fileName == "" || fileName == "." || fileName == "/" {
+			fail(&uploadError{Status: http.StatusBadRequest, Msg: "缺少文件名"})
+			return
+		}
+		tags, err := db.ParseTagsFromStrings(append(c.QueryArray("tags"), c.GetHeader("Linkit-Tags")))
+		if err != nil {
+			fail(&uploadError{Status: http.StatusBadRequest, Msg: err.Error()})
+			return
+		}
+		pickIt := utli.ParseOptionalBool(utli.FirstValue(c.QueryArray("pickIt"), c.GetHeader("Linkit-Pick-It")))
+		fileHash, ok := normalizeChecksum(utli.FirstValue(c.QueryArray("fileHash"), c.GetHeader("Linkit-File-Hash")))
+		if !ok {
+			fail(&uploadError{Status: http.StatusBadRequest, Msg: "校验值格式错误，需为 MD5 或 SHA-256 十六进制串"})
+			return
+		}
+		// 使用分块传输时请求前无法得知大小，写入完成后再按实际大小校验
+		if size := c.Request.ContentLength; size >= 0 {
+			if err := uploadAllowedError(cfg, user, fileName, size); err != nil {
+				fail(err)
+				return
+			}
+			if err := uploadQuotaError(c.Request.Context(), store, user, size); err != nil {
+				fail(err)
+				return
+			}
+		}
+		if err := ensureDir(cfg.MergeDir); err != nil {
+			fail(&uploadError{Status: http.StatusInternalServerError, Msg: "准备目录失败"})
+			return
+		}
+
+		tmp, err := os.CreateTemp(cfg.MergeDir, "put-*")
+		if err != nil {
+			fail(&uploadError{Status: http.StatusInternalServerError, Msg: "创建临时文件失败"})
+			return
+		}
+		tmpPath := tmp.Name()
+		defer os.Remove(tmpPath)
+		written, err := io.Copy(tmp, io.LimitReader(c.Request.Body, cfg.MaxFileSize+1))
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			reg.Logger.Warn("接收上传数据失败", "file", fileName, "err", err)
+			fail(&uploadError{Status: http.StatusBadRequest, Msg: "读取上传数据失败"})
+			return
+		}
+		if err := uploadAllowedError(cfg, user, fileName, written); err != nil {
+			fail(err)
+			return
+		}
+
+		reg.Logger.Info("接收上传请求", "user", user.Username, "file", fileName, "size", written)
+		resp, err := finalizeMergedFile(c.Request.Context(), store, cfg, reg, user, tmpPath, mergedUpload{Filename: fileName, Tags: tags, PickIt: pickIt, Checksum: fileHash})
+		if err != nil {
+			fail(err)
+			return
+		}
+		c.Header("Linkit-Share-Code", resp.ShareCode)
+		c.Header("Linkit-Resource-Id", strconv.FormatInt(resp.ResourceID, 10))
+		if asJSON {
+			c.JSON(http.StatusOK, Ok(resp, "ok"))
+			return
+		}
+		c.String(http.StatusOK, requestBaseURL(c)+"/r/"+resp.ShareCode+"\n")
+	}
+}
+
+// requestBaseURL 按请求推断站点地址，经反向代理时使用 X-Forwarded-Proto / X-Forwarded-Host。
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	host := c.Request.Host
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return scheme + "://" + host
+}
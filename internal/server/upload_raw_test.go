@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db/model"
+)
+
+func TestRawUploadChecks(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, func(cfg *config.Config) {
+		cfg.MaxFileSize = 32
+		cfg.AppConfig.GuestUploadEnable = true
+		cfg.AppConfig.GuestUploadExtWhitelist = "txt,png"
+		cfg.AppConfig.GuestUploadMaxMbSize = 1
+	})
+	ctx := context.Background()
+	r := gin.New()
+	r.PUT("/upload/:filename", func(c *gin.Context) {
+		if c.GetHeader("Test-Guest") == "" {
+			c.Set("user", admin)
+		}
+	}, RawUploadHandler(store, cfg, reg))
+	// put 上传 body，chunked 为 true 时不带 Content-Length，只能在接收完成后校验
+	put := func(target, body string, chunked, guest bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		if chunked {
+			req.Body = io.NopCloser(strings.NewReader(body))
+			req.ContentLength = -1
+		}
+		if guest {
+			req.Header.Set("Test-Guest", "1")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	resourceCount := func(user *model.User) int64 {
+		files, _, err := store.Resource.GetUsageByUser(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+	expectRejected := func(w *httptest.ResponseRecorder, status int, msg string) {
+		t.Helper()
+		if w.Code != status || !strings.Contains(w.Body.String(), msg) {
+			t.Fatalf("应返回 %d %s: %d %s", status, msg, w.Code, w.Body.String())
+		}
+	}
+
+	w := put("/upload/ok.txt?tags=ci", "artifact", false, false)
+	if w.Code != http.StatusOK || !strings.HasSuffix(w.Body.String(), "/r/"+w.Header().Get("Linkit-Share-Code")+"\n") {
+		t.Fatalf("上传应返回分享链接: %d %s", w.Code, w.Body.String())
+	}
+	if w := put("/upload/ok.json.txt?format=json", "artifact json", false, false); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"shareCode"`) {
+		t.Fatalf("format=json 时应返回 JSON: %d %s", w.Code, w.Body.String())
+	}
+	if n := resourceCount(admin); n != 2 {
+		t.Fatalf("应入库 2 个资源, got %d", n)
+	}
+
+	// 超过大小限制：带 Content-Length 时在接收前拒绝，分块传输时在接收后拒绝
+	big := strings.Repeat("x", int(cfg.MaxFileSize)+1)
+	expectRejected(put("/upload/big.txt", big, false, false), http.StatusBadRequest, "文件大小超过限制")
+	expectRejected(put("/upload/big.txt", big, true, false), http.StatusBadRequest, "文件大小超过限制")
+	if w := put("/upload/big.txt?format=json", big, false, false); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":400`) {
+		t.Fatalf("format=json 时错误应返回 JSON: %d %s", w.Code, w.Body.String())
+	}
+
+	// 配额不足：已用 2 个文件，再上传一个即超出
+	if _, err := store.User.UpdateQuota(ctx, admin.ID, 0, 2); err != nil {
+		t.Fatal(err)
+	}
+	expectRejected(put("/upload/quota.txt", "over quota", false, false), http.StatusForbidden, "文件数量已达上限")
+	expectRejected(put("/upload/quota.txt", "over quota", true, false), http.StatusForbidden, "文件数量已达上限")
+	if _, err := store.User.UpdateQuota(ctx, admin.ID, 30, 0); err != nil {
+		t.Fatal(err)
+	}
+	expectRejected(put("/upload/quota.txt", "more than the remaining bytes", true, false), http.StatusForbidden, "存储空间不足")
+	if n := resourceCount(admin); n != 2 {
+		t.Fatalf("被拒绝的上传不应入库, got %d", n)
+	}
+
+	// 访客按扩展名白名单限制
+	expectRejected(put("/upload/tool.exe", "MZ", false, true), http.StatusBadRequest, "请登录后再进行上传")
+	expectRejected(put("/upload/tool.exe", "MZ", true, true), http.StatusBadRequest, "请登录后再进行上传")
+	expectRejected(put("/upload/noext", "data", false, true), http.StatusBadRequest, "请登录后再进行上传")
+	if w := put("/upload/guest.txt", "guest text", false, true); w.Code != http.StatusOK {
+		t.Fatalf("白名单内的访客上传应成功: %d %s", w.Code, w.Body.String())
+	}
+	cfg.SetAppConfigValue("GUEST_UPLOAD_ENABLE", "false")
+	expectRejected(put("/upload/guest.txt", "guest text", false, true), http.StatusForbidden, "不允许访客上传")
+
+	// 被拒绝的上传不应留下临时文件
+	entries, err := os.ReadDir(cfg.MergeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("临时文件未清理: %d", len(entries))
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+)
+
+const (
+	defaultChunkSize = 8 * 1024 * 1024
+	minChunkSize     = 256 * 1024
+	maxChunkSize     = 100 * 1024 * 1024
+)
+
+var uploadSessionIDRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+type uploadSessionRequest struct {
+	Filename  string   `json:"filename"`
+	FileSize  int64    `json:"fileSize"`
+	ChunkSize int64    `json:"chunkSize"`
+	Tags      []string `json:"tags"`
+	PickIt    bool     `json:"pickIt"`
+	FileHash  string   `json:"fileHash"`
+}
+
+// CreateUploadSessionHandler 创建分片上传会话，由服务端生成不可猜测的 uploadId，
+// 之后的分片上传与进度查询只允许会话创建者访问。
+func CreateUploadSessionHandler(store *db.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req uploadSessionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("参数错误", 400))
+			return
+		}
+		user := uploadUser(c)
+		fileName := filepath.Base(strings.TrimSpace(req.Filename))
+		if fileName == "" || fileName == "." || fileName == "/" {
+			c.JSON(http.StatusBadRequest, Fail[any]("缺少文件名", 400))
+			return
+		}
+		if req.FileSize < 0 {
+			c.JSON(http.StatusBadRequest, Fail[any]("文件大小无效", 400))
+			return
+		}
+		chunkSize := req.ChunkSize
+		if chunkSize == 0 {
+			chunkSize = defaultChunkSize
+		}
+		if chunkSize < minChunkSize || chunkSize > maxChunkSize {
+			c.JSON(http.StatusBadRequest, Fail[any]("分片大小需在 256KB 到 100MB 之间", 400))
+			return
+		}
+		tags, err := db.ParseTagsFromStrings(req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
+			return
+		}
+		fileHash, ok := normalizeChecksum(req.FileHash)
+		if !ok {
+			c.JSON(http.StatusBadRequest, Fail[any]("校验值格式错误，需为 MD5 或 SHA-256 十六进制串", 400))
+			return
+		}
+		if !checkUploadAllowed(c, cfg, user, fileName, req.FileSize) {
+			return
+		}
+		// 按声明的文件大小预先校验配额，避免上传完才发现超限
+		if !checkUploadQuota(c, store, user, req.FileSize) {
+			return
+		}
+
+		id, err := randomHex(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("创建上传会话失败", 500))
+			return
+		}
+		totalChunks := (req.FileSize + chunkSize - 1) / chunkSize
+		if totalChunks == 0 {
+			totalChunks = 1
+		}
+		session := model.UploadSession{
+			ID:          id,
+			UserID:      user.ID,
+			Filename:    fileName,
+			FileSize:    req.FileSize,
+			ChunkSize:   chunkSize,
+			TotalChunks: totalChunks,
+			Tags:        strings.Join(tags, ","),
+			PickIt:      req.PickIt,
+			FileHash:    fileHash,
+			ExpiresAt:   time.Now().Add(cfg.UploadSessionTTL),
+		}
+		ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		if err := store.Upload.Create(ctx, &session); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("创建上传会话失败", 500))
+			return
+		}
+		store.Logger.Info("创建上传会话", "user", user.Username, "file", fileName, "size", req.FileSize, "chunks", totalChunks, "upload_id", id)
+		c.JSON(http.StatusOK, Ok(session, "ok"))
+	}
+}
+
+// loadUploadSession 读取上传会话并校验归属，不存在或不属于当前用户时返回 404，过期返回 410；
+// 失败时已写入错误响应。
+func loadUploadSession(c *gin.Context, store *db.DB, id string) (*model.UploadSession, bool) {
+	if !uploadSessionIDRegex.MatchString(id) {
+		c.JSON(http.StatusNotFound, Fail[any]("上传会话不存在", 404))
+		return nil, false
+	}
+	ctx, cancel := store.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	session, err := store.Upload.Get(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Fail[any]("读取上传会话失败", 500))
+		return nil, false
+	}
+	if session == nil || session.UserID != uploadUser(c).ID {
+		c.JSON(http.StatusNotFound, Fail[any]("上传会话不存在", 404))
+		return nil, false
+	}
+	if time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusGone, Fail[any]("上传会话已过期，请重新上传", 410))
+		return nil, false
+	}
+	return session, true
+}
+
+// expectedChunkSize 返回会话中第 index 个分片应有的大小，最后一个分片为剩余部分。
+func expectedChunkSize(session *model.UploadSession, index int64) int64 {
+	if index < session.TotalChunks-1 {
+		return session.ChunkSize
+	}
+	return session.FileSize - session.ChunkSize*(session.TotalChunks-1)
+}
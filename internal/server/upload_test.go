@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+)
+
+// newChunkUploadRouter 搭建以 user 身份调用的会话创建、分片上传与进度查询接口。
+func newChunkUploadRouter(store *db.DB, queue *FinalizeQueue, user *model.User) *gin.Engine {
+	r := gin.New()
+	asUser := func(c *gin.Context) { c.Set("user", user) }
+	r.POST("/upload/session", asUser, CreateUploadSessionHandler(store, queue.cfg))
+	r.POST("/upload", asUser, UploadHandler(store, queue.cfg, queue.reg, queue))
+	r.GET("/upload", asUser, UploadQueryHandler(store, queue.cfg, queue))
+	r.GET("/upload/:id/status", asUser, UploadStatusHandler(store, queue.cfg, queue))
+	return r
+}
+
+func createUploadSession(t *testing.T, r *gin.Engine, req uploadSessionRequest) model.UploadSession {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload/session", bytes.NewReader(body)))
+	var resp ApiResponse[model.UploadSession]
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+		t.Fatalf("创建上传会话失败: %d %s", w.Code, w.Body.String())
+	}
+	return resp.Data
+}
+
+// postUpload 以 multipart 表单上传 data，values 为附带的表单字段。
+func postUpload(r *gin.Engine, filename string, data []byte, values map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range values {
+		_ = mw.WriteField(k, v)
+	}
+	part, _ := mw.CreateFormFile(uploadField, filename)
+	_, _ = part.Write(data)
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func postChunk(r *gin.Engine, uploadID string, index int, data []byte, values map[string]string) *httptest.ResponseRecorder {
+	fields := map[string]string{"uploadId": uploadID, "chunkIndex": strconv.Itoa(index)}
+	for k, v := range values {
+		fields[k] = v
+	}
+	return postUpload(r, "chunk", data, fields)
+}
+
+func md5Sum(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadRejectsChecksumMismatch(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, nil)
+	queue := NewFinalizeQueue(store, cfg, reg)
+	r := newChunkUploadRouter(store, queue, admin)
+	ctx := context.Background()
+	isRetryable := func(w *httptest.ResponseRecorder) bool {
+		var resp ApiResponse[struct {
+			Retryable bool `json:"retryable"`
+		}]
+		return w.Code == http.StatusUnprocessableEntity && json.Unmarshal(w.Body.Bytes(), &resp) == nil && resp.Data.Retryable
+	}
+
+	data := bytes.Repeat([]byte("checksum-"), minChunkSize/8)[:minChunkSize+1000]
+	chunks := [][]byte{data[:minChunkSize], data[minChunkSize:]}
+	wrong := md5Sum([]byte("something else"))
+
+	// 分片校验值不符时返回可重试错误，且不保存该分片
+	session := createUploadSession(t, r, uploadSessionRequest{Filename: "chunked.bin", FileSize: int64(len(data)), ChunkSize: minChunkSize, FileHash: wrong})
+	if w := postChunk(r, session.ID, 0, chunks[0], map[string]string{"chunkHash": wrong}); !isRetryable(w) {
+		t.Fatalf("分片校验失败应返回 422 且可重试: %d %s", w.Code, w.Body.String())
+	}
+	if got := listChunks(filepath.Join(cfg.ChunkDir, session.ID)); len(got) != 0 {
+		t.Fatalf("校验失败的分片不应保留: %v", got)
+	}
+	sha := sha256.Sum256(chunks[0])
+	if w := postChunk(r, session.ID, 0, chunks[0], map[string]string{"chunkHash": hex.EncodeToString(sha[:])}); w.Code != http.StatusOK {
+		t.Fatalf("重新上传校验正确的分片应成功: %d %s", w.Code, w.Body.String())
+	}
+	if w := postChunk(r, session.ID, 1, chunks[1], map[string]string{"chunkHash": md5Sum(chunks[1])}); w.Code != http.StatusAccepted {
+		t.Fatalf("分片到齐后应交给后台合并: %d %s", w.Code, w.Body.String())
+	}
+
+	// 合并后的文件与会话声明的完整文件校验值不符时直接标记失败，不入库
+	queue.process(ctx, session.ID)
+	failed, err := store.Upload.Get(ctx, session.ID)
+	if err != nil || failed == nil || failed.Status != db.UploadStatusFailed || failed.Error != errFileChecksum.Msg || failed.ResourceID != 0 {
+		t.Fatalf("完整文件校验失败应标记会话失败: %+v %v", failed, err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.ChunkDir, session.ID)); !os.IsNotExist(err) {
+		t.Fatal("校验失败后应删除分片")
+	}
+
+	// 小文件直传同样校验完整文件
+	small := []byte("small file")
+	if w := postUpload(r, "small.txt", small, map[string]string{"fileHash": wrong}); !isRetryable(w) {
+		t.Fatalf("直传校验失败应返回 422 且可重试: %d %s", w.Code, w.Body.String())
+	}
+	if files, _, err := store.Resource.GetUsageByUser(ctx, admin.ID); err != nil || files != 0 {
+		t.Fatalf("校验失败的上传不应入库: %d %v", files, err)
+	}
+
+	// 校验值正确时正常入库
+	if w := postUpload(r, "small.txt", small, map[string]string{"fileHash": md5Sum(small)}); w.Code != http.StatusOK {
+		t.Fatalf("校验通过的直传应成功: %d %s", w.Code, w.Body.String())
+	}
+	session = createUploadSession(t, r, uploadSessionRequest{Filename: "chunked.bin", FileSize: int64(len(data)), ChunkSize: minChunkSize, FileHash: md5Sum(data)})
+	for i, chunk := range chunks {
+		postChunk(r, session.ID, i, chunk, nil)
+	}
+	queue.process(ctx, session.ID)
+	if done, _ := store.Upload.Get(ctx, session.ID); done == nil || done.Status != db.UploadStatusDone || done.ResourceID == 0 {
+		t.Fatalf("校验通过的分片上传应完成入库: %+v", done)
+	}
+}
+
+func TestUploadSessionOwnership(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, nil)
+	queue := NewFinalizeQueue(store, cfg, reg)
+	ctx := context.Background()
+	bob := &model.User{Username: "bob", Password: "x", Email: "bob@example.com", Nickname: "bob"}
+	if err := store.Client.Create(bob).Error; err != nil {
+		t.Fatal(err)
+	}
+	guest, err := store.User.GetByID(ctx, db.GuestUserID)
+	if err != nil || guest == nil {
+		t.Fatalf("读取访客失败: %v", err)
+	}
+	owner := newChunkUploadRouter(store, queue, admin)
+	get := func(r *gin.Engine, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	data := bytes.Repeat([]byte("o"), minChunkSize+10)
+	session := createUploadSession(t, owner, uploadSessionRequest{Filename: "owned.bin", FileSize: int64(len(data)), ChunkSize: minChunkSize})
+	other := createUploadSession(t, owner, uploadSessionRequest{Filename: "owned.bin", FileSize: int64(len(data)), ChunkSize: minChunkSize})
+	if !uploadSessionIDRegex.MatchString(session.ID) || session.ID == other.ID {
+		t.Fatalf("会话 ID 应由服务端随机生成: %s %s", session.ID, other.ID)
+	}
+	if saved, err := store.Upload.Get(ctx, session.ID); err != nil || saved == nil || saved.UserID != admin.ID {
+		t.Fatalf("会话应记录创建者: %+v %v", saved, err)
+	}
+
+	// 其他用户与访客无法查询或写入他人的会话，返回与不存在相同的 404
+	for _, user := range []*model.User{bob, guest} {
+		r := newChunkUploadRouter(store, queue, user)
+		if w := get(r, "/upload?uploadId="+session.ID); w.Code != http.StatusNotFound {
+			t.Fatalf("%s 查询他人会话应返回 404: %d", user.Username, w.Code)
+		}
+		if w := get(r, "/upload/"+session.ID+"/status"); w.Code != http.StatusNotFound {
+			t.Fatalf("%s 查询他人会话进度应返回 404: %d", user.Username, w.Code)
+		}
+		if w := postChunk(r, session.ID, 0, data[:minChunkSize], nil); w.Code != http.StatusNotFound {
+			t.Fatalf("%s 向他人会话写入分片应返回 404: %d", user.Username, w.Code)
+		}
+	}
+	if got := listChunks(filepath.Join(cfg.ChunkDir, session.ID)); len(got) != 0 {
+		t.Fatalf("被拒绝的请求不应写入分片: %v", got)
+	}
+	// 客户端自选的 uploadId 不再被接受
+	if w := postChunk(owner, "my-upload", 0, data[:minChunkSize], nil); w.Code != http.StatusNotFound {
+		t.Fatalf("未经创建的会话应返回 404: %d", w.Code)
+	}
+
+	if w := postChunk(owner, session.ID, 0, data[:minChunkSize], nil); w.Code != http.StatusOK {
+		t.Fatalf("创建者上传分片应成功: %d %s", w.Code, w.Body.String())
+	}
+	w := get(owner, "/upload?uploadId="+session.ID)
+	var resp ApiResponse[struct {
+		Uploaded []int64 `json:"uploaded"`
+	}]
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || len(resp.Data.Uploaded) != 1 || resp.Data.Uploaded[0] != 0 {
+		t.Fatalf("创建者应能查询已上传的分片: %d %s", w.Code, w.Body.String())
+	}
+
+	// 过期的会话对创建者返回 410
+	if err := store.Client.Model(&model.UploadSession{}).Where("id = ?", session.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := postChunk(owner, session.ID, 1, data[minChunkSize:], nil); w.Code != http.StatusGone {
+		t.Fatalf("过期会话应返回 410: %d", w.Code)
+	}
+}
+
+func TestConcurrentFinalizeClaimsOnce(t *testing.T) {
+	store, cfg, reg, admin := newTestEnv(t, nil)
+	queue := NewFinalizeQueue(store, cfg, reg)
+	ctx := context.Background()
+
+	// 并发抢占同一会话时只有一个请求成功
+	claimed := &model.UploadSession{ID: "claim", UserID: admin.ID, Filename: "claim.txt", TotalChunks: 1, Status: db.UploadStatusUploading, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.Upload.Create(ctx, claimed); err != nil {
+		t.Fatal(err)
+	}
+	const claimers = 8
+	start := make(chan struct{})
+	results := make(chan error, claimers)
+	var winners atomic.Int32
+	for i := 0; i < claimers; i++ {
+		go func() {
+			<-start
+			ok, err := store.Upload.ClaimFinalize(ctx, "claim", "")
+			if ok {
+				winners.Add(1)
+			}
+			results <- err
+		}()
+	}
+	close(start)
+	for i := 0; i < claimers; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("ClaimFinalize: %v", err)
+		}
+	}
+	if n := winners.Load(); n != 1 {
+		t.Fatalf("应只有一个请求抢占成功, got %d", n)
+	}
+	if session, _ := store.Upload.Get(ctx, "claim"); session == nil || session.Status != db.UploadStatusFinalizing {
+		t.Fatalf("抢占后会话应为 finalizing: %+v", session)
+	}
+
+	// 最后两个分片并发到达时只创建一个资源，之后的重复请求返回同一结果
+	r := newChunkUploadRouter(store, queue, admin)
+	data := bytes.Repeat([]byte("f"), minChunkSize+10)
+	session := createUploadSession(t, r, uploadSessionRequest{Filename: "parallel.bin", FileSize: int64(len(data)), ChunkSize: minChunkSize})
+	chunks := [][]byte{data[:minChunkSize], data[minChunkSize:]}
+	var wg sync.WaitGroup
+	codes := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk []byte) {
+			defer wg.Done()
+			codes[i] = postChunk(r, session.ID, i, chunk, nil).Code
+		}(i, chunk)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK && code != http.StatusAccepted {
+			t.Fatalf("分片 %d 上传失败: %d", i, code)
+		}
+	}
+	queue.process(ctx, session.ID)
+	queue.process(ctx, session.ID)
+	done, err := store.Upload.Get(ctx, session.ID)
+	if err != nil || done == nil || done.Status != db.UploadStatusDone {
+		t.Fatalf("合并后会话应完成: %+v %v", done, err)
+	}
+	if files, _, err := store.Resource.GetUsageByUser(ctx, admin.ID); err != nil || files != 1 {
+		t.Fatalf("并发完成只应创建一个资源, got %d %v", files, err)
+	}
+	w := postChunk(r, session.ID, 1, chunks[1], nil)
+	var resp ApiResponse[uploadResponse]
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || !resp.Data.Merged ||
+		resp.Data.ResourceID != done.ResourceID || resp.Data.ShareCode != done.ShareCode {
+		t.Fatalf("重复的完成请求应返回已创建的资源: %d %s", w.Code, w.Body.String())
+	}
+}
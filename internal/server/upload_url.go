@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/storage"
+)
+
+const maxFetchRedirects = 5
+
+var errPrivateAddress = errors.New("不允许访问内网地址")
+
+// 除 netip 自带判断外需要额外拦截的保留网段
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+type urlUploadRequest struct {
+	URL      string   `json:"url"`
+	Filename string   `json:"filename"`
+	Tags     []string `json:"tags"`
+	PickIt   bool     `json:"pickIt"`
+}
+
+// UploadFromURLHandler 由服务端下载链接指向的文件，按普通上传的流程识别类型并入库。
+func UploadFromURLHandler(store *db.DB, cfg *config.Config, reg *storage.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appCfg := cfg.GetAppConfig()
+		if !appCfg.URLUploadEnable {
+			c.JSON(http.StatusForbidden, Fail[any]("未开启链接上传", 403))
+			return
+		}
+		var req urlUploadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("参数错误", 400))
+			return
+		}
+		target, err := url.Parse(strings.TrimSpace(req.URL))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			c.JSON(http.StatusBadRequest, Fail[any]("链接无效，仅支持 http/https", 400))
+			return
+		}
+		tags, err := db.ParseTagsFromStrings(req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any](err.Error(), 400))
+			return
+		}
+		if err := ensureDir(cfg.MergeDir); err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("准备目录失败", 500))
+			return
+		}
+		user := uploadUser(c)
+		maxSize := cfg.MaxFileSize
+		if limit := int64(appCfg.URLUploadMaxMbSize) * 1024 * 1024; limit > 0 && limit < maxSize {
+			maxSize = limit
+		}
+		timeout := time.Duration(appCfg.URLUploadTimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = 60 * time.Second
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Fail[any]("链接无效", 400))
+			return
+		}
+		httpReq.Header.Set("User-Agent", "Linkit")
+		resp, err := newFetchClient(appCfg.URLUploadAllowPrivate).Do(httpReq)
+		if err != nil {
+			reg.Logger.Warn("下载链接失败", "url", target.Redacted(), "err", err)
+			writeFetchError(c, err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			c.JSON(http.StatusBadGateway, Fail[any](fmt.Sprintf("下载失败，源站返回 %d", resp.StatusCode), 502))
+			return
+		}
+		if resp.ContentLength > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, Fail[any]("文件大小超过限制", 413))
+			return
+		}
+		if resp.ContentLength > 0 && !checkUploadQuota(c, store, user, resp.ContentLength) {
+			return
+		}
+
+		tmp, err := os.CreateTemp(cfg.MergeDir, "url-*")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("创建临时文件失败", 500))
+			return
+		}
+		tmpPath := tmp.Name()
+		defer os.Remove(tmpPath)
+		written, err := io.Copy(tmp, io.LimitReader(resp.Body, maxSize+1))
+		tmp.Close()
+		if err != nil {
+			reg.Logger.Warn("下载链接失败", "url", target.Redacted(), "err", err)
+			writeFetchError(c, err)
+			return
+		}
+		if written > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, Fail[any]("文件大小超过限制", 413))
+			return
+		}
+
+		fileName, err := fetchedFileName(req.Filename, resp, tmpPath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Fail[any]("读取文件失败", 500))
+			return
+		}
+		if !checkUploadAllowed(c, cfg, user, fileName, written) {
+			return
+		}
+		reg.Logger.Info("链接下载完成", "user", user.Username, "url", target.Redacted(), "file", fileName, "size", written)
+		result, err := finalizeMergedFile(c.Request.Context(), store, cfg, reg, user, tmpPath, mergedUpload{Filename: fileName, Tags: tags, PickIt: req.PickIt})
+		if err != nil {
+			writeUploadError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, Ok(result, "ok"))
+	}
+}
+
+// newFetchClient 创建下载外部链接的 HTTP 客户端。未允许内网访问时，在建立连接前校验解析出的实际 IP，
+// 重定向与 DNS 重绑定同样会被拦截；不使用系统代理，以免绕过校验。
+func newFetchClient(allowPrivate bool) *http.Client {
+	if allowPrivate {
+		return fetchClient(nil)
+	}
+	return fetchClient(isPrivateAddr)
+}
+
+// fetchClient blocked 不为空时，拒绝连接其判定为 true 的地址。
+func fetchClient(blocked func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if blocked != nil {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil || blocked(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return errors.New("重定向次数过多")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("不支持的重定向地址")
+			}
+			return nil
+		},
+	}
+}
+
+// isPrivateAddr 判断地址是否为回环、内网、链路本地等非公网地址。
+func isPrivateAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFetchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errPrivateAddress):
+		c.JSON(http.StatusBadRequest, Fail[any](errPrivateAddress.Error(), 400))
+	case errors.Is(err, context.DeadlineExceeded), os.IsTimeout(err):
+		c.JSON(http.StatusGatewayTimeout, Fail[any]("下载超时", 504))
+	default:
+		c.JSON(http.StatusBadGateway, Fail[any]("下载失败", 502))
+	}
+}
+
+// fetchedFileName 依次使用请求参数、Content-Disposition 与链接路径中的文件名，
+// 没有扩展名时按文件内容补全，以便后续类型识别与白名单校验。
+func fetchedFileName(requested string, resp *http.Response, localPath string) (string, error) {
+	name := strings.TrimSpace(requested)
+	if name == "" {
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+			name = params["filename"]
+		}
+	}
+	if name == "" {
+		name = path.Base(resp.Request.URL.Path)
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "" || name == "." || name == "/" {
+		name = "download"
+	}
+	if filepath.Ext(name) != "" {
+		return name, nil
+	}
+	head, err := readFileHead(localPath)
+	if err != nil {
+		return "", err
+	}
+	return name + storage.SniffExt(head), nil
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+func TestFetchClientBlocksLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secret")
+	}))
+	defer srv.Close()
+
+	_, err := newFetchClient(false).Get(srv.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("访问回环地址应被拦截, got %v", err)
+	}
+
+	resp, err := newFetchClient(true).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("允许内网访问时应放行: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secret" {
+		t.Fatalf("响应内容不一致: %q", body)
+	}
+}
+
+func TestFetchClientBlocksRedirectToPrivate(t *testing.T) {
+	// 127.0.0.2 模拟内网地址，127.0.0.1 模拟公网源站
+	ln, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("无法监听 127.0.0.2: %v", err)
+	}
+	internal := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "internal")
+	}))
+	internal.Listener.Close()
+	internal.Listener = ln
+	internal.Start()
+	defer internal.Close()
+
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/admin", http.StatusFound)
+	}))
+	defer public.Close()
+
+	blocked := func(ip netip.Addr) bool { return ip != netip.MustParseAddr("127.0.0.1") }
+	_, err = fetchClient(blocked).Get(public.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("重定向到内网地址应被拦截, got %v", err)
+	}
+}
+
+func TestIsPrivateAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"2606:4700::1111": false,
+	} {
+		if got := isPrivateAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPrivateAddr(%s) = %v, 期望 %v", addr, got, want)
+		}
+	}
+}
+
+// newTestEnv 使用临时目录中的数据库、本地存储、分片与合并目录初始化配置与数据库，返回管理员账户。
+func newTestEnv(t *testing.T, edit func(*config.Config)) (*db.DB, *config.Config, *storage.Registry, *model.User) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "app.db"))
+	t.Setenv("LOCAL_STORAGE_ROOT", filepath.Join(dir, "storage"))
+	t.Setenv("CHUNK_DIR", filepath.Join(dir, "chunk"))
+	t.Setenv("MERGE_DIR", filepath.Join(dir, "merged"))
+	cfg := config.Load()
+	if edit != nil {
+		edit(&cfg)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := db.NewStore(cfg, logger, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := storage.SetupRegistry(cfg, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := store.User.GetByID(context.Background(), cfg.AdminUserId)
+	if err != nil || admin == nil {
+		t.Fatalf("读取管理员失败: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	return store, &cfg, reg, admin
+}
+
+// newURLUploadRouter 搭建使用临时数据库与本地存储的链接上传接口，请求以管理员身份发起。
+func newURLUploadRouter(t *testing.T, edit func(*config.Config)) *gin.Engine {
+	t.Helper()
+	store, cfg, reg, admin := newTestEnv(t, func(cfg *config.Config) {
+		cfg.AppConfig.URLUploadEnable = true
+		cfg.AppConfig.URLUploadAllowPrivate = true
+		edit(cfg)
+	})
+	r := gin.New()
+	r.POST("/upload/url", func(c *gin.Context) { c.Set("user", admin) }, UploadFromURLHandler(store, cfg, reg))
+	return r
+}
+
+func postURLUpload(r *gin.Engine, target string) (*httptest.ResponseRecorder, ApiResponse[uploadResponse]) {
+	body, _ := json.Marshal(urlUploadRequest{URL: target})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload/url", strings.NewReader(string(body))))
+	var resp ApiResponse[uploadResponse]
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestUploadFromURL(t *testing.T) {
+	content := strings.Repeat("linkit", 100)
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file.txt":
+			io.WriteString(w, content)
+		case "/big-declared":
+			w.Header().Set("Content-Length", strconv.Itoa(2<<20))
+			w.WriteHeader(http.StatusOK)
+		case "/big-chunked":
+			// 不声明长度，边下载边检查大小
+			for i := 0; i < 3; i++ {
+				w.Write(make([]byte, 1<<20))
+				w.(http.Flusher).Flush()
+			}
+		case "/slow":
+			time.Sleep(2 * time.Second)
+			io.WriteString(w, "late")
+		}
+	}))
+	defer src.Close()
+
+	r := newURLUploadRouter(t, func(cfg *config.Config) {
+		cfg.AppConfig.URLUploadMaxMbSize = 1
+		cfg.AppConfig.URLUploadTimeoutSeconds = 1
+	})
+
+	w, resp := postURLUpload(r, src.URL+"/file.txt")
+	if w.Code != http.StatusOK || resp.Data.ShareCode == "" {
+		t.Fatalf("允许内网访问时应下载成功: %d %s", w.Code, w.Body.String())
+	}
+	if resp.Data.Filename != "file.txt" || resp.Data.Size != int64(len(content)) {
+		t.Fatalf("上传结果不符合预期: %+v", resp.Data)
+	}
+
+	for _, path := range []string{"/big-declared", "/big-chunked"} {
+		if w, _ := postURLUpload(r, src.URL+path); w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: 超过大小限制应返回 413, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	if w, _ := postURLUpload(r, src.URL+"/slow"); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("下载超时应返回 504, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUploadFromURLBlocksPrivateByDefault(t *testing.T) {
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secret")
+	}))
+	defer src.Close()
+
+	r := newURLUploadRouter(t, func(cfg *config.Config) {
+		cfg.AppConfig.URLUploadAllowPrivate = false
+	})
+	if w, _ := postURLUpload(r, src.URL+"/file.txt"); w.Code != http.StatusBadRequest {
+		t.Fatalf("默认应拒绝访问内网地址, got %d %s", w.Code, w.Body.String())
+	}
+}
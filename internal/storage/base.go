@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -17,21 +18,101 @@ import (
 type BucketPlatform string
 
 const (
-	PlatformLocal BucketPlatform = "local"
-	PlatformS3    BucketPlatform = "s3"
+	PlatformLocal  BucketPlatform = "local"
+	PlatformS3     BucketPlatform = "s3"
+	PlatformWebDAV BucketPlatform = "webdav"
+	PlatformSFTP   BucketPlatform = "sftp"
 )
 
+// ErrObjectNotFound 表示存储路径对应的对象不存在。
+var ErrObjectNotFound = errors.New("存储对象不存在")
+
+// ErrURLUnsupported 表示驱动无法生成可直接访问的链接，下载需经服务端转发。
+var ErrURLUnsupported = errors.New("存储驱动不支持直链访问")
+
+// ObjectInfo 描述存储对象的基础元信息，用于生成 ETag/Last-Modified 等响应头。
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+	// ETag 为存储端返回的实体标签（去除引号），驱动不支持时为空。
+	ETag string
+}
+
 type Storage interface {
 	Platform() BucketPlatform
+	// Bucket 返回写入存储路径的桶标识，本地存储为空。
+	Bucket() string
 	Write(objectKey string, r io.Reader, size int64, contentType string) (string, error)
 	GetURL(storedPath string, expires time.Duration) (string, error)
+	// Open 以流的方式读取对象，区间为闭区间 [rangeStart, rangeEnd]；rangeEnd < 0 表示读到末尾。
+	Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error)
+	Stat(storedPath string) (ObjectInfo, error)
 	Delete(storedPath string) error
 }
 
+// UploadedPart 描述客户端直传完成的一个 multipart 分片。
+type UploadedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+// DirectUploader 由支持浏览器直传（预签名上传）的存储驱动实现。
+type DirectUploader interface {
+	StoredPath(objectKey string) (string, error)
+	PresignPut(objectKey, contentType string, size int64, expires time.Duration) (string, error)
+	CreateMultipart(objectKey, contentType string) (string, error)
+	PresignUploadPart(objectKey, uploadID string, partNumber int32, expires time.Duration) (string, error)
+	CompleteMultipart(objectKey, uploadID string, parts []UploadedPart) error
+	AbortMultipart(objectKey, uploadID string) error
+}
+
+// DownloadOptions 覆盖下载直链的响应头，为空的字段保持存储端默认值。
+type DownloadOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// DownloadURLer 由能在直链中覆盖响应头的驱动实现，用于强制以附件下载，
+// 避免浏览器在存储域名下内联渲染上传的 HTML、SVG 等内容。
+type DownloadURLer interface {
+	GetDownloadURL(storedPath string, expires time.Duration, opts DownloadOptions) (string, error)
+}
+
+// ContextReader 由支持随请求取消读取的驱动实现，客户端断开后不再继续从远端拉取数据。
+type ContextReader interface {
+	OpenContext(ctx context.Context, storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error)
+	StatContext(ctx context.Context, storedPath string) (ObjectInfo, error)
+}
+
+// OpenContext 驱动实现 ContextReader 时随 ctx 取消读取，否则退化为 Open。
+func OpenContext(ctx context.Context, stg Storage, storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	if cr, ok := stg.(ContextReader); ok {
+		return cr.OpenContext(ctx, storedPath, rangeStart, rangeEnd)
+	}
+	return stg.Open(storedPath, rangeStart, rangeEnd)
+}
+
+// StatContext 驱动实现 ContextReader 时随 ctx 取消请求，否则退化为 Stat。
+func StatContext(ctx context.Context, stg Storage, storedPath string) (ObjectInfo, error) {
+	if cr, ok := stg.(ContextReader); ok {
+		return cr.StatContext(ctx, storedPath)
+	}
+	return stg.Stat(storedPath)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Registry 按存储名管理驱动：内置驱动以平台名（local/s3/...）注册，
+// 命名存储配置以配置名注册。
 type Registry struct {
 	mu            sync.RWMutex
-	DefaultDriver BucketPlatform
-	Storages      map[BucketPlatform]Storage
+	DefaultDriver string
+	Storages      map[string]Storage
+	Profiles      []Profile
+	Rules         []RoutingRule
 	Logger        *slog.Logger
 }
 
@@ -41,6 +122,10 @@ func NormalizeDriver(driver string) (BucketPlatform, error) {
 		return PlatformLocal, nil
 	case "s3", "cloudflare":
 		return PlatformS3, nil
+	case "webdav":
+		return PlatformWebDAV, nil
+	case "sftp":
+		return PlatformSFTP, nil
 	default:
 		return "", fmt.Errorf("无效的存储驱动: %s", driver)
 	}
@@ -72,116 +157,305 @@ func NormalizeObjectKey(key string) (string, error) {
 	return clean, nil
 }
 
+// StoredPathFor 生成对象写入名为 name 的存储后的路径：内置驱动沿用旧格式，命名配置带配置名。
+func StoredPathFor(name string, stg Storage, objectKey string) (string, error) {
+	profile := name
+	if _, err := NormalizeDriver(name); err == nil {
+		profile = ""
+	}
+	return BuildProfilePath(stg.Platform(), profile, stg.Bucket(), objectKey)
+}
+
 func BuildStoredPath(platform BucketPlatform, bucket, objectKey string) (string, error) {
+	return BuildProfilePath(platform, "", bucket, objectKey)
+}
+
+// BuildProfilePath 生成带存储配置名的路径，如 s3+archive:bucket@/key；
+// profile 为空时与 BuildStoredPath 一致，保持旧路径格式不变。
+func BuildProfilePath(platform BucketPlatform, profile, bucket, objectKey string) (string, error) {
 	key, err := NormalizeObjectKey(objectKey)
 	if err != nil {
 		return "", err
 	}
-	if platform == PlatformLocal {
+	if platform == PlatformLocal && profile == "" {
 		return fmt.Sprintf("local@/%s", key), nil
 	}
-	return fmt.Sprintf("%s:%s@/%s", platform, bucket, key), nil
+	prefix := string(platform)
+	if profile != "" {
+		prefix += "+" + profile
+	}
+	return fmt.Sprintf("%s:%s@/%s", prefix, bucket, key), nil
 }
 
 func ParseStoredPath(storedPath string) (platform BucketPlatform, bucket string, key string, err error) {
+	platform, _, bucket, key, err = ParseProfilePath(storedPath)
+	return platform, bucket, key, err
+}
+
+// ParseProfilePath 解析存储路径，额外返回写入时使用的存储配置名（旧路径为空）。
+func ParseProfilePath(storedPath string) (platform BucketPlatform, profile string, bucket string, key string, err error) {
 	if storedPath == "" {
-		return "", "", "", errors.New("空存储路径")
+		return "", "", "", "", errors.New("空存储路径")
 	}
 	if strings.HasPrefix(storedPath, "local@/") {
 		key = strings.TrimPrefix(storedPath, "local@/")
 		key, err = NormalizeObjectKey(key)
-		return PlatformLocal, "", key, err
+		return PlatformLocal, "", "", key, err
 	}
 	parts := strings.SplitN(storedPath, "@/", 2)
 	if len(parts) != 2 {
-		return "", "", "", fmt.Errorf("存储路径格式错误")
+		return "", "", "", "", fmt.Errorf("存储路径格式错误")
 	}
 	prefix := parts[0]
 	key, err = NormalizeObjectKey(parts[1])
 	if err != nil {
-		return "", "", "", err
+		return "", "", "", "", err
 	}
 	prefixParts := strings.SplitN(prefix, ":", 2)
 	if len(prefixParts) != 2 {
-		return "", "", "", fmt.Errorf("存储路径格式错误")
+		return "", "", "", "", fmt.Errorf("存储路径格式错误")
 	}
-	p, err := NormalizeDriver(prefixParts[0])
+	driver, profile, _ := strings.Cut(prefixParts[0], "+")
+	p, err := NormalizeDriver(driver)
 	if err != nil {
-		return "", "", "", err
+		return "", "", "", "", err
 	}
-	return p, prefixParts[1], key, nil
+	return p, profile, prefixParts[1], key, nil
 }
 
-func buildStorages(cfg config.Config, logger *slog.Logger) (BucketPlatform, map[BucketPlatform]Storage, error) {
-	platform, err := NormalizeDriver(cfg.AppConfig.StorageDriver)
-	if err != nil {
-		return "", nil, err
+// buildStorages 构建内置驱动（以平台名注册）与数据库中的命名存储配置，返回默认存储名与路由规则。
+func buildStorages(cfg config.Config, profiles []Profile, logger *slog.Logger) (string, map[string]Storage, []RoutingRule, error) {
+	if err := ValidateKeyTemplate(cfg.AppConfig.StorageKeyTemplate); err != nil {
+		return "", nil, nil, err
 	}
-	storages := make(map[BucketPlatform]Storage)
+	storages := make(map[string]Storage)
 
 	local, err := NewLocal(cfg.LocalRoot)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
-	storages[PlatformLocal] = local
+	storages[string(PlatformLocal)] = local
+
+	driver := CanonicalProfile(cfg.AppConfig.StorageDriver)
+	platform, driverErr := NormalizeDriver(driver)
 
 	if platform == PlatformS3 || (cfg.AppConfig.S3Bucket != "" && cfg.AppConfig.S3AccessKey != "" && cfg.AppConfig.S3SecretKey != "" && cfg.AppConfig.S3Endpoint != "") {
-		s3, err := NewS3(cfg, logger)
+		s3, err := newDriver(PlatformS3, "", cfg, logger)
 		if err != nil {
-			return "", nil, err
+			return "", nil, nil, err
 		}
-		storages[PlatformS3] = s3
+		storages[string(PlatformS3)] = s3
 	}
 	if platform == PlatformS3 {
-		if _, ok := storages[PlatformS3]; !ok {
-			return "", nil, fmt.Errorf("已选择 S3 存储驱动，但缺少必要配置")
+		if _, ok := storages[string(PlatformS3)]; !ok {
+			return "", nil, nil, fmt.Errorf("已选择 S3 存储驱动，但缺少必要配置")
+		}
+	}
+
+	if platform == PlatformWebDAV || strings.TrimSpace(cfg.AppConfig.WebDAVURL) != "" {
+		webdav, err := newDriver(PlatformWebDAV, "", cfg, logger)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		storages[string(PlatformWebDAV)] = webdav
+	}
+
+	if platform == PlatformSFTP || strings.TrimSpace(cfg.AppConfig.SFTPHost) != "" {
+		sftp, err := newDriver(PlatformSFTP, "", cfg, logger)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		storages[string(PlatformSFTP)] = sftp
+	}
+
+	for _, p := range profiles {
+		stg, err := BuildProfile(cfg, p, logger)
+		if err != nil {
+			return "", nil, nil, err
 		}
+		storages[p.Name] = stg
+	}
+
+	if err := applyEncryption(cfg, storages); err != nil {
+		return "", nil, nil, err
+	}
+	if err := applyMirrors(cfg, storages, logger); err != nil {
+		return "", nil, nil, err
 	}
-	return platform, storages, nil
+
+	name := driver
+	if _, ok := storages[driver]; !ok {
+		if driverErr != nil {
+			return "", nil, nil, driverErr
+		}
+		name = string(platform)
+	}
+
+	rules, err := ParseRoutingRules(cfg.AppConfig.StorageRoutingRules)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if err := ValidateRoutingRules(rules, storages); err != nil {
+		return "", nil, nil, err
+	}
+	return name, storages, rules, nil
 }
 
-func SetupRegistry(cfg config.Config, logger *slog.Logger) (*Registry, error) {
-	platform, storages, err := buildStorages(cfg, logger)
+func SetupRegistry(cfg config.Config, profiles []Profile, logger *slog.Logger) (*Registry, error) {
+	name, storages, rules, err := buildStorages(cfg, profiles, logger)
 	if err != nil {
 		return nil, err
 	}
 	reg := &Registry{
-		DefaultDriver: platform,
+		DefaultDriver: name,
 		Storages:      storages,
+		Profiles:      profiles,
+		Rules:         rules,
 		Logger:        logger,
 	}
-	logger.Info(fmt.Sprintf("初始化 Storage 成功，%s", platform))
+	logger.Info(fmt.Sprintf("初始化 Storage 成功，%s", name), "profiles", len(profiles), "rules", len(rules))
 	return reg, nil
 }
 
 func (r *Registry) Reload(cfg config.Config) error {
-	platform, storages, err := buildStorages(cfg, r.Logger)
+	r.mu.RLock()
+	profiles := r.Profiles
+	r.mu.RUnlock()
+	return r.ReloadProfiles(cfg, profiles)
+}
+
+// ReloadProfiles 使用新的存储配置列表重建全部驱动。连接配置未变化的驱动沿用旧实例，
+// 被替换的驱动在进行中的读写结束后再断开连接，热更新不会中断正在进行的上传与下载。
+func (r *Registry) ReloadProfiles(cfg config.Config, profiles []Profile) error {
+	name, storages, rules, err := buildStorages(cfg, profiles, r.Logger)
 	if err != nil {
 		return err
 	}
 	r.mu.Lock()
-	r.DefaultDriver = platform
+	old := r.Storages
+	kept := reuseDrivers(storages, old)
+	r.DefaultDriver = name
 	r.Storages = storages
+	r.Profiles = profiles
+	r.Rules = rules
 	r.mu.Unlock()
-	r.Logger.Info("存储配置热更新成功", "driver", platform)
+	for _, stg := range driversOf(old) {
+		if !kept[stg] {
+			closeDriver(stg, r.Logger)
+		}
+	}
+	r.Logger.Info("存储配置热更新成功", "driver", name, "profiles", len(profiles), "rules", len(rules))
 	return nil
 }
 
 func (r *Registry) Validate(cfg config.Config) error {
-	_, _, err := buildStorages(cfg, r.Logger)
+	r.mu.RLock()
+	profiles := r.Profiles
+	r.mu.RUnlock()
+	return r.ValidateProfiles(cfg, profiles)
+}
+
+func (r *Registry) ValidateProfiles(cfg config.Config, profiles []Profile) error {
+	_, storages, _, err := buildStorages(cfg, profiles, r.Logger)
+	for _, stg := range driversOf(storages) {
+		closeDriver(stg, r.Logger)
+	}
 	return err
 }
 
+// unwrapDriver 展开加密与镜像装饰器，对每个底层驱动调用 fn，fn 的返回值替换该驱动。
+func unwrapDriver(stg Storage, fn func(Storage) Storage) Storage {
+	switch s := stg.(type) {
+	case *EncryptedStorage:
+		s.inner = unwrapDriver(s.inner, fn)
+		return s
+	case *MirrorStorage:
+		s.primary = unwrapDriver(s.primary, fn)
+		s.secondary = unwrapDriver(s.secondary, fn)
+		return s
+	case nil:
+		return nil
+	default:
+		return fn(s)
+	}
+}
+
+// driversOf 返回存储表中去重后的底层驱动。
+func driversOf(storages map[string]Storage) []Storage {
+	seen := make(map[Storage]bool)
+	var drivers []Storage
+	for _, stg := range storages {
+		unwrapDriver(stg, func(d Storage) Storage {
+			if !seen[d] {
+				seen[d] = true
+				drivers = append(drivers, d)
+			}
+			return d
+		})
+	}
+	return drivers
+}
+
+// reuseDrivers 将 next 中连接配置未变化的 SFTP 驱动替换为 old 中的实例，返回被沿用的旧驱动。
+// 新建的 SFTP 驱动在首次读写时才拨号，替换后直接丢弃即可。
+func reuseDrivers(next, old map[string]Storage) map[Storage]bool {
+	var candidates []*SFTPStorage
+	for _, d := range driversOf(old) {
+		if s, ok := d.(*SFTPStorage); ok {
+			candidates = append(candidates, s)
+		}
+	}
+	kept := make(map[Storage]bool)
+	replaced := make(map[*SFTPStorage]*SFTPStorage)
+	for name, stg := range next {
+		next[name] = unwrapDriver(stg, func(d Storage) Storage {
+			s, ok := d.(*SFTPStorage)
+			if !ok {
+				return d
+			}
+			if prev, ok := replaced[s]; ok {
+				return prev
+			}
+			for _, prev := range candidates {
+				if !kept[prev] && prev.sameSettings(s) {
+					kept[prev] = true
+					replaced[s] = prev
+					return prev
+				}
+			}
+			replaced[s] = s
+			return s
+		})
+	}
+	return kept
+}
+
+// closeDriver 关闭驱动持有的连接（如 SFTP），进行中的读写由驱动自行等待结束。
+func closeDriver(stg Storage, logger *slog.Logger) {
+	if c, ok := stg.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			logger.Warn("关闭存储驱动失败", "platform", stg.Platform(), "bucket", stg.Bucket(), "err", err)
+		}
+	}
+}
+
+// CurrentDriver 返回默认存储所属的平台。
 func (r *Registry) CurrentDriver() BucketPlatform {
+	return r.Active().Platform()
+}
+
+// ActiveProfile 返回默认存储名：内置驱动为平台名，命名配置为配置名。
+func (r *Registry) ActiveProfile() string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return r.DefaultDriver
 }
 
-func (r *Registry) Get(platform BucketPlatform) (Storage, bool) {
+// Get 按存储名查找驱动，内置驱动可使用平台名或其别名（如 cloudflare）。
+func (r *Registry) Get(name string) (Storage, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	s, ok := r.Storages[platform]
+	s, ok := r.Storages[CanonicalProfile(name)]
 	return s, ok
 }
 
@@ -192,17 +466,42 @@ func (r *Registry) Active() Storage {
 }
 
 func (r *Registry) ByStoredPath(path string) (Storage, error) {
-	plat, _, _, err := ParseStoredPath(path)
+	_, s, err := r.Resolve(path)
+	return s, err
+}
+
+// Resolve 返回存储路径实际所在的存储名与驱动。
+// 带配置名的路径只匹配该配置；旧路径优先匹配同平台内置驱动，桶不一致时
+// 再查找桶相同的命名配置，找不到则报错，避免用错误的客户端访问对象。
+func (r *Registry) Resolve(path string) (string, Storage, error) {
+	plat, profile, bucket, _, err := ParseProfilePath(path)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 	r.mu.RLock()
-	s, ok := r.Storages[plat]
-	r.mu.RUnlock()
-	if !ok {
-		return nil, fmt.Errorf("未找到存储驱动: %s", plat)
+	defer r.mu.RUnlock()
+	if profile != "" {
+		s, ok := r.Storages[profile]
+		if !ok {
+			return "", nil, fmt.Errorf("未找到存储配置: %s", profile)
+		}
+		if s.Platform() != plat || s.Bucket() != bucket {
+			return "", nil, fmt.Errorf("存储路径与存储配置 %s 不匹配", profile)
+		}
+		return profile, s, nil
+	}
+	if s, ok := r.Storages[string(plat)]; ok && s.Bucket() == bucket {
+		return string(plat), s, nil
+	}
+	for _, p := range r.Profiles {
+		if s, ok := r.Storages[p.Name]; ok && s.Platform() == plat && s.Bucket() == bucket {
+			return p.Name, s, nil
+		}
+	}
+	if _, ok := r.Storages[string(plat)]; !ok {
+		return "", nil, fmt.Errorf("未找到存储驱动: %s", plat)
 	}
-	return s, nil
+	return "", nil, fmt.Errorf("未找到存储桶 %s 对应的存储配置", bucket)
 }
 
 // 基于扩展名推断 MIME
@@ -229,7 +528,23 @@ func GuessMime(filename string) string {
 		return "audio/wav"
 	case ".pdf":
 		return "application/pdf"
-	case ".txt", ".md", ".json", ".log", ".xml", ".csv", ".html", ".css", ".js", ".ts":
+	case ".zip":
+		return "application/zip"
+	case ".html", ".htm":
+		return "text/html"
+	case ".css":
+		return "text/css"
+	case ".js", ".mjs":
+		return "text/javascript"
+	case ".json":
+		return "application/json"
+	case ".xml":
+		return "application/xml"
+	case ".csv":
+		return "text/csv"
+	case ".md":
+		return "text/markdown"
+	case ".txt", ".log", ".ts":
 		return "text/plain"
 	}
 	return "application/octet-stream"
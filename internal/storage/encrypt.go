@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"linkit/internal/config"
+)
+
+// 加密对象格式：
+//
+//	header: magic(4) | keyID(8，右侧补 0) | chunkSize(4，大端) | noncePrefix(8) | headerTag(16)
+//	body:   按 chunkSize 切分的明文分片，每片单独 AES-GCM 加密并附带 16 字节 tag
+//
+// 分片 nonce = noncePrefix | 分片序号(4，大端)，AAD = header 前 24 字节 | 是否末片(1)，
+// 防止分片被重排或截断；固定分片大小使 Range 读取只需解密覆盖到的分片。
+// headerTag 以保留序号 encHeaderIndex 为 nonce、header 前 24 字节为 AAD 加密空明文得到，
+// 只有用密钥校验通过的文件头才视为加密对象，恰好以 magic 开头的旧明文文件仍按原样读取。
+const (
+	encMagic          = "LKE1"
+	encFieldsSize     = 24
+	encHeaderSize     = encFieldsSize + encTagSize
+	encKeyIDSize      = 8
+	encNoncePrefixLen = 8
+	encTagSize        = 16
+	encChunkSize      = 64 * 1024
+	encMaxChunkSize   = 16 << 20
+	encHeaderIndex    = ^uint32(0)
+)
+
+var encKeyIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,8}$`)
+
+// ErrDecryptKeyMissing 表示对象使用的密钥不在当前密钥列表中。
+var ErrDecryptKeyMissing = errors.New("缺少解密该对象所需的密钥")
+
+// Keyring 保存加密密钥，第一把为写入使用的当前密钥，其余仅用于解密旧对象。
+type Keyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// ParseKeyring 解析 STORAGE_ENCRYPT_KEYS，格式为逗号分隔的 id:base64key，
+// 密钥长度为 16/24/32 字节（AES-128/192/256）。
+func ParseKeyring(raw string) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		id = strings.TrimSpace(id)
+		if !ok || !encKeyIDRegex.MatchString(id) {
+			return nil, fmt.Errorf("加密密钥格式错误，应为 id:base64key，id 最长 8 位")
+		}
+		if _, exists := ring.keys[id]; exists {
+			return nil, fmt.Errorf("加密密钥 id 重复: %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("加密密钥 %s 不是有效的 base64", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("加密密钥 %s 长度无效: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys[id] = aead
+		if ring.activeID == "" {
+			ring.activeID = id
+		}
+	}
+	if ring.activeID == "" {
+		return nil, fmt.Errorf("缺少加密密钥")
+	}
+	return ring, nil
+}
+
+// applyEncryption 按 STORAGE_ENCRYPT_TARGETS 为指定存储套上加密层，* 表示全部存储。
+func applyEncryption(cfg config.Config, storages map[string]Storage) error {
+	targets := strings.TrimSpace(cfg.AppConfig.StorageEncryptTargets)
+	if targets == "" {
+		return nil
+	}
+	ring, err := ParseKeyring(cfg.AppConfig.StorageEncryptKeys)
+	if err != nil {
+		return err
+	}
+	if targets == "*" {
+		for name, stg := range storages {
+			storages[name] = NewEncrypted(stg, ring)
+		}
+		return nil
+	}
+	for _, name := range strings.Split(targets, ",") {
+		name = CanonicalProfile(name)
+		if name == "" {
+			continue
+		}
+		stg, ok := storages[name]
+		if !ok {
+			return fmt.Errorf("加密目标存储不存在: %s", name)
+		}
+		if _, wrapped := stg.(*EncryptedStorage); !wrapped {
+			storages[name] = NewEncrypted(stg, ring)
+		}
+	}
+	return nil
+}
+
+// EncryptedStorage 在写入前加密、读取时解密，可包装任意存储驱动。
+// 未加密的旧对象（无文件头）按原样读取，便于在已有存储上开启加密。
+type EncryptedStorage struct {
+	inner Storage
+	ring  *Keyring
+}
+
+func NewEncrypted(inner Storage, ring *Keyring) *EncryptedStorage {
+	return &EncryptedStorage{inner: inner, ring: ring}
+}
+
+func (e *EncryptedStorage) Platform() BucketPlatform {
+	return e.inner.Platform()
+}
+
+func (e *EncryptedStorage) Bucket() string {
+	return e.inner.Bucket()
+}
+
+func (e *EncryptedStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	aead := e.ring.keys[e.ring.activeID]
+	header := make([]byte, encFieldsSize, encHeaderSize)
+	copy(header, encMagic)
+	copy(header[4:4+encKeyIDSize], e.ring.activeID)
+	binary.BigEndian.PutUint32(header[12:16], encChunkSize)
+	if _, err := io.ReadFull(rand.Reader, header[16:16+encNoncePrefixLen]); err != nil {
+		return "", err
+	}
+	enc := &encryptReader{
+		src:    bufio.NewReaderSize(r, encChunkSize),
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, encChunkSize),
+	}
+	enc.pending = aead.Seal(header, chunkNonce(header[16:16+encNoncePrefixLen], encHeaderIndex), nil, header)
+	cipherSize := int64(-1)
+	if size >= 0 {
+		chunks := (size + encChunkSize - 1) / encChunkSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		cipherSize = encHeaderSize + size + chunks*encTagSize
+	}
+	return e.inner.Write(objectKey, enc, cipherSize, "application/octet-stream")
+}
+
+// GetURL 加密对象无法由客户端直接读取，下载统一经服务端解密转发。
+func (e *EncryptedStorage) GetURL(storedPath string, expires time.Duration) (string, error) {
+	return "", ErrURLUnsupported
+}
+
+func (e *EncryptedStorage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	return e.OpenContext(context.Background(), storedPath, rangeStart, rangeEnd)
+}
+
+// OpenContext 解密读取对象，ctx 透传给内层驱动。
+func (e *EncryptedStorage) OpenContext(ctx context.Context, storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	info, hdr, err := e.inspect(ctx, storedPath)
+	if err != nil {
+		return nil, err
+	}
+	if hdr == nil {
+		return OpenContext(ctx, e.inner, storedPath, rangeStart, rangeEnd)
+	}
+	if rangeEnd < 0 || rangeEnd >= info.Size {
+		rangeEnd = info.Size - 1
+	}
+	if info.Size == 0 || rangeStart > rangeEnd {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	cs := int64(hdr.chunkSize)
+	first := rangeStart / cs
+	last := rangeEnd / cs
+	lastChunk := uint32((info.Size - 1) / cs)
+	start := encHeaderSize + first*(cs+encTagSize)
+	end := encHeaderSize + (last+1)*(cs+encTagSize) - 1
+	if cipherEnd := encHeaderSize + info.Size + int64(lastChunk+1)*encTagSize - 1; end > cipherEnd {
+		end = cipherEnd
+	}
+	src, err := OpenContext(ctx, e.inner, storedPath, start, end)
+	if err != nil {
+		return nil, err
+	}
+	dec := &decryptReader{
+		src:       src,
+		hdr:       hdr,
+		plainSize: info.Size,
+		index:     uint32(first),
+		lastChunk: lastChunk,
+		skip:      int(rangeStart - first*cs),
+		buf:       make([]byte, cs+encTagSize),
+	}
+	return readCloser{Reader: io.LimitReader(dec, rangeEnd-rangeStart+1), Closer: src}, nil
+}
+
+func (e *EncryptedStorage) Stat(storedPath string) (ObjectInfo, error) {
+	return e.StatContext(context.Background(), storedPath)
+}
+
+func (e *EncryptedStorage) StatContext(ctx context.Context, storedPath string) (ObjectInfo, error) {
+	info, _, err := e.inspect(ctx, storedPath)
+	return info, err
+}
+
+func (e *EncryptedStorage) Delete(storedPath string) error {
+	return e.inner.Delete(storedPath)
+}
+
+type encHeader struct {
+	raw         []byte
+	aead        cipher.AEAD
+	chunkSize   uint32
+	noncePrefix []byte
+}
+
+// inspect 读取文件头并换算明文大小；对象未加密时 hdr 为 nil。
+// 文件头需通过 headerTag 校验才视为加密对象；密钥 id 不在密钥列表中时无法判断，返回 ErrDecryptKeyMissing。
+func (e *EncryptedStorage) inspect(ctx context.Context, storedPath string) (ObjectInfo, *encHeader, error) {
+	info, err := StatContext(ctx, e.inner, storedPath)
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	if info.Size < encHeaderSize+encTagSize {
+		return info, nil, nil
+	}
+	r, err := OpenContext(ctx, e.inner, storedPath, 0, encHeaderSize-1)
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	raw := make([]byte, encHeaderSize)
+	_, err = io.ReadFull(r, raw)
+	r.Close()
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	if string(raw[:4]) != encMagic {
+		return info, nil, nil
+	}
+	keyID := string(bytes.TrimRight(raw[4:4+encKeyIDSize], "\x00"))
+	chunkSize := binary.BigEndian.Uint32(raw[12:16])
+	if !encKeyIDRegex.MatchString(keyID) || chunkSize == 0 || chunkSize > encMaxChunkSize {
+		return info, nil, nil
+	}
+	aead, ok := e.ring.keys[keyID]
+	if !ok {
+		return ObjectInfo{}, nil, fmt.Errorf("%w: %s", ErrDecryptKeyMissing, keyID)
+	}
+	fields, tag := raw[:encFieldsSize], raw[encFieldsSize:]
+	noncePrefix := fields[16 : 16+encNoncePrefixLen]
+	if _, err := aead.Open(nil, chunkNonce(noncePrefix, encHeaderIndex), tag, fields); err != nil {
+		return info, nil, nil
+	}
+	hdr := &encHeader{
+		raw:         fields,
+		aead:        aead,
+		chunkSize:   chunkSize,
+		noncePrefix: noncePrefix,
+	}
+	body := info.Size - encHeaderSize
+	frame := int64(hdr.chunkSize) + encTagSize
+	chunks := (body + frame - 1) / frame
+	// 密文大小即可换算出明文大小，无需额外元数据；ETag 对应密文，不对外暴露。
+	info.Size = body - chunks*encTagSize
+	info.ETag = ""
+	return info, hdr, nil
+}
+
+func chunkNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, encNoncePrefixLen+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encNoncePrefixLen:], index)
+	return nonce
+}
+
+func chunkAAD(header []byte, final bool) []byte {
+	aad := make([]byte, len(header)+1)
+	copy(aad, header)
+	if final {
+		aad[len(header)] = 1
+	}
+	return aad
+}
+
+type encryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	pending []byte
+	index   uint32
+	done    bool
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.buf)
+		final := false
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			final = true
+		case err != nil:
+			return 0, err
+		default:
+			// 读满一片时预读 1 字节判断是否已到末尾
+			if _, perr := r.src.Peek(1); perr == io.EOF {
+				final = true
+			} else if perr != nil {
+				return 0, perr
+			}
+		}
+		nonce := chunkNonce(r.header[16:16+encNoncePrefixLen], r.index)
+		r.pending = r.aead.Seal(nil, nonce, r.buf[:n], chunkAAD(r.header, final))
+		r.index++
+		r.done = final
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+type decryptReader struct {
+	src       io.Reader
+	hdr       *encHeader
+	plainSize int64
+	index     uint32
+	lastChunk uint32
+	skip      int
+	buf       []byte
+	plain     []byte
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.index > r.lastChunk {
+			return 0, io.EOF
+		}
+		cs := int64(r.hdr.chunkSize)
+		plainLen := cs
+		if r.index == r.lastChunk {
+			plainLen = r.plainSize - int64(r.lastChunk)*cs
+		}
+		frame := r.buf[:plainLen+encTagSize]
+		if _, err := io.ReadFull(r.src, frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		nonce := chunkNonce(r.hdr.noncePrefix, r.index)
+		plain, err := r.hdr.aead.Open(frame[:0], nonce, frame, chunkAAD(r.hdr.raw, r.index == r.lastChunk))
+		if err != nil {
+			return 0, fmt.Errorf("解密分片 %d 失败: %w", r.index, err)
+		}
+		r.index++
+		if r.skip > 0 {
+			plain = plain[r.skip:]
+			r.skip = 0
+		}
+		r.plain = plain
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
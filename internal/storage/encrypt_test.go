@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestEncrypted(t *testing.T, root, keys string) *EncryptedStorage {
+	t.Helper()
+	local, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := ParseKeyring(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncrypted(local, ring)
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readRange(t *testing.T, stg Storage, storedPath string, start, end int64) ([]byte, error) {
+	t.Helper()
+	r, err := stg.Open(storedPath, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestEncryptedRoundTripFrameBoundaries(t *testing.T) {
+	root := t.TempDir()
+	stg := newTestEncrypted(t, root, "k1:"+testKey(t))
+	for _, size := range []int{0, 1, encChunkSize - 1, encChunkSize, encChunkSize + 1, 3 * encChunkSize, 3*encChunkSize + 17} {
+		data := randomBytes(t, size)
+		storedPath, err := stg.Write("obj.bin", bytes.NewReader(data), int64(size), "application/octet-stream")
+		if err != nil {
+			t.Fatalf("size %d: Write: %v", size, err)
+		}
+		raw, err := os.ReadFile(filepath.Join(root, "obj.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size >= 16 && bytes.Contains(raw, data) {
+			t.Fatalf("size %d: 存储中出现了明文", size)
+		}
+		info, err := stg.Stat(storedPath)
+		if err != nil {
+			t.Fatalf("size %d: Stat: %v", size, err)
+		}
+		if info.Size != int64(size) {
+			t.Fatalf("size %d: Stat 返回明文大小 %d", size, info.Size)
+		}
+		got, err := readRange(t, stg, storedPath, 0, -1)
+		if err != nil {
+			t.Fatalf("size %d: Open: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: 解密内容不一致", size)
+		}
+	}
+}
+
+func TestEncryptedRangeAcrossFrames(t *testing.T) {
+	stg := newTestEncrypted(t, t.TempDir(), "k1:"+testKey(t))
+	data := randomBytes(t, 3*encChunkSize+100)
+	storedPath, err := stg.Write("obj.bin", bytes.NewReader(data), int64(len(data)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := int64(encChunkSize)
+	size := int64(len(data))
+	cases := []struct{ start, end int64 }{
+		{0, 0},
+		{cs - 1, cs},          // 跨越第一个分片边界
+		{cs, 2*cs - 1},        // 恰好一个完整分片
+		{100, 2*cs + 50},      // 跨越三个分片
+		{3*cs - 10, -1},       // 读到末片结尾
+		{size - 1, size - 1},  // 最后一个字节
+		{2 * cs, size + 1000}, // 结束位置超出对象大小
+	}
+	for _, tc := range cases {
+		got, err := readRange(t, stg, storedPath, tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("[%d, %d]: %v", tc.start, tc.end, err)
+		}
+		end := tc.end
+		if end < 0 || end >= size {
+			end = size - 1
+		}
+		if !bytes.Equal(got, data[tc.start:end+1]) {
+			t.Fatalf("[%d, %d]: 内容不一致", tc.start, tc.end)
+		}
+	}
+}
+
+func TestEncryptedDetectsTruncation(t *testing.T) {
+	root := t.TempDir()
+	stg := newTestEncrypted(t, root, "k1:"+testKey(t))
+	data := randomBytes(t, 3*encChunkSize)
+	storedPath, err := stg.Write("obj.bin", bytes.NewReader(data), int64(len(data)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 在分片边界截断，剩余分片均为完整帧，只能依靠末片标记发现截断
+	target := filepath.Join(root, "obj.bin")
+	if err := os.Truncate(target, encHeaderSize+2*(encChunkSize+encTagSize)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRange(t, stg, storedPath, 0, -1); err == nil {
+		t.Fatal("截断的对象应解密失败")
+	}
+	if _, err := readRange(t, stg, storedPath, encChunkSize+10, encChunkSize+20); err == nil {
+		t.Fatal("读取截断对象的末片应解密失败")
+	}
+}
+
+func TestEncryptedKeyRotation(t *testing.T) {
+	root := t.TempDir()
+	oldKey, newKey := "old:"+testKey(t), "new:"+testKey(t)
+	oldData, newData := randomBytes(t, encChunkSize+1), randomBytes(t, 1000)
+
+	before := newTestEncrypted(t, root, oldKey)
+	oldPath, err := before.Write("old.bin", bytes.NewReader(oldData), int64(len(oldData)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 新密钥放在最前面：新对象使用新密钥，旧对象仍可用旧密钥解密
+	rotated := newTestEncrypted(t, root, newKey+","+oldKey)
+	newPath, err := rotated.Write("new.bin", bytes.NewReader(newData), int64(len(newData)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string][]byte{oldPath: oldData, newPath: newData} {
+		got, err := readRange(t, rotated, path, 0, -1)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("%s: 轮换后读取失败: %v", path, err)
+		}
+	}
+	if _, err := readRange(t, before, newPath, 0, -1); !errors.Is(err, ErrDecryptKeyMissing) {
+		t.Fatalf("缺少新密钥时应返回 ErrDecryptKeyMissing, got %v", err)
+	}
+
+	// 同 id 但密钥不同时文件头校验失败，对象按原样读取而不是报错或返回错误的明文
+	wrong := newTestEncrypted(t, root, "old:"+testKey(t))
+	got, err := readRange(t, wrong, oldPath, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, oldData) {
+		t.Fatal("错误的密钥不应解出明文")
+	}
+}
+
+func TestEncryptedReadsLegacyPlaintext(t *testing.T) {
+	root := t.TempDir()
+	stg := newTestEncrypted(t, root, "k1:"+testKey(t))
+	// 旧明文文件恰好以加密 magic、合法的密钥 id 与分片大小开头，只能靠文件头校验区分
+	legacy := append([]byte(encMagic+"k1\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00"), randomBytes(t, 200)...)
+	if err := os.WriteFile(filepath.Join(root, "legacy.txt"), legacy, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	storedPath := "local@/legacy.txt"
+	info, err := stg.Stat(storedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(legacy)) {
+		t.Fatalf("明文对象大小 = %d, 期望 %d", info.Size, len(legacy))
+	}
+	got, err := readRange(t, stg, storedPath, 2, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, legacy[2:31]) {
+		t.Fatal("明文对象的区间读取内容不一致")
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 对象 key 模板支持的占位符：
+//
+//	{yyyy} {mm} {dd}   上传日期
+//	{user}             上传者用户名
+//	{tag}              第一个标签，无标签时为 untagged
+//	{hash}             文件 MD5
+//	{name}             文件名（不含扩展名）
+//	{short_name}       文件名前 10 个字符（不含扩展名）
+//	{original_name}    完整文件名
+//	{ext}              扩展名（含点，如 .png）
+//	{rand}             8 位随机十六进制串
+var keyPlaceholderRegex = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+var keyPlaceholders = map[string]struct{}{
+	"yyyy": {}, "mm": {}, "dd": {}, "user": {}, "tag": {}, "hash": {},
+	"name": {}, "short_name": {}, "original_name": {}, "ext": {}, "rand": {},
+}
+
+// keySuffixLen 模板不保证唯一时追加到 key 末尾的 hash 前缀长度。
+const keySuffixLen = 12
+
+// KeyMeta 渲染对象 key 所需的上传信息。
+type KeyMeta struct {
+	Hash     string
+	Filename string
+	Username string
+	Tags     []string
+	Time     time.Time
+}
+
+// ValidateKeyTemplate 校验对象 key 模板，空模板表示使用默认布局。
+func ValidateKeyTemplate(tpl string) error {
+	tpl = strings.TrimSpace(tpl)
+	if tpl == "" {
+		return nil
+	}
+	for _, m := range keyPlaceholderRegex.FindAllStringSubmatch(tpl, -1) {
+		if _, ok := keyPlaceholders[m[1]]; !ok {
+			return fmt.Errorf("对象 key 模板包含未知占位符: %s", m[0])
+		}
+	}
+	rest := keyPlaceholderRegex.ReplaceAllString(tpl, "")
+	if strings.ContainsAny(rest, "{}") {
+		return errors.New("对象 key 模板的花括号不匹配")
+	}
+	if !keyPlaceholderRegex.MatchString(tpl) {
+		return errors.New("对象 key 模板至少需要包含一个占位符")
+	}
+	if strings.HasSuffix(tpl, "/") {
+		return errors.New("对象 key 模板不能以 / 结尾")
+	}
+	sample, err := RenderObjectKey(tpl, KeyMeta{Hash: strings.Repeat("0", 32), Filename: "sample.png", Username: "user", Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	if sample == "" || sample == "." {
+		return errors.New("对象 key 模板渲染结果为空")
+	}
+	return nil
+}
+
+// RenderObjectKey 按模板生成对象 key 并规范化；模板为空时使用 BuildObjectKey 的默认布局。
+func RenderObjectKey(tpl string, meta KeyMeta) (string, error) {
+	tpl = strings.TrimSpace(tpl)
+	if tpl == "" {
+		return BuildObjectKey(meta.Hash, meta.Filename, meta.Time), nil
+	}
+	ext := path.Ext(meta.Filename)
+	name := strings.TrimSuffix(meta.Filename, ext)
+	if strings.TrimSpace(name) == "" {
+		name = "file"
+	}
+	shortName := name
+	if len([]rune(shortName)) > 10 {
+		shortName = string([]rune(shortName)[:10])
+	}
+	tag := "untagged"
+	if len(meta.Tags) > 0 {
+		tag = meta.Tags[0]
+	}
+	var renderErr error
+	key := keyPlaceholderRegex.ReplaceAllStringFunc(tpl, func(m string) string {
+		switch m[1 : len(m)-1] {
+		case "yyyy":
+			return fmt.Sprintf("%04d", meta.Time.Year())
+		case "mm":
+			return fmt.Sprintf("%02d", int(meta.Time.Month()))
+		case "dd":
+			return fmt.Sprintf("%02d", meta.Time.Day())
+		case "user":
+			return keySegment(meta.Username, "unknown")
+		case "tag":
+			return keySegment(tag, "untagged")
+		case "hash":
+			return meta.Hash
+		case "name":
+			return keySegment(name, "file")
+		case "short_name":
+			return keySegment(shortName, "file")
+		case "original_name":
+			return keySegment(meta.Filename, "file")
+		case "ext":
+			return keySegment(ext, "")
+		case "rand":
+			buf := make([]byte, 4)
+			if _, err := rand.Read(buf); err != nil {
+				renderErr = err
+			}
+			return hex.EncodeToString(buf)
+		}
+		return m
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return NormalizeObjectKey(key)
+}
+
+// keySegment 将用户输入转换为单个路径段，去掉分隔符与 .. 以免改变目录层级。
+func keySegment(value, fallback string) string {
+	value = strings.TrimSpace(strings.NewReplacer("/", "_", "\\", "_").Replace(value))
+	for strings.Contains(value, "..") {
+		value = strings.ReplaceAll(value, "..", ".")
+	}
+	if value == "" || strings.Trim(value, ".") == "" {
+		return fallback
+	}
+	return value
+}
+
+// KeyTemplateUnique 模板中包含 hash 或随机串时，不同内容不会生成相同的 key，无需追加后缀。
+func KeyTemplateUnique(tpl string) bool {
+	tpl = strings.TrimSpace(tpl)
+	return tpl == "" || strings.Contains(tpl, "{hash}") || strings.Contains(tpl, "{rand}")
+}
+
+// SuffixObjectKey 在扩展名前追加 hash 前缀（如 report-3f2a9c1b7d0e.pdf）。模板不含 hash 或随机串时，
+// 同名文件会渲染出相同的 key；先检查再写入无法避免并发上传互相覆盖，因此总是追加后缀，
+// 内容不同的文件得到不同的 key，内容相同的文件则由去重复用。
+func SuffixObjectKey(key, hash string) string {
+	suffix := keySegment(hash, "")
+	if len(suffix) > keySuffixLen {
+		suffix = suffix[:keySuffixLen]
+	}
+	if suffix == "" {
+		return key
+	}
+	ext := path.Ext(key)
+	return strings.TrimSuffix(key, ext) + "-" + suffix + ext
+}
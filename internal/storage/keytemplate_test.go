@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	cfgpkg "linkit/internal/config"
+)
+
+func TestRenderObjectKey(t *testing.T) {
+	meta := KeyMeta{
+		Hash:     "3f2a9c1b7d0e4a5b6c7d8e9f00112233",
+		Filename: "年度报告-final.pdf",
+		Username: "alice",
+		Tags:     []string{"docs", "2024"},
+		Time:     time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC),
+	}
+	cases := []struct {
+		tpl  string
+		meta KeyMeta
+		want string
+	}{
+		{"{yyyy}/{mm}/{dd}/{hash}{ext}", meta, "2024/03/07/3f2a9c1b7d0e4a5b6c7d8e9f00112233.pdf"},
+		{"{user}/{tag}/{original_name}", meta, "alice/docs/年度报告-final.pdf"},
+		{"{name}-{short_name}", meta, "年度报告-final-年度报告-final"},
+		{"{tag}/{hash}", KeyMeta{Hash: meta.Hash, Filename: "a.png"}, "untagged/" + meta.Hash},
+		{"{user}/{name}{ext}", KeyMeta{Filename: ".png"}, "unknown/file.png"},
+		{"  files/{hash}  ", meta, "files/" + meta.Hash},
+		{"", meta, BuildObjectKey(meta.Hash, meta.Filename, meta.Time)},
+	}
+	for _, tc := range cases {
+		got, err := RenderObjectKey(tc.tpl, tc.meta)
+		if err != nil || got != tc.want {
+			t.Errorf("RenderObjectKey(%q) = %q, %v, 期望 %q", tc.tpl, got, err, tc.want)
+		}
+	}
+
+	key, err := RenderObjectKey("{rand}/{name}", meta)
+	if err != nil || !regexp.MustCompile(`^[0-9a-f]{8}/年度报告-final$`).MatchString(key) {
+		t.Errorf("{rand} 应渲染为 8 位十六进制串: %q, %v", key, err)
+	}
+}
+
+func TestRenderObjectKeyPathTraversal(t *testing.T) {
+	hash := strings.Repeat("0", 32)
+	// 用户输入的文件名、用户名与标签只能生成单个路径段
+	cases := []struct {
+		meta KeyMeta
+		want string
+	}{
+		{KeyMeta{Hash: hash, Filename: "../../etc/passwd", Username: "alice"}, "alice/._._etc_passwd"},
+		{KeyMeta{Hash: hash, Filename: "..", Username: "../admin"}, "._admin/file"},
+		{KeyMeta{Hash: hash, Filename: "/abs/a.txt", Username: "..\\x"}, "._x/_abs_a.txt"},
+		{KeyMeta{Hash: hash, Filename: "a.txt", Username: "...", Tags: []string{"../.."}}, "unknown/a.txt"},
+	}
+	for _, tc := range cases {
+		got, err := RenderObjectKey("{user}/{original_name}", tc.meta)
+		if err != nil || got != tc.want {
+			t.Errorf("RenderObjectKey(%+v) = %q, %v, 期望 %q", tc.meta, got, err, tc.want)
+		}
+	}
+	if got, err := RenderObjectKey("{tag}/{hash}", KeyMeta{Hash: hash, Tags: []string{"../.."}}); err != nil || got != "._./"+hash {
+		t.Errorf("标签不应改变目录层级: %q, %v", got, err)
+	}
+
+	// 模板自身的开头 / 会被去掉，.. 越出根目录时报错
+	if got, err := RenderObjectKey("/{yyyy}/{hash}", KeyMeta{Hash: hash, Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}); err != nil || got != "2024/"+hash {
+		t.Errorf("开头的 / 应被去掉: %q, %v", got, err)
+	}
+	for _, tpl := range []string{"../{hash}", "{yyyy}/../../{hash}", "..\\{hash}"} {
+		if _, err := RenderObjectKey(tpl, KeyMeta{Hash: hash, Time: time.Now()}); err == nil {
+			t.Errorf("模板 %q 越出根目录时应报错", tpl)
+		}
+	}
+}
+
+func TestValidateKeyTemplate(t *testing.T) {
+	for _, tpl := range []string{"", "  ", "{yyyy}/{mm}/{hash}{ext}", "/uploads/{user}/{original_name}", "a/../{hash}"} {
+		if err := ValidateKeyTemplate(tpl); err != nil {
+			t.Errorf("ValidateKeyTemplate(%q) = %v", tpl, err)
+		}
+	}
+	cases := map[string]string{
+		"{yyyy}/{bogus}":   "未知占位符: {bogus}",
+		"{yyyy}/{Hash}":    "花括号不匹配",
+		"{yyyy/{hash}":     "花括号不匹配",
+		"{hash}}":          "花括号不匹配",
+		"static/name.png":  "至少需要包含一个占位符",
+		"{yyyy}/":          "不能以 / 结尾",
+		"../{hash}":        "存储路径非法",
+		"{mm}/../../{ext}": "存储路径非法",
+	}
+	for tpl, want := range cases {
+		err := ValidateKeyTemplate(tpl)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateKeyTemplate(%q) = %v, 期望包含 %q", tpl, err, want)
+		}
+	}
+}
+
+func TestRegistryValidateRejectsInvalidKeyTemplate(t *testing.T) {
+	reg := &Registry{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	var cfg cfgpkg.Config
+	cfg.LocalRoot = t.TempDir()
+	cfg.AppConfig.StorageDriver = "local"
+
+	cfg.AppConfig.StorageKeyTemplate = "{user}/{hash}{ext}"
+	if err := reg.Validate(cfg); err != nil {
+		t.Fatalf("有效模板应通过校验: %v", err)
+	}
+	cfg.AppConfig.StorageKeyTemplate = "{user}/{unknown}"
+	if err := reg.Validate(cfg); err == nil || !strings.Contains(err.Error(), "{unknown}") {
+		t.Fatalf("未知占位符应在保存配置前被拒绝: %v", err)
+	}
+}
+
+func TestSuffixObjectKey(t *testing.T) {
+	hash := "3f2a9c1b7d0e4a5b6c7d8e9f00112233"
+	cases := map[string]string{
+		"docs/report.pdf":     "docs/report-3f2a9c1b7d0e.pdf",
+		"docs/README":         "docs/README-3f2a9c1b7d0e",
+		"v1.2/archive.tar.gz": "v1.2/archive.tar-3f2a9c1b7d0e.gz",
+		"v1.2/notes":          "v1.2/notes-3f2a9c1b7d0e",
+	}
+	for key, want := range cases {
+		if got := SuffixObjectKey(key, hash); got != want {
+			t.Errorf("SuffixObjectKey(%q) = %q, 期望 %q", key, got, want)
+		}
+	}
+	if got := SuffixObjectKey("a.png", ""); got != "a.png" {
+		t.Errorf("hash 为空时不应追加后缀, got %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -23,6 +24,10 @@ func (l *LocalStorage) Platform() BucketPlatform {
 	return PlatformLocal
 }
 
+func (l *LocalStorage) Bucket() string {
+	return ""
+}
+
 func (l *LocalStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
 	normalized, err := NormalizeObjectKey(objectKey)
 	if err != nil {
@@ -51,17 +56,66 @@ func (l *LocalStorage) GetURL(storedPath string, expires time.Duration) (string,
 	return filepath.Join(l.root, filepath.FromSlash(key)), nil
 }
 
+func (l *LocalStorage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	target, err := l.resolve(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	if rangeStart > 0 {
+		if _, err := f.Seek(rangeStart, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if rangeEnd < 0 {
+		return f, nil
+	}
+	return readCloser{Reader: io.LimitReader(f, rangeEnd-rangeStart+1), Closer: f}, nil
+}
+
+func (l *LocalStorage) Stat(storedPath string) (ObjectInfo, error) {
+	target, err := l.resolve(storedPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return ObjectInfo{Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
 func (l *LocalStorage) Delete(storedPath string) error {
-	platform, _, key, err := ParseStoredPath(storedPath)
+	target, err := l.resolve(storedPath)
 	if err != nil {
 		return err
 	}
-	if platform != PlatformLocal {
-		return fmt.Errorf("存储路径与本地存储不匹配")
-	}
-	target := filepath.Join(l.root, filepath.FromSlash(key))
 	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
+
+func (l *LocalStorage) resolve(storedPath string) (string, error) {
+	platform, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return "", err
+	}
+	if platform != PlatformLocal {
+		return "", fmt.Errorf("存储路径与本地存储不匹配")
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// SniffLen 识别 MIME 类型所需的文件头长度。
+const SniffLen = 3072
+
+// SniffMime 根据文件头的魔数识别 MIME 类型，内容无法识别或仅识别为纯文本时再参考扩展名。
+// 第二个返回值表示内容是否与扩展名相符，扩展名未知时视为相符。
+func SniffMime(head []byte, filename string) (string, bool) {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+	detected := mimetype.Detect(head)
+	byExt := mimeByExt(filename)
+
+	contentType := mediaType(detected.String())
+	switch {
+	case detected.Is("application/octet-stream"):
+		if byExt != "" {
+			contentType = byExt
+		}
+	case isTextContent(detected) && isTextMime(byExt):
+		// 文本内容之间难以准确区分，以扩展名给出更具体的类型（如 text/markdown）
+		contentType = byExt
+	}
+
+	if byExt == "" || byExt == "application/octet-stream" {
+		return contentType, true
+	}
+	if isTextContent(detected) && isTextMime(byExt) {
+		return contentType, true
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(byExt) {
+			return contentType, true
+		}
+	}
+	return contentType, false
+}
+
+// SniffExt 根据文件头推断扩展名（含点），无法识别时返回空字符串。
+func SniffExt(head []byte) string {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+	return mimetype.Detect(head).Extension()
+}
+
+// isTextContent 识别结果是否属于文本（text/plain 及其子类型）。
+func isTextContent(detected *mimetype.MIME) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is("text/plain") {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeByExt 按扩展名推断 MIME，未知扩展名返回空字符串。
+func mimeByExt(filename string) string {
+	if guessed := GuessMime(filename); guessed != "application/octet-stream" {
+		return guessed
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		return ""
+	}
+	return mediaType(mime.TypeByExtension(ext))
+}
+
+func mediaType(value string) string {
+	mt, _, _ := strings.Cut(value, ";")
+	return strings.TrimSpace(mt)
+}
+
+func isTextMime(value string) bool {
+	switch {
+	case value == "":
+		return false
+	case strings.HasPrefix(value, "text/"):
+		return true
+	case strings.HasSuffix(value, "+xml"), strings.HasSuffix(value, "+json"):
+		return true
+	}
+	switch value {
+	case "application/json", "application/xml", "application/javascript":
+		return true
+	}
+	return false
+}
+
+// IsActiveContent 判断内容在浏览器中内联打开时是否可能执行脚本（HTML、SVG、XML、JavaScript），
+// 此类文件只能以附件形式下载。
+func IsActiveContent(contentType string) bool {
+	value := strings.ToLower(mediaType(contentType))
+	if strings.HasSuffix(value, "+xml") {
+		return true
+	}
+	switch value {
+	case "text/html", "text/xml", "application/xml", "text/xsl",
+		"text/javascript", "application/javascript", "application/x-javascript", "application/ecmascript":
+		return true
+	}
+	return false
+}
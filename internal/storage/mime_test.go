@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"testing"
+)
+
+var pngHead = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+func TestSniffMime(t *testing.T) {
+	tests := []struct {
+		name       string
+		head       []byte
+		filename   string
+		want       string
+		consistent bool
+	}{
+		{"内容与扩展名一致", pngHead, "a.png", "image/png", true},
+		{"扩展名大写", pngHead, "A.PNG", "image/png", true},
+		{"无扩展名时以内容为准", pngHead, "photo", "image/png", true},
+		{"未知扩展名视为相符", pngHead, "a.unknownext", "image/png", true},
+		{"图片伪装成其他图片", pngHead, "a.jpg", "image/png", false},
+		{"网页伪装成图片", []byte("<!DOCTYPE html><html><body>x</body></html>"), "a.png", "text/html", false},
+		{"SVG", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "a.svg", "image/svg+xml", true},
+		{"纯文本以扩展名细化类型", []byte("# title\n\nbody\n"), "readme.md", "text/markdown", true},
+		{"纯文本", []byte("hello world\n"), "a.txt", "text/plain", true},
+		{"JSON", []byte(`{"a": 1}`), "a.json", "application/json", true},
+		{"文本伪装成图片", []byte("hello world\n"), "a.png", "text/plain", false},
+		{"无法识别的内容以扩展名为准", []byte{0x00, 0x01, 0x02, 0x03}, "a.bin", "application/octet-stream", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, consistent := SniffMime(tt.head, tt.filename)
+			if got != tt.want || consistent != tt.consistent {
+				t.Fatalf("SniffMime(%q) = %s, %v; 期望 %s, %v", tt.filename, got, consistent, tt.want, tt.consistent)
+			}
+		})
+	}
+}
+
+func TestSniffMimeOnlyReadsHead(t *testing.T) {
+	// 超出 SniffLen 的内容不参与识别
+	head := make([]byte, SniffLen+16)
+	copy(head, "hello world\n")
+	copy(head[SniffLen:], "\x00\x00\x00\x00")
+	for i := len("hello world\n"); i < SniffLen; i++ {
+		head[i] = 'a'
+	}
+	if got, ok := SniffMime(head, "a.txt"); got != "text/plain" || !ok {
+		t.Fatalf("SniffMime = %s, %v", got, ok)
+	}
+}
+
+func TestSniffExt(t *testing.T) {
+	for _, tt := range []struct {
+		head []byte
+		want string
+	}{
+		{pngHead, ".png"},
+		{[]byte("%PDF-1.7\n"), ".pdf"},
+		{[]byte{0x00, 0x01, 0x02, 0x03}, ""},
+	} {
+		if got := SniffExt(tt.head); got != tt.want {
+			t.Errorf("SniffExt(%q) = %q, 期望 %q", tt.head[:4], got, tt.want)
+		}
+	}
+}
+
+func TestIsActiveContent(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/html":                true,
+		"text/html; charset=utf-8": true,
+		"TEXT/HTML":                true,
+		"image/svg+xml":            true,
+		"application/xhtml+xml":    true,
+		"application/xml":          true,
+		"text/javascript":          true,
+		"text/plain":               false,
+		"image/png":                false,
+		"application/json":         false,
+		"application/pdf":          false,
+		"":                         false,
+	} {
+		if got := IsActiveContent(contentType); got != want {
+			t.Errorf("IsActiveContent(%q) = %v, 期望 %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"linkit/internal/config"
+)
+
+// MirrorStorage 将写入同时复制到主、副两个存储，读取时主存储缺失对象则回退到副存储。
+// 存储路径以主存储为准，副存储使用相同的对象 key。
+type MirrorStorage struct {
+	primary       Storage
+	secondary     Storage
+	primaryName   string
+	secondaryName string
+	logger        *slog.Logger
+}
+
+// applyMirrors 按 STORAGE_MIRRORS（逗号分隔的 主:副 存储名）将主存储替换为镜像存储。
+func applyMirrors(cfg config.Config, storages map[string]Storage, logger *slog.Logger) error {
+	raw := strings.TrimSpace(cfg.AppConfig.StorageMirrors)
+	if raw == "" {
+		return nil
+	}
+	pairs := make(map[string]string)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		primary, secondary, ok := strings.Cut(item, ":")
+		primary, secondary = CanonicalProfile(primary), CanonicalProfile(secondary)
+		if !ok || primary == "" || secondary == "" {
+			return fmt.Errorf("存储镜像格式错误，应为 主存储:副存储")
+		}
+		if primary == secondary {
+			return fmt.Errorf("存储镜像的主副存储不能相同: %s", primary)
+		}
+		if _, dup := pairs[primary]; dup {
+			return fmt.Errorf("存储 %s 重复配置镜像", primary)
+		}
+		for _, name := range []string{primary, secondary} {
+			if _, ok := storages[name]; !ok {
+				return fmt.Errorf("存储镜像引用的存储不存在: %s", name)
+			}
+		}
+		pairs[primary] = secondary
+	}
+	for primary, secondary := range pairs {
+		if _, chained := pairs[secondary]; chained {
+			return fmt.Errorf("存储镜像不能级联: %s -> %s", primary, secondary)
+		}
+	}
+	for primary, secondary := range pairs {
+		storages[primary] = &MirrorStorage{
+			primary:       storages[primary],
+			secondary:     storages[secondary],
+			primaryName:   primary,
+			secondaryName: secondary,
+			logger:        logger,
+		}
+	}
+	return nil
+}
+
+// Mirrors 返回当前启用的镜像存储。
+func (r *Registry) Mirrors() []*MirrorStorage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var mirrors []*MirrorStorage
+	for _, stg := range r.Storages {
+		if m, ok := stg.(*MirrorStorage); ok {
+			mirrors = append(mirrors, m)
+		}
+	}
+	return mirrors
+}
+
+func (m *MirrorStorage) Platform() BucketPlatform {
+	return m.primary.Platform()
+}
+
+func (m *MirrorStorage) Bucket() string {
+	return m.primary.Bucket()
+}
+
+// Names 返回主、副存储名。
+func (m *MirrorStorage) Names() (string, string) {
+	return m.primaryName, m.secondaryName
+}
+
+// Replicas 返回主、副存储驱动。
+func (m *MirrorStorage) Replicas() (Storage, Storage) {
+	return m.primary, m.secondary
+}
+
+// SecondaryPath 将主存储路径换算为副存储中同一对象的路径。
+func (m *MirrorStorage) SecondaryPath(storedPath string) (string, error) {
+	_, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return "", err
+	}
+	return StoredPathFor(m.secondaryName, m.secondary, key)
+}
+
+// Write 同时写入主副存储；副存储失败只记录日志，由修复任务补齐，主存储失败则整体失败。
+func (m *MirrorStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	type result struct {
+		path string
+		err  error
+	}
+	startWrite := func(stg Storage, pr *io.PipeReader) <-chan result {
+		done := make(chan result, 1)
+		go func() {
+			path, err := stg.Write(objectKey, pr, size, contentType)
+			// 写入提前返回时关闭管道，避免复制端阻塞
+			pr.CloseWithError(err)
+			done <- result{path: path, err: err}
+		}()
+		return done
+	}
+	pr1, pw1 := io.Pipe()
+	pr2, pw2 := io.Pipe()
+	primaryDone := startWrite(m.primary, pr1)
+	secondaryDone := startWrite(m.secondary, pr2)
+
+	tee := &mirrorWriter{primary: pw1, secondary: pw2}
+	_, copyErr := io.Copy(tee, r)
+	pw1.CloseWithError(copyErr)
+	pw2.CloseWithError(copyErr)
+	primaryRes := <-primaryDone
+	secondaryRes := <-secondaryDone
+
+	if primaryRes.err != nil {
+		if secondaryRes.err == nil {
+			_ = m.secondary.Delete(secondaryRes.path)
+		}
+		return "", primaryRes.err
+	}
+	if copyErr != nil {
+		_ = m.primary.Delete(primaryRes.path)
+		return "", copyErr
+	}
+	if secondaryRes.err != nil {
+		m.logger.Warn("写入副存储失败，等待修复任务补齐", "secondary", m.secondaryName, "key", objectKey, "err", secondaryRes.err)
+	}
+	return primaryRes.path, nil
+}
+
+// mirrorWriter 副存储写入失败后不再向其写入，保证主存储写入不受影响。
+type mirrorWriter struct {
+	primary      io.Writer
+	secondary    io.Writer
+	secondaryErr error
+}
+
+func (w *mirrorWriter) Write(p []byte) (int, error) {
+	if w.secondaryErr == nil {
+		if _, err := w.secondary.Write(p); err != nil {
+			w.secondaryErr = err
+		}
+	}
+	return w.primary.Write(p)
+}
+
+// GetURL 主存储中存在对象时返回主存储的直链，主存储缺失而副存储完好时返回副存储的直链；
+// 无法确认对象所在位置时返回 ErrURLUnsupported，由服务端经 Open 回退读取后转发。
+func (m *MirrorStorage) GetURL(storedPath string, expires time.Duration) (string, error) {
+	return m.directURL(storedPath, func(stg Storage, path string) (string, error) {
+		return stg.GetURL(path, expires)
+	})
+}
+
+// GetDownloadURL 与 GetURL 相同地选择主副存储，所选驱动不支持覆盖响应头时返回 ErrURLUnsupported。
+func (m *MirrorStorage) GetDownloadURL(storedPath string, expires time.Duration, opts DownloadOptions) (string, error) {
+	return m.directURL(storedPath, func(stg Storage, path string) (string, error) {
+		d, ok := stg.(DownloadURLer)
+		if !ok {
+			return "", ErrURLUnsupported
+		}
+		return d.GetDownloadURL(path, expires, opts)
+	})
+}
+
+func (m *MirrorStorage) directURL(storedPath string, sign func(stg Storage, path string) (string, error)) (string, error) {
+	_, err := m.primary.Stat(storedPath)
+	if err == nil {
+		return sign(m.primary, storedPath)
+	}
+	// 本地存储的 GetURL 返回文件路径，不能作为直链
+	if !errors.Is(err, ErrObjectNotFound) || m.secondary.Platform() == PlatformLocal {
+		return "", ErrURLUnsupported
+	}
+	secondaryPath, err := m.SecondaryPath(storedPath)
+	if err != nil {
+		return "", ErrURLUnsupported
+	}
+	if _, err := m.secondary.Stat(secondaryPath); err != nil {
+		return "", ErrURLUnsupported
+	}
+	url, err := sign(m.secondary, secondaryPath)
+	if err != nil {
+		return "", ErrURLUnsupported
+	}
+	m.logger.Warn("主存储缺失对象，使用副存储直链", "path", storedPath, "secondary", m.secondaryName)
+	return url, nil
+}
+
+func (m *MirrorStorage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	return m.OpenContext(context.Background(), storedPath, rangeStart, rangeEnd)
+}
+
+func (m *MirrorStorage) OpenContext(ctx context.Context, storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	r, err := OpenContext(ctx, m.primary, storedPath, rangeStart, rangeEnd)
+	if err == nil {
+		return r, nil
+	}
+	secondaryPath, perr := m.SecondaryPath(storedPath)
+	if perr != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	m.logger.Warn("主存储读取失败，回退到副存储", "path", storedPath, "secondary", m.secondaryName, "err", err)
+	if r, serr := OpenContext(ctx, m.secondary, secondaryPath, rangeStart, rangeEnd); serr == nil {
+		return r, nil
+	}
+	return nil, err
+}
+
+func (m *MirrorStorage) Stat(storedPath string) (ObjectInfo, error) {
+	return m.StatContext(context.Background(), storedPath)
+}
+
+func (m *MirrorStorage) StatContext(ctx context.Context, storedPath string) (ObjectInfo, error) {
+	info, err := StatContext(ctx, m.primary, storedPath)
+	if err == nil {
+		return info, nil
+	}
+	secondaryPath, perr := m.SecondaryPath(storedPath)
+	if perr != nil {
+		return ObjectInfo{}, err
+	}
+	if info, serr := StatContext(ctx, m.secondary, secondaryPath); serr == nil {
+		return info, nil
+	}
+	return ObjectInfo{}, err
+}
+
+func (m *MirrorStorage) Delete(storedPath string) error {
+	err := m.primary.Delete(storedPath)
+	if secondaryPath, perr := m.SecondaryPath(storedPath); perr == nil {
+		if serr := m.secondary.Delete(secondaryPath); serr != nil {
+			m.logger.Warn("删除副存储对象失败", "path", secondaryPath, "err", serr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// urlStorage 以内存保存对象并返回 https://<bucket>/<key> 形式的直链，模拟 S3 兼容存储。
+type urlStorage struct {
+	bucket  string
+	objects map[string][]byte
+}
+
+func (s *urlStorage) Platform() BucketPlatform { return PlatformS3 }
+func (s *urlStorage) Bucket() string           { return s.bucket }
+
+func (s *urlStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.objects[objectKey] = data
+	return BuildProfilePath(PlatformS3, s.bucket, s.bucket, objectKey)
+}
+
+func (s *urlStorage) GetURL(storedPath string, expires time.Duration) (string, error) {
+	_, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return "", err
+	}
+	return "https://" + s.bucket + "/" + key, nil
+}
+
+func (s *urlStorage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	_, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *urlStorage) Stat(storedPath string) (ObjectInfo, error) {
+	_, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	data, ok := s.objects[key]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return ObjectInfo{Size: int64(len(data))}, nil
+}
+
+func (s *urlStorage) Delete(storedPath string) error {
+	_, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return err
+	}
+	delete(s.objects, key)
+	return nil
+}
+
+func TestMirrorGetURLFallsBackToSecondary(t *testing.T) {
+	primary := &urlStorage{bucket: "primary", objects: map[string][]byte{}}
+	secondary := &urlStorage{bucket: "secondary", objects: map[string][]byte{}}
+	m := &MirrorStorage{
+		primary:       primary,
+		secondary:     secondary,
+		primaryName:   "primary",
+		secondaryName: "secondary",
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	storedPath, err := m.Write("a/b.txt", bytes.NewReader([]byte("data")), 4, "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url, err := m.GetURL(storedPath, time.Minute); err != nil || url != "https://primary/a/b.txt" {
+		t.Fatalf("主存储完好时应返回主存储直链, got %q, %v", url, err)
+	}
+
+	delete(primary.objects, "a/b.txt")
+	if url, err := m.GetURL(storedPath, time.Minute); err != nil || url != "https://secondary/a/b.txt" {
+		t.Fatalf("主存储缺失时应返回副存储直链, got %q, %v", url, err)
+	}
+
+	delete(secondary.objects, "a/b.txt")
+	if _, err := m.GetURL(storedPath, time.Minute); !errors.Is(err, ErrURLUnsupported) {
+		t.Fatalf("主副存储均缺失时应返回 ErrURLUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"linkit/internal/config"
+)
+
+// Profile 是保存在数据库中的命名存储配置，如 s3-archive、s3-hot。
+// Options 使用 AppConfig 的配置键（如 S3_BUCKET），未填写的项沿用全局配置。
+type Profile struct {
+	Name    string            `json:"name"`
+	Driver  string            `json:"driver"`
+	Options map[string]string `json:"options"`
+}
+
+var profileNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// CanonicalProfile 统一存储名大小写，并将驱动别名映射为平台名。
+func CanonicalProfile(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return ""
+	}
+	if platform, err := NormalizeDriver(name); err == nil {
+		return string(platform)
+	}
+	return name
+}
+
+// ValidateProfile 校验配置名、驱动与配置项，不会建立连接。
+func ValidateProfile(p Profile) error {
+	if !profileNameRegex.MatchString(p.Name) {
+		return fmt.Errorf("存储配置名只能包含小写字母、数字、- 和 _，且不超过 32 个字符")
+	}
+	if _, err := NormalizeDriver(p.Name); err == nil {
+		return fmt.Errorf("存储配置名不能与内置驱动同名: %s", p.Name)
+	}
+	platform, err := NormalizeDriver(p.Driver)
+	if err != nil || strings.TrimSpace(p.Driver) == "" {
+		return fmt.Errorf("无效的存储驱动: %s", p.Driver)
+	}
+	if platform == PlatformLocal {
+		return fmt.Errorf("本地存储不支持命名配置")
+	}
+	var probe config.Config
+	for key, value := range p.Options {
+		if strings.EqualFold(strings.TrimSpace(key), "STORAGE_DRIVER") || !probe.SetAppConfigValue(key, value) {
+			return fmt.Errorf("存储配置 %s 的配置项无效: %s", p.Name, key)
+		}
+	}
+	return nil
+}
+
+// PathPrefix 返回该配置写入的存储路径前缀，用于统计引用。
+func (p Profile) PathPrefix() string {
+	return CanonicalProfile(p.Driver) + "+" + p.Name + ":"
+}
+
+// BuildProfile 基于全局配置叠加 Options 创建命名配置对应的驱动。
+func BuildProfile(cfg config.Config, p Profile, logger *slog.Logger) (Storage, error) {
+	if err := ValidateProfile(p); err != nil {
+		return nil, err
+	}
+	platform, _ := NormalizeDriver(p.Driver)
+	for key, value := range p.Options {
+		cfg.SetAppConfigValue(key, value)
+	}
+	stg, err := newDriver(platform, p.Name, cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("存储配置 %s 无效: %w", p.Name, err)
+	}
+	return stg, nil
+}
+
+// newDriver 创建指定平台的驱动，profile 非空时写入的路径会带上配置名。
+func newDriver(platform BucketPlatform, profile string, cfg config.Config, logger *slog.Logger) (Storage, error) {
+	switch platform {
+	case PlatformLocal:
+		return NewLocal(cfg.LocalRoot)
+	case PlatformS3:
+		s, err := NewS3(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.profile = profile
+		return s, nil
+	case PlatformWebDAV:
+		s, err := NewWebDAV(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.profile = profile
+		return s, nil
+	case PlatformSFTP:
+		s, err := NewSFTP(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		s.profile = profile
+		return s, nil
+	default:
+		return nil, fmt.Errorf("无效的存储驱动: %s", platform)
+	}
+}
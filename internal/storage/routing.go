@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RoutingRule 描述一条上传路由规则，所有已填写的条件同时满足时命中。
+// 规则按顺序匹配，第一条命中的规则决定写入的存储；均未命中时使用默认存储。
+type RoutingRule struct {
+	Name string `json:"name,omitempty"`
+	// Users 为用户名列表，访客上传使用 guest。
+	Users []string `json:"users,omitempty"`
+	// Tags 命中任意一个标签即可。
+	Tags []string `json:"tags,omitempty"`
+	// Mime 支持完整类型（image/png）或通配（video/*）。
+	Mime  []string `json:"mime,omitempty"`
+	MinMb int64    `json:"minMb,omitempty"`
+	MaxMb int64    `json:"maxMb,omitempty"`
+	// Target 为目标存储名：内置驱动平台名或命名存储配置名。
+	Target string `json:"target"`
+}
+
+// UploadMeta 为路由判断所需的上传信息。
+type UploadMeta struct {
+	Username    string
+	Tags        []string
+	ContentType string
+	Size        int64
+}
+
+// ParseRoutingRules 解析 STORAGE_ROUTING_RULES（JSON 数组），空值表示不启用路由。
+func ParseRoutingRules(raw string) ([]RoutingRule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var rules []RoutingRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("存储路由规则格式错误: %w", err)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		rule.Target = CanonicalProfile(rule.Target)
+		if rule.Target == "" {
+			return nil, fmt.Errorf("第 %d 条存储路由规则缺少 target", i+1)
+		}
+		if rule.MinMb < 0 || rule.MaxMb < 0 || (rule.MaxMb > 0 && rule.MinMb > rule.MaxMb) {
+			return nil, fmt.Errorf("第 %d 条存储路由规则的大小范围无效", i+1)
+		}
+		rule.Users = normalizeRuleValues(rule.Users)
+		rule.Tags = normalizeRuleValues(rule.Tags)
+		rule.Mime = normalizeRuleValues(rule.Mime)
+	}
+	return rules, nil
+}
+
+// ValidateRoutingRules 检查每条规则的目标存储均已配置，避免规则因目标缺失被静默跳过。
+func ValidateRoutingRules(rules []RoutingRule, storages map[string]Storage) error {
+	for i, rule := range rules {
+		if _, ok := storages[rule.Target]; !ok {
+			return fmt.Errorf("第 %d 条存储路由规则的目标存储不存在: %s", i+1, rule.Target)
+		}
+	}
+	return nil
+}
+
+func normalizeRuleValues(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (rule RoutingRule) Match(meta UploadMeta) bool {
+	if len(rule.Users) > 0 && !containsFold(rule.Users, meta.Username) {
+		return false
+	}
+	if len(rule.Tags) > 0 {
+		hit := false
+		for _, tag := range meta.Tags {
+			if containsFold(rule.Tags, tag) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return false
+		}
+	}
+	if len(rule.Mime) > 0 {
+		contentType := strings.ToLower(strings.TrimSpace(meta.ContentType))
+		if i := strings.Index(contentType, ";"); i >= 0 {
+			contentType = strings.TrimSpace(contentType[:i])
+		}
+		hit := false
+		for _, pattern := range rule.Mime {
+			if pattern == "*" || pattern == "*/*" || pattern == contentType ||
+				(strings.HasSuffix(pattern, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*"))) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return false
+		}
+	}
+	const mb = 1024 * 1024
+	if rule.MinMb > 0 && meta.Size < rule.MinMb*mb {
+		return false
+	}
+	if rule.MaxMb > 0 && meta.Size > rule.MaxMb*mb {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, target string) bool {
+	target = strings.TrimSpace(target)
+	for _, v := range values {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Route 按路由规则选择本次上传的目标存储，返回存储名与驱动。
+func (r *Registry) Route(meta UploadMeta) (string, Storage) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rule := range r.Rules {
+		if !rule.Match(meta) {
+			continue
+		}
+		if s, ok := r.Storages[rule.Target]; ok {
+			return rule.Target, s
+		}
+	}
+	return r.DefaultDriver, r.Storages[r.DefaultDriver]
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	cfgpkg "linkit/internal/config"
+)
+
+func TestParseRoutingRules(t *testing.T) {
+	rules, err := ParseRoutingRules(`[{"target":" S3 ","users":[" Alice ",""],"tags":["Archive"],"mime":["Video/*"],"minMb":1,"maxMb":2}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rules[0]
+	if rule.Target != "s3" || len(rule.Users) != 1 || rule.Users[0] != "alice" || rule.Tags[0] != "archive" || rule.Mime[0] != "video/*" {
+		t.Fatalf("规则应规范化大小写与空白: %+v", rule)
+	}
+	if rules, err := ParseRoutingRules("  "); err != nil || rules != nil {
+		t.Fatalf("空值表示不启用路由: %v %v", rules, err)
+	}
+	for _, raw := range []string{
+		`{"target":"s3"}`,
+		`[{"users":["alice"]}]`,
+		`[{"target":"s3","minMb":-1}]`,
+		`[{"target":"s3","minMb":10,"maxMb":5}]`,
+	} {
+		if _, err := ParseRoutingRules(raw); err == nil {
+			t.Errorf("应拒绝无效规则: %s", raw)
+		}
+	}
+}
+
+func TestRoutingRuleMatch(t *testing.T) {
+	const mb = 1024 * 1024
+	cases := []struct {
+		name string
+		rule RoutingRule
+		meta UploadMeta
+		want bool
+	}{
+		{"空条件命中全部", RoutingRule{}, UploadMeta{Username: "alice"}, true},
+		{"用户命中", RoutingRule{Users: []string{"alice"}}, UploadMeta{Username: "Alice"}, true},
+		{"用户未命中", RoutingRule{Users: []string{"alice"}}, UploadMeta{Username: "bob"}, false},
+		{"访客", RoutingRule{Users: []string{"guest"}}, UploadMeta{Username: "guest"}, true},
+		{"任一标签命中", RoutingRule{Tags: []string{"archive", "cold"}}, UploadMeta{Tags: []string{"photo", "Cold"}}, true},
+		{"标签未命中", RoutingRule{Tags: []string{"archive"}}, UploadMeta{Tags: []string{"photo"}}, false},
+		{"无标签", RoutingRule{Tags: []string{"archive"}}, UploadMeta{}, false},
+		{"完整类型", RoutingRule{Mime: []string{"image/png"}}, UploadMeta{ContentType: "image/png"}, true},
+		{"忽略参数", RoutingRule{Mime: []string{"text/plain"}}, UploadMeta{ContentType: "Text/Plain; charset=utf-8"}, true},
+		{"通配主类型", RoutingRule{Mime: []string{"video/*"}}, UploadMeta{ContentType: "video/mp4"}, true},
+		{"通配不跨主类型", RoutingRule{Mime: []string{"video/*"}}, UploadMeta{ContentType: "audio/mp4"}, false},
+		{"通配不匹配前缀", RoutingRule{Mime: []string{"video/*"}}, UploadMeta{ContentType: "videox/mp4"}, false},
+		{"全部通配", RoutingRule{Mime: []string{"*/*"}}, UploadMeta{ContentType: "application/zip"}, true},
+		{"达到下限", RoutingRule{MinMb: 200}, UploadMeta{Size: 200 * mb}, true},
+		{"低于下限", RoutingRule{MinMb: 200}, UploadMeta{Size: 200*mb - 1}, false},
+		{"达到上限", RoutingRule{MaxMb: 5}, UploadMeta{Size: 5 * mb}, true},
+		{"超过上限", RoutingRule{MaxMb: 5}, UploadMeta{Size: 5*mb + 1}, false},
+		{"条件同时满足", RoutingRule{Users: []string{"alice"}, Mime: []string{"video/*"}, MinMb: 1}, UploadMeta{Username: "alice", ContentType: "video/mp4", Size: 2 * mb}, true},
+		{"任一条件不满足", RoutingRule{Users: []string{"alice"}, Mime: []string{"video/*"}, MinMb: 1}, UploadMeta{Username: "alice", ContentType: "video/mp4", Size: mb - 1}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.rule.Match(tc.meta); got != tc.want {
+				t.Fatalf("Match = %v, 期望 %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRegistryRoute(t *testing.T) {
+	storages := make(map[string]Storage)
+	for _, name := range []string{"local", "s3", "archive"} {
+		stg, err := NewLocal(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		storages[name] = stg
+	}
+	rules, err := ParseRoutingRules(`[
+		{"name":"guest","users":["guest"],"target":"local"},
+		{"name":"archive","tags":["archive"],"target":"archive"},
+		{"name":"video","mime":["video/*"],"minMb":200,"target":"s3"},
+		{"name":"fallback-video","mime":["video/*"],"target":"archive"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := &Registry{DefaultDriver: "local", Storages: storages, Rules: rules}
+	const mb = 1024 * 1024
+	cases := []struct {
+		name string
+		meta UploadMeta
+		want string
+	}{
+		{"访客视频仍写本地", UploadMeta{Username: "guest", ContentType: "video/mp4", Size: 500 * mb}, "local"},
+		{"标签先于大小规则", UploadMeta{Username: "alice", Tags: []string{"archive"}, ContentType: "video/mp4", Size: 500 * mb}, "archive"},
+		{"大视频", UploadMeta{Username: "alice", ContentType: "video/mp4", Size: 500 * mb}, "s3"},
+		{"小视频命中后续规则", UploadMeta{Username: "alice", ContentType: "video/mp4", Size: mb}, "archive"},
+		{"未命中使用默认存储", UploadMeta{Username: "alice", ContentType: "image/png", Size: mb}, "local"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, stg := reg.Route(tc.meta)
+			if name != tc.want || stg != storages[tc.want] {
+				t.Fatalf("Route = %s, 期望 %s", name, tc.want)
+			}
+		})
+	}
+}
+
+func TestRegistryValidateRejectsUnknownRoutingTarget(t *testing.T) {
+	reg := &Registry{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	var cfg cfgpkg.Config
+	cfg.LocalRoot = t.TempDir()
+	cfg.AppConfig.StorageDriver = "local"
+
+	cfg.AppConfig.StorageRoutingRules = `[{"users":["guest"],"target":"LOCAL"}]`
+	if err := reg.Validate(cfg); err != nil {
+		t.Fatalf("目标存储存在时应通过校验: %v", err)
+	}
+	for _, target := range []string{"archive", "s3"} {
+		cfg.AppConfig.StorageRoutingRules = `[{"users":["guest"],"target":"local"},{"tags":["x"],"target":"` + target + `"}]`
+		err := reg.Validate(cfg)
+		if err == nil || !strings.Contains(err.Error(), "第 2 条") || !strings.Contains(err.Error(), target) {
+			t.Fatalf("未配置的目标存储 %s 应被拒绝: %v", target, err)
+		}
+	}
+}
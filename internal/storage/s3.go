@@ -3,8 +3,10 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"log/slog"
@@ -13,12 +15,20 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 
 	cfgpkg "linkit/internal/config"
 )
 
+const (
+	// S3 要求除最后一片外每片至少 5MB，这里取 8MB 与前端分片大小保持一致。
+	s3PartSize = 8 * 1024 * 1024
+	s3MaxParts = 10000
+)
+
 type S3Storage struct {
 	bucket    string
+	profile   string
 	client    *s3.Client
 	presigner *s3.PresignClient
 	logger    *slog.Logger
@@ -55,41 +65,202 @@ func (s *S3Storage) Platform() BucketPlatform {
 	return PlatformS3
 }
 
+func (s *S3Storage) Bucket() string {
+	return s.bucket
+}
+
 func (s *S3Storage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
 	normalized, err := NormalizeObjectKey(objectKey)
 	if err != nil {
 		return "", err
 	}
 
-	// 若 size <0 需要缓存到内存以便 ContentLength
-	var body io.Reader = r
-	var buf *bytes.Buffer
-	if size < 0 {
-		buf = new(bytes.Buffer)
-		if _, err := io.Copy(buf, r); err != nil {
+	if size < 0 || size > s3PartSize {
+		// 大小未知或超过单个分片时走 multipart 上传，内存占用固定为一个分片缓冲。
+		if err := s.writeMultipart(normalized, r, contentType); err != nil {
 			return "", err
 		}
-		size = int64(buf.Len())
-		body = buf
+		return BuildProfilePath(PlatformS3, s.profile, s.bucket, normalized)
 	}
+	if err := s.putObject(normalized, r, size, contentType); err != nil {
+		return "", err
+	}
+	return BuildProfilePath(PlatformS3, s.profile, s.bucket, normalized)
+}
 
-	contentLength := aws.Int64(size)
-
-	_, err = s.client.PutObject(context.Background(), &s3.PutObjectInput{
+func (s *S3Storage) putObject(key string, body io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
 		Bucket:        &s.bucket,
-		Key:           &normalized,
+		Key:           &key,
 		Body:          body,
-		ContentLength: contentLength,
+		ContentLength: aws.Int64(size),
 		ContentType:   &contentType,
 		ACL:           types.ObjectCannedACLPrivate,
 	})
+	return err
+}
+
+// writeMultipart 以固定大小的分片缓冲流式读取 r，并通过 S3 multipart API 逐片上传。
+// 若首个分片即读到末尾，则退化为普通 PutObject。
+// 分片上传不直接映射为 S3 part：对象 key、路由规则与去重都依赖合并后才能得到的 hash 与文件类型，
+// 且加密、镜像存储只接受完整的写入流，因此分片仍先落盘合并，再经这里流式写入。
+func (s *S3Storage) writeMultipart(key string, r io.Reader, contentType string) error {
+	buf := make([]byte, s3PartSize)
+	n, readErr := io.ReadFull(r, buf)
+	if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+		return s.putObject(key, bytes.NewReader(buf[:n]), int64(n), contentType)
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	uploadID, err := s.CreateMultipart(key, contentType)
+	if err != nil {
+		return err
+	}
+	abort := func(cause error) error {
+		if err := s.AbortMultipart(key, uploadID); err != nil {
+			s.logger.Warn("取消 multipart 上传失败", "key", key, "err", err)
+		}
+		return cause
+	}
+
+	ctx := context.Background()
+	var parts []UploadedPart
+	for partNumber := int32(1); ; partNumber++ {
+		if partNumber > s3MaxParts {
+			return abort(fmt.Errorf("文件超过 S3 分片数量上限"))
+		}
+		out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        &s.bucket,
+			Key:           &key,
+			UploadId:      &uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(buf[:n]),
+			ContentLength: aws.Int64(int64(n)),
+		})
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, UploadedPart{PartNumber: partNumber, ETag: aws.ToString(out.ETag)})
+		if readErr != nil {
+			break
+		}
+		n, readErr = io.ReadFull(r, buf)
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil && readErr != io.ErrUnexpectedEOF {
+			return abort(readErr)
+		}
+	}
+
+	if err := s.CompleteMultipart(key, uploadID, parts); err != nil {
+		return abort(err)
+	}
+	return nil
+}
+
+func (s *S3Storage) StoredPath(objectKey string) (string, error) {
+	return BuildProfilePath(PlatformS3, s.profile, s.bucket, objectKey)
+}
+
+// PresignPut 生成单次 PUT 直传链接，客户端需携带相同的 Content-Type。
+func (s *S3Storage) PresignPut(objectKey, contentType string, size int64, expires time.Duration) (string, error) {
+	key, err := NormalizeObjectKey(objectKey)
 	if err != nil {
 		return "", err
 	}
-	return BuildStoredPath(PlatformS3, s.bucket, normalized)
+	presigned, err := s.presigner.PresignPutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        &s.bucket,
+		Key:           &key,
+		ContentType:   &contentType,
+		ContentLength: aws.Int64(size),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expires
+	})
+	if err != nil {
+		return "", err
+	}
+	return presigned.URL, nil
+}
+
+func (s *S3Storage) CreateMultipart(objectKey, contentType string) (string, error) {
+	key, err := NormalizeObjectKey(objectKey)
+	if err != nil {
+		return "", err
+	}
+	created, err := s.client.CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+		Bucket:      &s.bucket,
+		Key:         &key,
+		ContentType: &contentType,
+		ACL:         types.ObjectCannedACLPrivate,
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(created.UploadId), nil
+}
+
+func (s *S3Storage) PresignUploadPart(objectKey, uploadID string, partNumber int32, expires time.Duration) (string, error) {
+	key, err := NormalizeObjectKey(objectKey)
+	if err != nil {
+		return "", err
+	}
+	presigned, err := s.presigner.PresignUploadPart(context.Background(), &s3.UploadPartInput{
+		Bucket:     &s.bucket,
+		Key:        &key,
+		UploadId:   &uploadID,
+		PartNumber: aws.Int32(partNumber),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expires
+	})
+	if err != nil {
+		return "", err
+	}
+	return presigned.URL, nil
+}
+
+func (s *S3Storage) CompleteMultipart(objectKey, uploadID string, parts []UploadedPart) error {
+	key, err := NormalizeObjectKey(objectKey)
+	if err != nil {
+		return err
+	}
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.PartNumber),
+		})
+	}
+	_, err = s.client.CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
+
+func (s *S3Storage) AbortMultipart(objectKey, uploadID string) error {
+	key, err := NormalizeObjectKey(objectKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   &s.bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	return err
 }
 
 func (s *S3Storage) GetURL(storedPath string, expires time.Duration) (string, error) {
+	return s.GetDownloadURL(storedPath, expires, DownloadOptions{})
+}
+
+// GetDownloadURL 生成下载签名链接，通过 response-content-* 参数覆盖响应头。
+func (s *S3Storage) GetDownloadURL(storedPath string, expires time.Duration, opts DownloadOptions) (string, error) {
 	platform, bucket, key, err := ParseStoredPath(storedPath)
 	if err != nil {
 		return "", err
@@ -101,11 +272,18 @@ func (s *S3Storage) GetURL(storedPath string, expires time.Duration) (string, er
 	if exp <= 0 {
 		exp = 30 * time.Minute
 	}
-	presigned, err := s.presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: &bucket,
 		Key:    &key,
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = exp
+	}
+	if opts.ContentType != "" {
+		input.ResponseContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	presigned, err := s.presigner.PresignGetObject(context.Background(), input, func(po *s3.PresignOptions) {
+		po.Expires = exp
 	})
 	if err != nil {
 		return "", err
@@ -113,16 +291,67 @@ func (s *S3Storage) GetURL(storedPath string, expires time.Duration) (string, er
 	return presigned.URL, nil
 }
 
-func (s *S3Storage) Delete(storedPath string) error {
-	platform, bucket, key, err := ParseStoredPath(storedPath)
+func (s *S3Storage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	return s.OpenContext(context.Background(), storedPath, rangeStart, rangeEnd)
+}
+
+// OpenContext 读取对象，ctx 取消后中断下载。
+func (s *S3Storage) OpenContext(ctx context.Context, storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	bucket, key, err := s.locate(storedPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if platform != PlatformS3 {
-		return fmt.Errorf("存储路径与 S3 不匹配")
+	input := &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
 	}
-	if bucket == "" {
-		bucket = s.bucket
+	if rangeStart > 0 || rangeEnd >= 0 {
+		byteRange := fmt.Sprintf("bytes=%d-", rangeStart)
+		if rangeEnd >= 0 {
+			byteRange = fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd)
+		}
+		input.Range = &byteRange
+	}
+	out, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3Storage) Stat(storedPath string) (ObjectInfo, error) {
+	return s.StatContext(context.Background(), storedPath)
+}
+
+func (s *S3Storage) StatContext(ctx context.Context, storedPath string) (ObjectInfo, error) {
+	bucket, key, err := s.locate(storedPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	info := ObjectInfo{Size: aws.ToInt64(out.ContentLength), ETag: strings.Trim(aws.ToString(out.ETag), `"`)}
+	if out.LastModified != nil {
+		info.ModTime = *out.LastModified
+	}
+	return info, nil
+}
+
+func (s *S3Storage) Delete(storedPath string) error {
+	bucket, key, err := s.locate(storedPath)
+	if err != nil {
+		return err
 	}
 	_, err = s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
 		Bucket: &bucket,
@@ -130,3 +359,29 @@ func (s *S3Storage) Delete(storedPath string) error {
 	})
 	return err
 }
+
+func (s *S3Storage) locate(storedPath string) (string, string, error) {
+	platform, bucket, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return "", "", err
+	}
+	if platform != PlatformS3 {
+		return "", "", fmt.Errorf("存储路径与 S3 不匹配")
+	}
+	if bucket == "" {
+		bucket = s.bucket
+	}
+	return bucket, key, nil
+}
+
+func isS3NotFound(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "NoSuchKey", "NotFound":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cfgpkg "linkit/internal/config"
+)
+
+// s3StandIn 以内存实现 PutObject、multipart 上传与对象读取，模拟路径风格的 S3 兼容服务。
+type s3StandIn struct {
+	*httptest.Server
+	bucket   string
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	puts     int
+	parts    []int // 每次 UploadPart 的请求体大小
+	aborted  int
+	failPart int // 上传该序号的分片时返回错误
+}
+
+func startS3StandIn(t *testing.T) *s3StandIn {
+	t.Helper()
+	s := &s3StandIn{bucket: "linkit", objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *s3StandIn) serve(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+s.bucket+"/")
+	if !ok {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", s.bucket, key, id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		s.parts = append(s.parts, len(body))
+		if number == s.failPart {
+			s3Error(w, http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		parts[number] = body
+		w.Header().Set("ETag", etagOf(body))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		id := query.Get("uploadId")
+		parts, ok := s.uploads[id]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var req struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &req); err != nil {
+			s3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var object []byte
+		for i, part := range req.Parts {
+			data, ok := parts[part.PartNumber]
+			if !ok || part.PartNumber != i+1 || part.ETag != etagOf(data) {
+				s3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			object = append(object, data...)
+		}
+		s.objects[key] = object
+		delete(s.uploads, id)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>%s</ETag></CompleteMultipartUploadResult>", s.bucket, key, etagOf(object))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		s.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+		s.puts++
+		w.Header().Set("ETag", etagOf(body))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", etagOf(data))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func newTestS3(t *testing.T, srv *s3StandIn) *S3Storage {
+	t.Helper()
+	var cfg cfgpkg.Config
+	cfg.AppConfig.S3Endpoint = srv.URL
+	cfg.AppConfig.S3Region = "us-east-1"
+	cfg.AppConfig.S3Bucket = srv.bucket
+	cfg.AppConfig.S3AccessKey = "linkit"
+	cfg.AppConfig.S3SecretKey = "secret"
+	stg, err := NewS3(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stg
+}
+
+// onlyReader 隐藏底层 reader 的其他接口，模拟无法回退的上传流。
+type onlyReader struct{ io.Reader }
+
+func TestS3WriteStreamsUnknownSizeAsMultipart(t *testing.T) {
+	srv := startS3StandIn(t)
+	stg := newTestS3(t, srv)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*s3PartSize+s3PartSize/2)/16)
+	storedPath, err := stg.Write("2024-01/big.bin", onlyReader{bytes.NewReader(data)}, -1, "application/octet-stream")
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if want := []int{s3PartSize, s3PartSize, s3PartSize / 2}; fmt.Sprint(srv.parts) != fmt.Sprint(want) {
+		t.Fatalf("分片大小 = %v, 期望 %v", srv.parts, want)
+	}
+	if srv.puts != 0 || len(srv.uploads) != 0 {
+		t.Fatalf("应通过 multipart 完成上传: puts=%d pending=%d", srv.puts, len(srv.uploads))
+	}
+	got, err := readRange(t, stg, storedPath, 0, -1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("合并后的对象内容不一致")
+	}
+}
+
+func TestS3WriteSmallUnknownSizeUsesPutObject(t *testing.T) {
+	srv := startS3StandIn(t)
+	stg := newTestS3(t, srv)
+
+	data := []byte("small object")
+	storedPath, err := stg.Write("small.txt", onlyReader{bytes.NewReader(data)}, -1, "text/plain")
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if srv.puts != 1 || len(srv.parts) != 0 {
+		t.Fatalf("不足一个分片时应直接 PutObject: puts=%d parts=%v", srv.puts, srv.parts)
+	}
+	info, err := stg.Stat(storedPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(data)) || info.ETag != strings.Trim(etagOf(data), `"`) {
+		t.Fatalf("Stat 结果不符合预期: %+v", info)
+	}
+}
+
+func TestS3WriteAbortsMultipartOnPartFailure(t *testing.T) {
+	srv := startS3StandIn(t)
+	srv.failPart = 2
+	stg := newTestS3(t, srv)
+
+	data := make([]byte, 2*s3PartSize+1)
+	if _, err := stg.Write("broken.bin", bytes.NewReader(data), -1, ""); err == nil {
+		t.Fatal("分片上传失败时 Write 应返回错误")
+	}
+	if srv.aborted != 1 || len(srv.uploads) != 0 {
+		t.Fatalf("失败后应中止 multipart 上传: aborted=%d pending=%d", srv.aborted, len(srv.uploads))
+	}
+	if _, ok := srv.objects["broken.bin"]; ok {
+		t.Fatal("失败的上传不应留下对象")
+	}
+}
+
+func TestS3OpenContextCancelled(t *testing.T) {
+	srv := startS3StandIn(t)
+	stg := newTestS3(t, srv)
+	storedPath, err := stg.Write("a.txt", strings.NewReader("content"), 7, "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := OpenContext(ctx, stg, storedPath, 0, -1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("请求已取消时应中止读取: %v", err)
+	}
+	mirror := &MirrorStorage{primary: stg, secondary: stg, primaryName: "s3", secondaryName: "backup", logger: stg.logger}
+	if _, err := StatContext(ctx, mirror, storedPath); !errors.Is(err, context.Canceled) {
+		t.Fatalf("镜像存储应透传请求上下文: %v", err)
+	}
+}
+
+func TestS3GetDownloadURLOverridesResponseHeaders(t *testing.T) {
+	srv := startS3StandIn(t)
+	stg := newTestS3(t, srv)
+	storedPath, err := stg.StoredPath("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := stg.GetDownloadURL(storedPath, time.Minute, DownloadOptions{ContentType: "application/octet-stream", ContentDisposition: `attachment; filename="page.html"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("response-content-type") != "application/octet-stream" || query.Get("response-content-disposition") != `attachment; filename="page.html"` {
+		t.Fatalf("签名链接应覆盖响应头: %s", signed)
+	}
+	plain, err := stg.GetURL(storedPath, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, "response-content") {
+		t.Fatalf("GetURL 不应覆盖响应头: %s", plain)
+	}
+}
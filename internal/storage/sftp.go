@@ -0,0 +1,372 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	cfgpkg "linkit/internal/config"
+)
+
+var errSFTPClosed = errors.New("SFTP 存储已关闭")
+
+// SFTPStorage 通过 SSH/SFTP 读写远端目录，连接按需建立并在断开后自动重连。
+type SFTPStorage struct {
+	host    string
+	profile string
+	addr    string
+	rootDir string
+	sshCfg  *ssh.ClientConfig
+	logger  *slog.Logger
+	// settings 为连接相关配置的摘要，热更新时配置未变化则沿用同一实例
+	settings string
+	mu       sync.Mutex
+	conn     *ssh.Client
+	client   *sftp.Client
+	// active 为进行中的读写数（包括尚未关闭的下载流），Close 后等其归零再断开连接
+	active int
+	closed bool
+}
+
+func NewSFTP(cfg cfgpkg.Config, logger *slog.Logger) (*SFTPStorage, error) {
+	app := cfg.AppConfig
+	host := strings.TrimSpace(app.SFTPHost)
+	if host == "" || strings.TrimSpace(app.SFTPUser) == "" {
+		return nil, fmt.Errorf("缺少 SFTP 配置")
+	}
+	port := app.SFTPPort
+	if port <= 0 {
+		port = 22
+	}
+
+	var auths []ssh.AuthMethod
+	if key := strings.TrimSpace(app.SFTPPrivateKey); key != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(key))
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && app.SFTPPassword != "" {
+			// 私钥已加密时将密码作为私钥口令使用
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(key), []byte(app.SFTPPassword))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SFTP 私钥无效: %w", err)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if app.SFTPPassword != "" {
+		auths = append(auths, ssh.Password(app.SFTPPassword))
+	}
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("SFTP 需要配置密码或私钥")
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if raw := strings.TrimSpace(app.SFTPHostKey); raw != "" {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("SFTP 主机公钥无效: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(pub)
+	} else if app.SFTPInsecureSkipHostKey {
+		logger.Warn("已设置 SFTP_INSECURE_SKIP_HOST_KEY，将跳过主机公钥校验", "host", host)
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		return nil, fmt.Errorf("缺少 SFTP_HOST_KEY，如确需跳过主机公钥校验请设置 SFTP_INSECURE_SKIP_HOST_KEY=true")
+	}
+
+	// 相对路径以登录用户的主目录为基准
+	rootDir := strings.TrimSpace(app.SFTPRootDir)
+	if rootDir != "" {
+		rootDir = path.Clean(rootDir)
+	}
+	return &SFTPStorage{
+		host:    host,
+		addr:    net.JoinHostPort(host, strconv.Itoa(port)),
+		rootDir: rootDir,
+		settings: fmt.Sprintf("%q", []string{host, strconv.Itoa(port), app.SFTPUser, app.SFTPPassword, app.SFTPPrivateKey,
+			app.SFTPHostKey, rootDir, strconv.FormatBool(app.SFTPInsecureSkipHostKey)}),
+		sshCfg: &ssh.ClientConfig{
+			User:            app.SFTPUser,
+			Auth:            auths,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         10 * time.Second,
+		},
+		logger: logger,
+	}, nil
+}
+
+func (s *SFTPStorage) Platform() BucketPlatform {
+	return PlatformSFTP
+}
+
+func (s *SFTPStorage) Bucket() string {
+	return s.host
+}
+
+func (s *SFTPStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	normalized, err := NormalizeObjectKey(objectKey)
+	if err != nil {
+		return "", err
+	}
+	if err := s.begin(); err != nil {
+		return "", err
+	}
+	defer s.end()
+	target := s.resolve(normalized)
+	var f *sftp.File
+	err = s.withClient(func(client *sftp.Client) error {
+		if err := client.MkdirAll(path.Dir(target)); err != nil {
+			return err
+		}
+		f, err = client.Create(target)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	_, err = f.ReadFrom(r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return BuildProfilePath(PlatformSFTP, s.profile, s.host, normalized)
+}
+
+// GetURL SFTP 没有可供浏览器访问的地址，下载统一经服务端转发。
+func (s *SFTPStorage) GetURL(storedPath string, expires time.Duration) (string, error) {
+	return "", ErrURLUnsupported
+}
+
+func (s *SFTPStorage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	key, err := s.locate(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	var f *sftp.File
+	err = s.withClient(func(client *sftp.Client) error {
+		f, err = client.Open(s.resolve(key))
+		return err
+	})
+	if err != nil {
+		s.end()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	if rangeStart > 0 {
+		if _, err := f.Seek(rangeStart, io.SeekStart); err != nil {
+			f.Close()
+			s.end()
+			return nil, err
+		}
+	}
+	var r io.Reader = f
+	if rangeEnd >= 0 {
+		r = io.LimitReader(f, rangeEnd-rangeStart+1)
+	}
+	return readCloser{Reader: r, Closer: &sftpFileCloser{file: f, storage: s}}, nil
+}
+
+// sftpFileCloser 关闭远端文件并结束对应的读写计数，重复关闭只生效一次。
+type sftpFileCloser struct {
+	file    *sftp.File
+	storage *SFTPStorage
+	once    sync.Once
+}
+
+func (c *sftpFileCloser) Close() error {
+	err := os.ErrClosed
+	c.once.Do(func() {
+		err = c.file.Close()
+		c.storage.end()
+	})
+	return err
+}
+
+func (s *SFTPStorage) Stat(storedPath string) (ObjectInfo, error) {
+	key, err := s.locate(storedPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := s.begin(); err != nil {
+		return ObjectInfo{}, err
+	}
+	defer s.end()
+	var stat os.FileInfo
+	err = s.withClient(func(client *sftp.Client) error {
+		stat, err = client.Stat(s.resolve(key))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return ObjectInfo{Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (s *SFTPStorage) Delete(storedPath string) error {
+	key, err := s.locate(storedPath)
+	if err != nil {
+		return err
+	}
+	if err := s.begin(); err != nil {
+		return err
+	}
+	defer s.end()
+	err = s.withClient(func(client *sftp.Client) error {
+		return client.Remove(s.resolve(key))
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// withClient 在连接已断开但尚未被清理时丢弃旧连接并重试一次。
+func (s *SFTPStorage) withClient(fn func(*sftp.Client) error) error {
+	for attempt := 0; ; attempt++ {
+		client, err := s.sftpClient()
+		if err != nil {
+			return err
+		}
+		err = fn(client)
+		if attempt == 0 && errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+			s.dropClient(client)
+			continue
+		}
+		return err
+	}
+}
+
+func (s *SFTPStorage) dropClient(client *sftp.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == client {
+		s.conn.Close()
+		s.conn = nil
+		s.client = nil
+	}
+}
+
+// Close 停止接受新的读写，已开始的读写（包括尚未关闭的下载流）结束后再断开 SSH 连接。
+// 存储配置热更新替换驱动时由 Registry 调用。
+func (s *SFTPStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.active > 0 {
+		return nil
+	}
+	return s.disconnect()
+}
+
+// begin 登记一次读写，驱动已关闭时返回 errSFTPClosed。
+func (s *SFTPStorage) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSFTPClosed
+	}
+	s.active++
+	return nil
+}
+
+// end 结束一次读写，驱动已关闭且没有其他读写时断开连接。
+func (s *SFTPStorage) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if s.closed && s.active == 0 {
+		if err := s.disconnect(); err != nil {
+			s.logger.Debug("断开 SFTP 连接失败", "addr", s.addr, "err", err)
+		}
+	}
+}
+
+// disconnect 断开当前连接，调用方需持有 s.mu。
+func (s *SFTPStorage) disconnect() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	s.client = nil
+	return err
+}
+
+// sameSettings 判断两个驱动的连接配置与配置名是否一致。
+func (s *SFTPStorage) sameSettings(other *SFTPStorage) bool {
+	return s.settings == other.settings && s.profile == other.profile
+}
+
+// sftpClient 返回可用的 SFTP 连接，不存在或已断开时重新拨号；调用方需已通过 begin 登记读写。
+func (s *SFTPStorage) sftpClient() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+	conn, err := ssh.Dial("tcp", s.addr, s.sshCfg)
+	if err != nil {
+		return nil, fmt.Errorf("连接 SFTP 失败: %w", err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("初始化 SFTP 会话失败: %w", err)
+	}
+	s.conn = conn
+	s.client = client
+	go func() {
+		// 连接断开后清理缓存的客户端，下次调用时自动重连。
+		err := conn.Wait()
+		s.mu.Lock()
+		if s.conn == conn {
+			s.conn = nil
+			s.client = nil
+		}
+		s.mu.Unlock()
+		client.Close()
+		s.logger.Debug("SFTP 连接已断开", "addr", s.addr, "err", err)
+	}()
+	return client, nil
+}
+
+func (s *SFTPStorage) resolve(key string) string {
+	if s.rootDir == "" {
+		return key
+	}
+	return path.Join(s.rootDir, key)
+}
+
+func (s *SFTPStorage) locate(storedPath string) (string, error) {
+	platform, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return "", err
+	}
+	if platform != PlatformSFTP {
+		return "", fmt.Errorf("存储路径与 SFTP 不匹配")
+	}
+	return key, nil
+}
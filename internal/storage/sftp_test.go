@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	cfgpkg "linkit/internal/config"
+)
+
+// startSFTPServer 在本地端口启动内存 SFTP 服务，返回地址与 authorized_keys 格式的主机公钥。
+func startSFTPServer(t *testing.T) (string, string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "linkit" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("认证失败")
+		},
+	}
+	serverCfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	handlers := sftp.InMemHandler()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPConn(nc, serverCfg, handlers)
+		}
+	}()
+	return ln.Addr().String(), string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
+
+func serveSFTPConn(nc net.Conn, serverCfg *ssh.ServerConfig, handlers sftp.Handlers) {
+	_, chans, reqs, err := ssh.NewServerConn(nc, serverCfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, requests, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				// subsystem 请求的负载为长度前缀的字符串
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server := sftp.NewRequestServer(ch, handlers)
+					go func() {
+						server.Serve()
+						server.Close()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func testSFTPConfig(addr, hostKey string) cfgpkg.Config {
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+	var cfg cfgpkg.Config
+	cfg.AppConfig.SFTPHost = host
+	cfg.AppConfig.SFTPPort = portNum
+	cfg.AppConfig.SFTPUser = "linkit"
+	cfg.AppConfig.SFTPPassword = "secret"
+	cfg.AppConfig.SFTPHostKey = hostKey
+	cfg.AppConfig.SFTPRootDir = "/data"
+	return cfg
+}
+
+func newTestSFTP(t *testing.T, addr, hostKey string) (*SFTPStorage, error) {
+	t.Helper()
+	return NewSFTP(testSFTPConfig(addr, hostKey), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestSFTPRequiresHostKey(t *testing.T) {
+	if _, err := newTestSFTP(t, "127.0.0.1:22", ""); err == nil {
+		t.Fatal("未配置主机公钥时应拒绝创建 SFTP 驱动")
+	}
+}
+
+func TestSFTPStorageRoundTrip(t *testing.T) {
+	addr, hostKey := startSFTPServer(t)
+	stg, err := newTestSFTP(t, addr, hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stg.Close()
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	storedPath, err := stg.Write("2024/01/a.bin", bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !strings.HasPrefix(storedPath, "sftp:127.0.0.1@/") {
+		t.Fatalf("存储路径不符合预期: %s", storedPath)
+	}
+
+	info, err := stg.Stat(storedPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatalf("Stat 大小 = %d, 期望 %d", info.Size, len(data))
+	}
+
+	for _, tc := range []struct{ start, end int64 }{{0, -1}, {0, 0}, {12345, 67890}, {99990, -1}} {
+		rc, err := stg.Open(storedPath, tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("Open(%d, %d): %v", tc.start, tc.end, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("读取 [%d, %d]: %v", tc.start, tc.end, err)
+		}
+		want := data[tc.start:]
+		if tc.end >= 0 {
+			want = data[tc.start : tc.end+1]
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("区间 [%d, %d] 内容不一致", tc.start, tc.end)
+		}
+	}
+
+	if err := stg.Delete(storedPath); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := stg.Stat(storedPath); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("删除后 Stat 应返回 ErrObjectNotFound, got %v", err)
+	}
+	if _, err := stg.Open(storedPath, 0, -1); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("删除后 Open 应返回 ErrObjectNotFound, got %v", err)
+	}
+	if err := stg.Delete(storedPath); err != nil {
+		t.Fatalf("重复删除应忽略不存在的对象: %v", err)
+	}
+}
+
+func TestSFTPRejectsWrongHostKey(t *testing.T) {
+	addr, _ := startSFTPServer(t)
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stg, err := newTestSFTP(t, addr, string(ssh.MarshalAuthorizedKey(pub)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stg.Close()
+	if _, err := stg.Write("a.txt", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Fatal("主机公钥不匹配时应拒绝连接")
+	}
+}
+
+func TestSFTPClose(t *testing.T) {
+	addr, hostKey := startSFTPServer(t)
+	stg, err := newTestSFTP(t, addr, hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stg.Write("a.txt", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := stg.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := stg.Write("b.txt", strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, errSFTPClosed) {
+		t.Fatalf("关闭后写入应返回 errSFTPClosed, got %v", err)
+	}
+}
+
+func TestSFTPCloseWaitsForOpenReaders(t *testing.T) {
+	addr, hostKey := startSFTPServer(t)
+	stg, err := newTestSFTP(t, addr, hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("linkit-"), 20000)
+	storedPath, err := stg.Write("big.bin", bytes.NewReader(data), int64(len(data)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := stg.Open(storedPath, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stg.Stat(storedPath); !errors.Is(err, errSFTPClosed) {
+		t.Fatalf("关闭后新的读写应返回 errSFTPClosed, got %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("关闭前打开的下载流应能读完: %v", err)
+	}
+	stg.mu.Lock()
+	defer stg.mu.Unlock()
+	if stg.conn != nil {
+		t.Fatal("最后一个读写结束后应断开连接")
+	}
+}
+
+func TestRegistryReloadKeepsUnchangedSFTP(t *testing.T) {
+	addr, hostKey := startSFTPServer(t)
+	cfg := testSFTPConfig(addr, hostKey)
+	cfg.LocalRoot = t.TempDir()
+	reg, err := SetupRegistry(cfg, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := reg.Get("sftp")
+	storedPath, err := before.Write("a.txt", strings.NewReader("hello"), 5, "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := before.Open(storedPath, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 修改与 SFTP 无关的配置，驱动与连接保持不变
+	cfg.AppConfig.GuestUploadEnable = true
+	if err := reg.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := reg.Get("sftp"); after != before {
+		t.Fatal("SFTP 配置未变化时应沿用原驱动")
+	}
+	if _, err := before.Stat(storedPath); err != nil {
+		t.Fatalf("沿用的驱动应可继续使用: %v", err)
+	}
+
+	// 修改 SFTP 配置后替换驱动，已打开的下载流仍可读完
+	cfg.AppConfig.SFTPRootDir = "/other"
+	if err := reg.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := reg.Get("sftp"); after == before {
+		t.Fatal("SFTP 配置变化后应替换驱动")
+	}
+	if got, err := io.ReadAll(r); err != nil || string(got) != "hello" {
+		t.Fatalf("替换驱动前打开的下载流应能读完: %q, %v", got, err)
+	}
+	if _, err := before.Stat(storedPath); !errors.Is(err, errSFTPClosed) {
+		t.Fatalf("被替换的驱动不应再接受新的读写, got %v", err)
+	}
+}
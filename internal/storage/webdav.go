@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfgpkg "linkit/internal/config"
+)
+
+// webdavResponseHeaderTimeout 等待 WebDAV 服务端响应头的最长时间，避免服务端无响应时请求一直挂起。
+const webdavResponseHeaderTimeout = time.Minute
+
+// WebDAVStorage 通过标准 WebDAV 方法（PUT/GET/HEAD/MKCOL/DELETE）读写远端文件，
+// 适用于 Nextcloud、群晖等 WebDAV 服务。
+type WebDAVStorage struct {
+	endpoint *url.URL
+	profile  string
+	basePath string
+	user     string
+	password string
+	client   *http.Client
+	logger   *slog.Logger
+	// dirs 记录已确认存在的目录，避免每次写入都逐级 MKCOL
+	dirs sync.Map
+}
+
+func NewWebDAV(cfg cfgpkg.Config, logger *slog.Logger) (*WebDAVStorage, error) {
+	raw := strings.TrimSpace(cfg.AppConfig.WebDAVURL)
+	if raw == "" {
+		return nil, fmt.Errorf("缺少 WebDAV 配置")
+	}
+	endpoint, err := url.Parse(raw)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("WebDAV 地址无效: %s", raw)
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/")
+	basePath := strings.Trim(path.Clean("/"+strings.TrimSpace(cfg.AppConfig.WebDAVBasePath)), "/")
+	return &WebDAVStorage{
+		endpoint: endpoint,
+		basePath: basePath,
+		user:     cfg.AppConfig.WebDAVUser,
+		password: cfg.AppConfig.WebDAVPassword,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+				MaxIdleConns:        20,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+				// 写入时从请求体发送完毕开始计时，不限制大文件的上传时长
+				ResponseHeaderTimeout: webdavResponseHeaderTimeout,
+			},
+		},
+		logger: logger,
+	}, nil
+}
+
+func (w *WebDAVStorage) Platform() BucketPlatform {
+	return PlatformWebDAV
+}
+
+func (w *WebDAVStorage) Bucket() string {
+	return w.endpoint.Host
+}
+
+func (w *WebDAVStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	normalized, err := NormalizeObjectKey(objectKey)
+	if err != nil {
+		return "", err
+	}
+	ctx := context.Background()
+	if err := w.ensureCollections(ctx, path.Dir(normalized)); err != nil {
+		return "", err
+	}
+	req, err := w.newRequest(ctx, http.MethodPut, normalized, r)
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer drainClose(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	case http.StatusConflict, http.StatusNotFound:
+		// 父目录已被外部删除（RFC 4918 规定返回 409，部分服务端返回 404），清除缓存以便下次写入时重新创建
+		w.dirs.Delete(path.Join(w.basePath, path.Dir(normalized)))
+		return "", fmt.Errorf("WebDAV 写入失败: %s", resp.Status)
+	default:
+		return "", fmt.Errorf("WebDAV 写入失败: %s", resp.Status)
+	}
+	return BuildProfilePath(PlatformWebDAV, w.profile, w.endpoint.Host, normalized)
+}
+
+// GetURL WebDAV 资源需要鉴权，不提供直链，下载统一经服务端转发。
+func (w *WebDAVStorage) GetURL(storedPath string, expires time.Duration) (string, error) {
+	return "", ErrURLUnsupported
+}
+
+func (w *WebDAVStorage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	return w.OpenContext(context.Background(), storedPath, rangeStart, rangeEnd)
+}
+
+// OpenContext 读取对象，ctx 取消后中断下载。
+func (w *WebDAVStorage) OpenContext(ctx context.Context, storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	key, err := w.locate(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	req, err := w.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	ranged := rangeStart > 0 || rangeEnd >= 0
+	if ranged {
+		byteRange := fmt.Sprintf("bytes=%d-", rangeStart)
+		if rangeEnd >= 0 {
+			byteRange = fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd)
+		}
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		if !ranged {
+			return resp.Body, nil
+		}
+		// 服务端忽略 Range 时在本地跳过前缀并截断。
+		if _, err := io.CopyN(io.Discard, resp.Body, rangeStart); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if rangeEnd < 0 {
+			return resp.Body, nil
+		}
+		return readCloser{Reader: io.LimitReader(resp.Body, rangeEnd-rangeStart+1), Closer: resp.Body}, nil
+	case http.StatusNotFound:
+		drainClose(resp.Body)
+		return nil, ErrObjectNotFound
+	default:
+		drainClose(resp.Body)
+		return nil, fmt.Errorf("WebDAV 读取失败: %s", resp.Status)
+	}
+}
+
+func (w *WebDAVStorage) Stat(storedPath string) (ObjectInfo, error) {
+	return w.StatContext(context.Background(), storedPath)
+}
+
+// StatContext 以 HEAD 读取对象信息；服务端未返回 Content-Length（如分块传输）时改用 PROPFIND 的 getcontentlength。
+func (w *WebDAVStorage) StatContext(ctx context.Context, storedPath string) (ObjectInfo, error) {
+	key, err := w.locate(storedPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	req, err := w.newRequest(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer drainClose(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ObjectInfo{}, ErrObjectNotFound
+	default:
+		return ObjectInfo{}, fmt.Errorf("WebDAV 读取文件信息失败: %s", resp.Status)
+	}
+	info := ObjectInfo{Size: resp.ContentLength, ETag: strings.Trim(resp.Header.Get("ETag"), `"`)}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	if info.Size < 0 {
+		size, err := w.propfindSize(ctx, key)
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+		info.Size = size
+	}
+	return info, nil
+}
+
+// davMultistatus PROPFIND 响应中用到的部分，标签按本地名匹配，不区分命名空间前缀。
+type davMultistatus struct {
+	Responses []struct {
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ContentLength string `xml:"getcontentlength"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// propfindSize 通过 Depth: 0 的 PROPFIND 读取文件的 getcontentlength。
+func (w *WebDAVStorage) propfindSize(ctx context.Context, key string) (int64, error) {
+	body := strings.NewReader(`<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:getcontentlength/></d:prop></d:propfind>`)
+	req, err := w.newRequest(ctx, "PROPFIND", key, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Depth", "0")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer drainClose(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusMultiStatus:
+	case http.StatusNotFound:
+		return 0, ErrObjectNotFound
+	default:
+		return 0, fmt.Errorf("WebDAV 读取文件大小失败: %s", resp.Status)
+	}
+	var ms davMultistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&ms); err != nil {
+		return 0, fmt.Errorf("WebDAV 读取文件大小失败: %w", err)
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.Prop.ContentLength == "" || !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if size, err := strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64); err == nil && size >= 0 {
+				return size, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("WebDAV 服务端未返回文件大小")
+}
+
+func (w *WebDAVStorage) Delete(storedPath string) error {
+	key, err := w.locate(storedPath)
+	if err != nil {
+		return err
+	}
+	req, err := w.newRequest(context.Background(), http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainClose(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusAccepted, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("WebDAV 删除失败: %s", resp.Status)
+	}
+}
+
+// ensureCollections 确保父目录存在：已确认存在的目录直接跳过，否则先以 PROPFIND 检查，
+// 不存在时再逐级 MKCOL。已存在的目录返回 405，上级目录无权限或仍缺失时返回 409，均继续处理下一级，
+// 最终以 PUT 的结果为准。
+func (w *WebDAVStorage) ensureCollections(ctx context.Context, dir string) error {
+	rel := path.Join(w.basePath, dir)
+	if rel == "." || rel == "" {
+		return nil
+	}
+	if _, ok := w.dirs.Load(rel); ok {
+		return nil
+	}
+	exists, err := w.collectionExists(ctx, rel)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		current := ""
+		for _, seg := range strings.Split(rel, "/") {
+			current = path.Join(current, seg)
+			req, err := w.newRawRequest(ctx, "MKCOL", w.resolveURL(current)+"/", nil)
+			if err != nil {
+				return err
+			}
+			resp, err := w.client.Do(req)
+			if err != nil {
+				return err
+			}
+			drainClose(resp.Body)
+			switch resp.StatusCode {
+			case http.StatusCreated, http.StatusOK, http.StatusNoContent, http.StatusMethodNotAllowed, http.StatusConflict:
+			default:
+				return fmt.Errorf("WebDAV 创建目录失败: %s %s", current, resp.Status)
+			}
+		}
+	}
+	w.dirs.Store(rel, struct{}{})
+	return nil
+}
+
+// collectionExists 通过 Depth: 0 的 PROPFIND 判断目录是否存在。
+func (w *WebDAVStorage) collectionExists(ctx context.Context, rel string) (bool, error) {
+	req, err := w.newRawRequest(ctx, "PROPFIND", w.resolveURL(rel)+"/", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Depth", "0")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	drainClose(resp.Body)
+	return resp.StatusCode == http.StatusMultiStatus || resp.StatusCode == http.StatusOK, nil
+}
+
+func (w *WebDAVStorage) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	return w.newRawRequest(ctx, method, w.resolveURL(path.Join(w.basePath, key)), body)
+}
+
+func (w *WebDAVStorage) newRawRequest(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if w.user != "" || w.password != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+	return req, nil
+}
+
+// resolveURL 将相对路径逐段转义后拼接到 WebDAV 根地址。
+func (w *WebDAVStorage) resolveURL(rel string) string {
+	base := w.endpoint.Scheme + "://" + w.endpoint.Host + w.endpoint.EscapedPath()
+	var escaped []string
+	for _, seg := range strings.Split(strings.Trim(rel, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		escaped = append(escaped, url.PathEscape(seg))
+	}
+	if len(escaped) == 0 {
+		return base
+	}
+	return base + "/" + strings.Join(escaped, "/")
+}
+
+func (w *WebDAVStorage) locate(storedPath string) (string, error) {
+	platform, _, key, err := ParseStoredPath(storedPath)
+	if err != nil {
+		return "", err
+	}
+	if platform != PlatformWebDAV {
+		return "", fmt.Errorf("存储路径与 WebDAV 不匹配")
+	}
+	return key, nil
+}
+
+func drainClose(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 64*1024))
+	_ = body.Close()
+}
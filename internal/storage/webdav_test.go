@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	cfgpkg "linkit/internal/config"
+)
+
+// davServer 基于 x/net/webdav 的内存 WebDAV 服务，并统计各方法的请求次数。
+type davServer struct {
+	*httptest.Server
+	fs     webdav.FileSystem
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func startDAVServer(t *testing.T) *davServer {
+	t.Helper()
+	s := &davServer{fs: webdav.NewMemFS(), counts: make(map[string]int)}
+	handler := &webdav.Handler{FileSystem: s.fs, LockSystem: webdav.NewMemLS()}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "linkit" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		s.counts[r.Method]++
+		s.mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *davServer) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[method]
+}
+
+func newTestWebDAV(t *testing.T, endpoint string) *WebDAVStorage {
+	t.Helper()
+	var cfg cfgpkg.Config
+	cfg.AppConfig.WebDAVURL = endpoint
+	cfg.AppConfig.WebDAVUser = "linkit"
+	cfg.AppConfig.WebDAVPassword = "secret"
+	cfg.AppConfig.WebDAVBasePath = "linkit"
+	stg, err := NewWebDAV(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stg
+}
+
+func TestWebDAVStorageRoundTrip(t *testing.T) {
+	srv := startDAVServer(t)
+	stg := newTestWebDAV(t, srv.URL)
+
+	data := bytes.Repeat([]byte("webdav-"), 5000)
+	storedPath, err := stg.Write("2024-01/中文 名.txt", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !strings.HasPrefix(storedPath, "webdav:127.0.0.1:") {
+		t.Fatalf("存储路径不符合预期: %s", storedPath)
+	}
+	if _, err := srv.fs.Stat(context.Background(), "/linkit/2024-01/中文 名.txt"); err != nil {
+		t.Fatalf("文件未写入 base path 下: %v", err)
+	}
+
+	info, err := stg.Stat(storedPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatalf("Stat 大小 = %d, 期望 %d", info.Size, len(data))
+	}
+
+	for _, tc := range []struct{ start, end int64 }{{0, -1}, {0, 9}, {7000, 20000}, {34990, -1}} {
+		rc, err := stg.Open(storedPath, tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("Open(%d, %d): %v", tc.start, tc.end, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := data[tc.start:]
+		if tc.end >= 0 {
+			want = data[tc.start : tc.end+1]
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("区间 [%d, %d] 内容不一致", tc.start, tc.end)
+		}
+	}
+
+	if err := stg.Delete(storedPath); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := stg.Stat(storedPath); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("删除后 Stat 应返回 ErrObjectNotFound, got %v", err)
+	}
+	if _, err := stg.Open(storedPath, 0, -1); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("删除后 Open 应返回 ErrObjectNotFound, got %v", err)
+	}
+	if err := stg.Delete(storedPath); err != nil {
+		t.Fatalf("重复删除应忽略不存在的对象: %v", err)
+	}
+}
+
+func TestWebDAVSkipsMkcolForExistingDirs(t *testing.T) {
+	srv := startDAVServer(t)
+	ctx := context.Background()
+	for _, dir := range []string{"/linkit", "/linkit/exists"} {
+		if err := srv.fs.Mkdir(ctx, dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stg := newTestWebDAV(t, srv.URL)
+
+	if _, err := stg.Write("exists/a.txt", strings.NewReader("a"), 1, "text/plain"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if n := srv.count("MKCOL"); n != 0 {
+		t.Fatalf("父目录已存在时不应发送 MKCOL, got %d", n)
+	}
+
+	if _, err := stg.Write("new/dir/b.txt", strings.NewReader("b"), 1, "text/plain"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	created := srv.count("MKCOL")
+	if created == 0 {
+		t.Fatal("父目录不存在时应逐级创建")
+	}
+	if _, err := stg.Write("new/dir/c.txt", strings.NewReader("c"), 1, "text/plain"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if n := srv.count("MKCOL"); n != created {
+		t.Fatalf("已确认存在的目录不应再次 MKCOL, got %d, 期望 %d", n, created)
+	}
+
+	// 目录被外部删除后，首次写入失败并清除缓存，之后的写入重新创建目录
+	if err := srv.fs.RemoveAll(ctx, "/linkit/new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stg.Write("new/dir/d.txt", strings.NewReader("d"), 1, "text/plain"); err == nil {
+		t.Fatal("父目录缺失时写入应失败")
+	}
+	if _, err := stg.Write("new/dir/d.txt", strings.NewReader("d"), 1, "text/plain"); err != nil {
+		t.Fatalf("清除目录缓存后应重新创建目录: %v", err)
+	}
+}
+
+// noLengthWriter 去掉 HEAD 响应的 Content-Length，模拟只返回分块响应头的 WebDAV 服务端。
+type noLengthWriter struct{ http.ResponseWriter }
+
+func (w noLengthWriter) WriteHeader(code int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestWebDAVStatFallsBackToPropfind(t *testing.T) {
+	fs := webdav.NewMemFS()
+	handler := &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()}
+	var propfinds int
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w = noLengthWriter{w}
+		case "PROPFIND":
+			mu.Lock()
+			propfinds++
+			mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	stg := newTestWebDAV(t, srv.URL)
+
+	data := strings.Repeat("x", 1234)
+	storedPath, err := stg.Write("size.txt", strings.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	mu.Lock()
+	before := propfinds
+	mu.Unlock()
+	info, err := stg.Stat(storedPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatalf("HEAD 未返回长度时应读取 getcontentlength, got %d", info.Size)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if propfinds != before+1 {
+		t.Fatalf("应发送一次 PROPFIND, got %d", propfinds-before)
+	}
+}
+
+func TestWebDAVStatContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	stg := newTestWebDAV(t, srv.URL)
+	storedPath, err := BuildStoredPath(PlatformWebDAV, stg.Bucket(), "slow.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := stg.StatContext(ctx, storedPath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("调用方取消后应中断请求, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("取消后请求未及时返回")
+	}
+	if _, err := stg.OpenContext(ctx, storedPath, 0, -1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("已取消的 ctx 不应发起下载, got %v", err)
+	}
+}
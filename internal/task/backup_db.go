@@ -21,11 +21,7 @@ func StartS3DBBackup(cfg config.Config, reg *storage.Registry) {
 	if reg == nil || reg.CurrentDriver() != storage.PlatformS3 {
 		return
 	}
-	s3Storage, ok := reg.Get(storage.PlatformS3)
-	if !ok {
-		reg.Logger.Warn("S3 存储未初始化，跳过数据库备份")
-		return
-	}
+	s3Storage := reg.Active()
 	dbPath, ok := resolveDBPath(cfg.DatabasePath)
 	if !ok {
 		reg.Logger.Warn("数据库路径无效，跳过数据库备份", "path", cfg.DatabasePath)
@@ -0,0 +1,237 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+// tus 上传的数据目录前缀，与 server 包中的命名保持一致
+const tusDirPrefix = "tus-"
+
+type UploadGCReport struct {
+	ExpiredSessions      int      `json:"expiredSessions"`
+	ExpiredDirectUploads int      `json:"expiredDirectUploads"`
+	OrphanChunkDirs      int      `json:"orphanChunkDirs"`
+	TusUploads           int      `json:"tusUploads"`
+	MergeFiles           int      `json:"mergeFiles"`
+	FreedBytes           int64    `json:"freedBytes"`
+	Errors               []string `json:"errors,omitempty"`
+}
+
+// StartUploadJanitor 启动时及之后每隔 CleanInterval 清理一次上传临时文件，ctx 取消后退出。
+func StartUploadJanitor(ctx context.Context, cfg *config.Config, store *db.DB, reg *storage.Registry) {
+	logger := store.Logger
+	go func() {
+		logger.Info("启动上传临时文件清理任务", "interval", cfg.CleanInterval)
+		ticker := time.NewTicker(cfg.CleanInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := CleanUploads(ctx, cfg, store, reg, logger); err != nil && ctx.Err() == nil {
+				logger.Error("清理上传临时文件失败", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CleanUploads 删除过期的上传会话及其分片、过期未确认的直传对象、没有对应会话的分片目录、
+// 超过有效期的 tus 上传，以及合并失败残留在 MergeDir 中的文件。正在合并的会话不会被清理。
+func CleanUploads(ctx context.Context, cfg *config.Config, store *db.DB, reg *storage.Registry, logger *slog.Logger) (UploadGCReport, error) {
+	var report UploadGCReport
+	now := time.Now()
+
+	remove := func(path string) bool {
+		size, _ := pathUsage(path)
+		if err := os.RemoveAll(path); err != nil {
+			logger.Warn("删除上传临时文件失败", "path", path, "err", err)
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", path, err))
+			return false
+		}
+		report.FreedBytes += size
+		return true
+	}
+
+	expired, err := store.Upload.ListExpired(ctx, now)
+	if err != nil {
+		return report, err
+	}
+	for _, session := range expired {
+		if !remove(filepath.Join(cfg.ChunkDir, session.ID)) {
+			continue
+		}
+		if err := store.Upload.Delete(ctx, session.ID); err != nil {
+			return report, err
+		}
+		report.ExpiredSessions++
+	}
+
+	if err := cleanDirectUploads(ctx, store, reg, now, logger, &report); err != nil {
+		return report, err
+	}
+
+	entries, err := os.ReadDir(cfg.ChunkDir)
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		path := filepath.Join(cfg.ChunkDir, entry.Name())
+		_, latest := pathUsage(path)
+		if strings.HasPrefix(entry.Name(), tusDirPrefix) {
+			// tus 上传写满前没有会话记录，按最后写入时间判断是否已被放弃；后台合并中的保留
+			if now.Sub(latest) <= cfg.UploadSessionTTL {
+				continue
+			}
+			session, err := store.Upload.Get(ctx, entry.Name())
+			if err != nil {
+				return report, err
+			}
+			if session != nil && session.Status == db.UploadStatusFinalizing {
+				continue
+			}
+			if remove(path) {
+				report.TusUploads++
+			}
+			continue
+		}
+		if now.Sub(latest) <= cfg.CleanExpire {
+			continue
+		}
+		session, err := store.Upload.Get(ctx, entry.Name())
+		if err != nil {
+			return report, err
+		}
+		if session == nil && remove(path) {
+			report.OrphanChunkDirs++
+		}
+	}
+
+	finalizing, err := store.Upload.ListByStatus(ctx, db.UploadStatusFinalizing)
+	if err != nil {
+		return report, err
+	}
+	entries, err = os.ReadDir(cfg.MergeDir)
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(cfg.MergeDir, entry.Name())
+		if _, latest := pathUsage(path); now.Sub(latest) <= cfg.CleanExpire {
+			continue
+		}
+		// 合并文件以 <uploadId>- 开头，后台任务仍在读取时保留
+		inUse := false
+		for _, session := range finalizing {
+			if strings.HasPrefix(entry.Name(), session.ID+"-") {
+				inUse = true
+				break
+			}
+		}
+		if !inUse && remove(path) {
+			report.MergeFiles++
+		}
+	}
+
+	if report.ExpiredSessions+report.ExpiredDirectUploads+report.OrphanChunkDirs+report.TusUploads+report.MergeFiles > 0 {
+		logger.Info("上传临时文件清理完成",
+			"expired_sessions", report.ExpiredSessions,
+			"expired_direct_uploads", report.ExpiredDirectUploads,
+			"orphan_chunk_dirs", report.OrphanChunkDirs,
+			"tus_uploads", report.TusUploads,
+			"merge_files", report.MergeFiles,
+			"freed_bytes", report.FreedBytes)
+	}
+	return report, nil
+}
+
+// cleanDirectUploads 删除过期未确认的直传对象并中止未完成的 multipart 上传，之后删除任务记录。
+// 已入库的对象（确认流程在删除任务前中断）仍被资源引用，只删除任务记录。
+func cleanDirectUploads(ctx context.Context, store *db.DB, reg *storage.Registry, now time.Time, logger *slog.Logger, report *UploadGCReport) error {
+	expired, err := store.Direct.ListExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, item := range expired {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := removeDirectUpload(ctx, store, reg, item, logger); err != nil {
+			logger.Warn("清理过期直传对象失败", "upload", item.ID, "key", item.ObjectKey, "err", err)
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", item.ObjectKey, err))
+			continue
+		}
+		if err := store.Direct.Delete(ctx, item.ID); err != nil {
+			return err
+		}
+		report.ExpiredDirectUploads++
+	}
+	return nil
+}
+
+func removeDirectUpload(ctx context.Context, store *db.DB, reg *storage.Registry, item model.DirectUpload, logger *slog.Logger) error {
+	stg, ok := reg.Get(item.StorageName)
+	if !ok {
+		return fmt.Errorf("存储 %s 不存在", item.StorageName)
+	}
+	uploader, ok := stg.(storage.DirectUploader)
+	if !ok {
+		return fmt.Errorf("存储 %s 不支持直传", item.StorageName)
+	}
+	if item.MultipartID != "" {
+		// 分片已合并时 multipart 上传不再存在，中止失败后仍继续删除合并后的对象
+		if err := uploader.AbortMultipart(item.ObjectKey, item.MultipartID); err != nil {
+			logger.Debug("中止 multipart 上传失败", "key", item.ObjectKey, "err", err)
+		}
+	}
+	storedPath, err := uploader.StoredPath(item.ObjectKey)
+	if err != nil {
+		return err
+	}
+	refs, err := store.Resource.CountByPath(ctx, storedPath)
+	if err != nil {
+		return err
+	}
+	if refs > 0 {
+		return nil
+	}
+	if err := stg.Delete(storedPath); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+		return err
+	}
+	return nil
+}
+
+// pathUsage 返回文件或目录的总大小与其中最新的修改时间。
+func pathUsage(path string) (int64, time.Time) {
+	var size int64
+	var latest time.Time
+	_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return size, latest
+}
@@ -0,0 +1,103 @@
+package task
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+// directMemStorage 在 memStorage 基础上实现直传接口，记录被中止的 multipart 上传。
+type directMemStorage struct {
+	*memStorage
+	aborted []string
+}
+
+func (d *directMemStorage) StoredPath(objectKey string) (string, error) {
+	return storage.BuildStoredPath(storage.PlatformS3, "bucket", objectKey)
+}
+
+func (d *directMemStorage) PresignPut(objectKey, contentType string, size int64, expires time.Duration) (string, error) {
+	return "", nil
+}
+
+func (d *directMemStorage) CreateMultipart(objectKey, contentType string) (string, error) {
+	return "", nil
+}
+
+func (d *directMemStorage) PresignUploadPart(objectKey, uploadID string, partNumber int32, expires time.Duration) (string, error) {
+	return "", nil
+}
+
+func (d *directMemStorage) CompleteMultipart(objectKey, uploadID string, parts []storage.UploadedPart) error {
+	return nil
+}
+
+func (d *directMemStorage) AbortMultipart(objectKey, uploadID string) error {
+	d.aborted = append(d.aborted, uploadID)
+	return nil
+}
+
+func TestCleanUploadsRemovesExpiredDirectUploads(t *testing.T) {
+	store, reg, _, _ := newMigrateFixture(t)
+	ctx := context.Background()
+	remote := &directMemStorage{memStorage: newMemStorage()}
+	reg.Storages["s3"] = remote
+	dir := t.TempDir()
+	cfg := &config.Config{ChunkDir: filepath.Join(dir, "chunk"), MergeDir: filepath.Join(dir, "merged")}
+
+	expired := time.Now().Add(-time.Minute)
+	items := []model.DirectUpload{
+		{ID: "put", ObjectKey: "put.bin", ExpiresAt: expired},
+		{ID: "multipart", ObjectKey: "multipart.bin", MultipartID: "mp-1", ExpiresAt: expired},
+		// 确认流程已入库但未删除任务记录
+		{ID: "persisted", ObjectKey: "persisted.bin", Status: db.DirectUploadStatusFinalizing, ExpiresAt: expired},
+		{ID: "pending", ObjectKey: "pending.bin", ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	for i := range items {
+		items[i].UserID = 1
+		items[i].StorageName = "s3"
+		items[i].Filename = items[i].ObjectKey
+		if items[i].Status == "" {
+			items[i].Status = db.DirectUploadStatusPending
+		}
+		remote.objects[items[i].ObjectKey] = []byte(items[i].ID)
+		if err := store.Direct.Create(ctx, &items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	persistedPath, _ := remote.StoredPath("persisted.bin")
+	if _, err := store.Resource.Insert(ctx, model.Resource{Filename: "persisted.bin", Hash: md5Hex([]byte("persisted")), Path: persistedPath, FileSize: 9, UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CleanUploads(ctx, cfg, store, reg, reg.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ExpiredDirectUploads != 3 || len(report.Errors) != 0 {
+		t.Fatalf("清理结果不符合预期: %+v", report)
+	}
+	for key, want := range map[string]bool{"put.bin": false, "multipart.bin": false, "persisted.bin": true, "pending.bin": true} {
+		if _, ok := remote.objects[key]; ok != want {
+			t.Errorf("%s: 对象存在 = %v, 期望 %v", key, ok, want)
+		}
+	}
+	if len(remote.aborted) != 1 || remote.aborted[0] != "mp-1" {
+		t.Fatalf("过期的 multipart 上传应被中止: %v", remote.aborted)
+	}
+	for id, want := range map[string]bool{"put": false, "multipart": false, "persisted": false, "pending": true} {
+		item, err := store.Direct.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (item != nil) != want {
+			t.Errorf("%s: 任务记录存在 = %v, 期望 %v", id, item != nil, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package task
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+// ErrMigrationRunning 表示已有迁移任务在执行。
+var ErrMigrationRunning = errors.New("已有存储迁移任务在执行")
+
+// MigrateOptions 中 From/To 为存储名：内置驱动使用平台名（如 local、s3），命名配置使用配置名。
+type MigrateOptions struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	DryRun       bool   `json:"dryRun"`
+	DeleteSource bool   `json:"deleteSource"`
+	Limit        int    `json:"limit"`
+}
+
+// MigrateReport 中 DryRun 为预览时待迁移的对象数，不计入 Migrated；预览时 Bytes 为待迁移字节数。
+type MigrateReport struct {
+	Total    int      `json:"total"`
+	Migrated int      `json:"migrated"`
+	DryRun   int      `json:"dryRun,omitempty"`
+	Failed   int      `json:"failed"`
+	Bytes    int64    `json:"bytes"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// MigrateStorage 将 From 存储上的对象复制到 To 存储，校验 hash 后改写 resource.path。
+// 每个对象迁移成功后立即落库，中断后重新执行会自动跳过已迁移的对象。
+func MigrateStorage(ctx context.Context, store *db.DB, reg *storage.Registry, opts MigrateOptions, logger *slog.Logger, progress func(MigrateReport)) (MigrateReport, error) {
+	var report MigrateReport
+	src, dst, err := resolveMigrateTargets(reg, &opts)
+	if err != nil {
+		return report, err
+	}
+
+	objects, err := store.Resource.ListStorageObjects(ctx)
+	if err != nil {
+		return report, err
+	}
+	pending := make([]model.StorageObject, 0, len(objects))
+	for _, obj := range objects {
+		name, _, err := reg.Resolve(obj.Path)
+		if err != nil || name != opts.From {
+			continue
+		}
+		pending = append(pending, obj)
+		if opts.Limit > 0 && len(pending) >= opts.Limit {
+			break
+		}
+	}
+	report.Total = len(pending)
+	logger.Info("开始存储迁移", "from", opts.From, "to", opts.To, "total", report.Total, "dryRun", opts.DryRun)
+
+	for _, obj := range pending {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if opts.DryRun {
+			logger.Info("待迁移对象", "path", obj.Path, "size", obj.FileSize, "refs", obj.Refs)
+			report.DryRun++
+			report.Bytes += obj.FileSize
+			continue
+		}
+		newPath, err := migrateObject(ctx, store, src, dst, opts.To, obj, opts.DeleteSource, logger)
+		if err != nil {
+			logger.Error("迁移对象失败", "path", obj.Path, "err", err)
+			report.Failed++
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Path, err))
+		} else {
+			report.Migrated++
+			report.Bytes += obj.FileSize
+			logger.Info("迁移对象完成", "from", obj.Path, "to", newPath, "refs", obj.Refs)
+		}
+		if progress != nil {
+			progress(report)
+		}
+	}
+	logger.Info("存储迁移结束", "migrated", report.Migrated, "dryRun", report.DryRun, "failed", report.Failed, "bytes", report.Bytes)
+	return report, nil
+}
+
+// resolveMigrateTargets 规范化存储名并查找源、目标驱动。
+func resolveMigrateTargets(reg *storage.Registry, opts *MigrateOptions) (storage.Storage, storage.Storage, error) {
+	opts.From = storage.CanonicalProfile(opts.From)
+	opts.To = storage.CanonicalProfile(opts.To)
+	if opts.From == "" || opts.To == "" {
+		return nil, nil, fmt.Errorf("缺少源存储或目标存储")
+	}
+	if opts.From == opts.To {
+		return nil, nil, fmt.Errorf("源存储与目标存储相同: %s", opts.From)
+	}
+	src, ok := reg.Get(opts.From)
+	if !ok {
+		return nil, nil, fmt.Errorf("未找到源存储: %s", opts.From)
+	}
+	dst, ok := reg.Get(opts.To)
+	if !ok {
+		return nil, nil, fmt.Errorf("未找到目标存储: %s", opts.To)
+	}
+	return src, dst, nil
+}
+
+// errSourceReleased 表示迁移过程中源对象的引用已全部删除，无需再迁移。
+var errSourceReleased = errors.New("源对象已无资源引用")
+
+// migrateObject 复制单个对象并回读校验 hash，校验通过后改写所有引用该对象的资源路径，
+// deleteSource 为 true 时随后删除源对象。全程持有该内容的 hash 锁，
+// 避免上传在改写路径前复用源对象、却在源对象删除后才入库。
+func migrateObject(ctx context.Context, store *db.DB, src, dst storage.Storage, dstName string, obj model.StorageObject, deleteSource bool, logger *slog.Logger) (string, error) {
+	_, _, key, err := storage.ParseStoredPath(obj.Path)
+	if err != nil {
+		return "", err
+	}
+	unlock := store.Resource.LockHash(obj.Hash)
+	defer unlock()
+
+	newPath, written, err := copyObject(src, dst, dstName, key, obj)
+	if err != nil {
+		return "", err
+	}
+	dbCtx, cancel := store.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	updated, err := store.Resource.UpdatePath(dbCtx, obj.Path, newPath)
+	if err != nil {
+		return "", err
+	}
+	if updated == 0 {
+		if written {
+			_ = dst.Delete(newPath)
+		}
+		return "", errSourceReleased
+	}
+	if deleteSource {
+		if err := src.Delete(obj.Path); err != nil {
+			logger.Warn("删除源对象失败", "path", obj.Path, "err", err)
+		}
+	}
+	return newPath, nil
+}
+
+// copyObject 将对象写入目标存储的同名 key。目标 key 已被其他对象占用时不覆盖：
+// 内容相同（如上次迁移中断留下的副本）直接使用，否则改用追加 hash 后缀的 key，仍冲突则失败。
+// 写入或校验失败时删除目标中的残缺对象。第二个返回值表示是否写入了新对象。
+func copyObject(src, dst storage.Storage, dstName, key string, obj model.StorageObject) (string, bool, error) {
+	candidates := []string{key}
+	if suffixed := storage.SuffixObjectKey(key, obj.Hash); suffixed != key {
+		candidates = append(candidates, suffixed)
+	}
+	for _, candidate := range candidates {
+		targetPath, err := storage.StoredPathFor(dstName, dst, candidate)
+		if err != nil {
+			return "", false, err
+		}
+		if _, err := dst.Stat(targetPath); err == nil {
+			if obj.Hash != "" {
+				if sum, err := hashObject(dst, targetPath); err == nil && sum == obj.Hash {
+					return targetPath, false, nil
+				}
+			}
+			continue
+		} else if !errors.Is(err, storage.ErrObjectNotFound) {
+			return "", false, err
+		}
+
+		r, err := src.Open(obj.Path, 0, -1)
+		if err != nil {
+			return "", false, err
+		}
+		contentType := obj.Type
+		if contentType == "" {
+			contentType = storage.GuessMime(key)
+		}
+		newPath, err := dst.Write(candidate, r, obj.FileSize, contentType)
+		r.Close()
+		if err != nil {
+			// 写入不是原子的，中断时目标中可能留下部分内容
+			_ = dst.Delete(targetPath)
+			return "", false, err
+		}
+		if obj.Hash != "" {
+			sum, err := hashObject(dst, newPath)
+			if err != nil {
+				_ = dst.Delete(newPath)
+				return "", false, err
+			}
+			if sum != obj.Hash {
+				_ = dst.Delete(newPath)
+				return "", false, fmt.Errorf("hash 校验失败: 期望 %s，实际 %s", obj.Hash, sum)
+			}
+		}
+		return newPath, true, nil
+	}
+	return "", false, fmt.Errorf("目标存储中已存在内容不同的同名对象: %s", key)
+}
+
+func hashObject(stg storage.Storage, storedPath string) (string, error) {
+	r, err := stg.Open(storedPath, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type MigrateStatus struct {
+	Running    bool           `json:"running"`
+	Options    MigrateOptions `json:"options"`
+	Report     MigrateReport  `json:"report"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+}
+
+// StorageMigrator 在后台执行存储迁移，同一时间只允许一个任务。
+type StorageMigrator struct {
+	store  *db.DB
+	reg    *storage.Registry
+	mu     sync.Mutex
+	status MigrateStatus
+}
+
+func NewStorageMigrator(store *db.DB, reg *storage.Registry) *StorageMigrator {
+	return &StorageMigrator{store: store, reg: reg}
+}
+
+func (m *StorageMigrator) Start(opts MigrateOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status.Running {
+		return ErrMigrationRunning
+	}
+	if _, _, err := resolveMigrateTargets(m.reg, &opts); err != nil {
+		return err
+	}
+	now := time.Now()
+	m.status = MigrateStatus{Running: true, Options: opts, StartedAt: &now}
+	go func() {
+		report, err := MigrateStorage(context.Background(), m.store, m.reg, opts, m.reg.Logger, func(r MigrateReport) {
+			m.mu.Lock()
+			m.status.Report = r
+			m.mu.Unlock()
+		})
+		finished := time.Now()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.status.Running = false
+		m.status.Report = report
+		m.status.FinishedAt = &finished
+		if err != nil {
+			m.status.Error = err.Error()
+		}
+	}()
+	return nil
+}
+
+func (m *StorageMigrator) Status() MigrateStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
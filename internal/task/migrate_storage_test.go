@@ -0,0 +1,261 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+// memStorage 以内存保存对象，模拟桶为 bucket 的 S3 存储。
+type memStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{objects: make(map[string][]byte)}
+}
+
+func (m *memStorage) Platform() storage.BucketPlatform { return storage.PlatformS3 }
+func (m *memStorage) Bucket() string                   { return "bucket" }
+
+func (m *memStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	m.objects[objectKey] = data
+	m.mu.Unlock()
+	return storage.BuildStoredPath(storage.PlatformS3, "bucket", objectKey)
+}
+
+func (m *memStorage) GetURL(storedPath string, expires time.Duration) (string, error) {
+	return "", storage.ErrURLUnsupported
+}
+
+func (m *memStorage) Open(storedPath string, rangeStart, rangeEnd int64) (io.ReadCloser, error) {
+	data, err := m.get(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memStorage) Stat(storedPath string) (storage.ObjectInfo, error) {
+	data, err := m.get(storedPath)
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	return storage.ObjectInfo{Size: int64(len(data))}, nil
+}
+
+func (m *memStorage) Delete(storedPath string) error {
+	_, _, key, err := storage.ParseStoredPath(storedPath)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.objects, key)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memStorage) get(storedPath string) ([]byte, error) {
+	_, _, key, err := storage.ParseStoredPath(storedPath)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return data, nil
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func newMigrateFixture(t *testing.T) (*db.DB, *storage.Registry, *storage.LocalStorage, *memStorage) {
+	t.Helper()
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := db.NewStore(config.Config{DatabasePath: filepath.Join(dir, "app.db")}, logger, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := storage.NewLocal(filepath.Join(dir, "storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := newMemStorage()
+	reg := &storage.Registry{
+		DefaultDriver: "local",
+		Storages:      map[string]storage.Storage{"local": local, "s3": remote},
+		Logger:        logger,
+	}
+	return store, reg, local, remote
+}
+
+func TestMigrateStorageKeepsExistingDestinationObject(t *testing.T) {
+	store, reg, local, remote := newMigrateFixture(t)
+	ctx := context.Background()
+
+	data := []byte("migrated content")
+	srcPath, err := local.Write("2024-01/report.txt", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := store.Resource.Insert(ctx, model.Resource{Filename: "report.txt", Hash: md5Hex(data), Type: "text/plain", Path: srcPath, FileSize: int64(len(data)), UserID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 目标存储中同名 key 已被其他内容占用
+	unrelated := []byte("unrelated object")
+	remote.objects["2024-01/report.txt"] = unrelated
+
+	report, err := MigrateStorage(ctx, store, reg, MigrateOptions{From: "local", To: "s3", DeleteSource: true}, reg.Logger, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Migrated != 1 || report.Failed != 0 {
+		t.Fatalf("迁移结果不符合预期: %+v", report)
+	}
+	if !bytes.Equal(remote.objects["2024-01/report.txt"], unrelated) {
+		t.Fatal("目标存储中已有的对象被覆盖")
+	}
+	newKey := storage.SuffixObjectKey("2024-01/report.txt", md5Hex(data))
+	if !bytes.Equal(remote.objects[newKey], data) {
+		t.Fatalf("迁移后的对象应写入 %s", newKey)
+	}
+	objects, err := store.Resource.ListStorageObjects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || !strings.HasSuffix(objects[0].Path, "/"+newKey) || objects[0].Refs != 2 {
+		t.Fatalf("资源路径未改写: %+v", objects)
+	}
+	if _, err := local.Stat(srcPath); err == nil {
+		t.Fatal("源对象应已删除")
+	}
+}
+
+func TestMigrateStorageReusesIdenticalDestinationObject(t *testing.T) {
+	store, reg, local, remote := newMigrateFixture(t)
+	ctx := context.Background()
+
+	data := []byte("resumed migration")
+	srcPath, err := local.Write("a.txt", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Resource.Insert(ctx, model.Resource{Filename: "a.txt", Hash: md5Hex(data), Path: srcPath, FileSize: int64(len(data)), UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// 上次迁移写入目标后中断，尚未改写资源路径
+	remote.objects["a.txt"] = data
+
+	report, err := MigrateStorage(ctx, store, reg, MigrateOptions{From: "local", To: "s3"}, reg.Logger, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Migrated != 1 {
+		t.Fatalf("迁移结果不符合预期: %+v", report)
+	}
+	if len(remote.objects) != 1 {
+		t.Fatalf("内容相同时不应再写入新对象: %d", len(remote.objects))
+	}
+	if _, err := local.Stat(srcPath); err != nil {
+		t.Fatal("未设置 DeleteSource 时应保留源对象")
+	}
+}
+
+// partialWriteStorage 写入一半内容后返回错误，模拟非原子写入中断后留下的残缺对象。
+type partialWriteStorage struct {
+	*memStorage
+}
+
+func (p partialWriteStorage) Write(objectKey string, r io.Reader, size int64, contentType string) (string, error) {
+	data, _ := io.ReadAll(r)
+	p.mu.Lock()
+	p.objects[objectKey] = data[:len(data)/2]
+	p.mu.Unlock()
+	return "", io.ErrUnexpectedEOF
+}
+
+func TestMigrateStorageRemovesPartialObjectOnFailure(t *testing.T) {
+	store, reg, local, remote := newMigrateFixture(t)
+	reg.Storages["s3"] = partialWriteStorage{remote}
+	ctx := context.Background()
+
+	data := []byte("interrupted copy")
+	srcPath, err := local.Write("b.txt", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Resource.Insert(ctx, model.Resource{Filename: "b.txt", Hash: md5Hex(data), Path: srcPath, FileSize: int64(len(data)), UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := MigrateStorage(ctx, store, reg, MigrateOptions{From: "local", To: "s3"}, reg.Logger, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != 1 || report.Migrated != 0 {
+		t.Fatalf("迁移结果不符合预期: %+v", report)
+	}
+	if len(remote.objects) != 0 {
+		t.Fatalf("写入失败后应删除目标中的残缺对象: %v", remote.objects)
+	}
+	// 残缺对象已删除，重新迁移时仍写入原 key
+	reg.Storages["s3"] = remote
+	if report, err := MigrateStorage(ctx, store, reg, MigrateOptions{From: "local", To: "s3"}, reg.Logger, nil); err != nil || report.Migrated != 1 {
+		t.Fatalf("重新迁移失败: %+v %v", report, err)
+	}
+	if !bytes.Equal(remote.objects["b.txt"], data) {
+		t.Fatal("重新迁移应写入原 key")
+	}
+}
+
+func TestMigrateStorageDryRunCountsSeparately(t *testing.T) {
+	store, reg, local, remote := newMigrateFixture(t)
+	ctx := context.Background()
+
+	data := []byte("preview only")
+	srcPath, err := local.Write("c.txt", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Resource.Insert(ctx, model.Resource{Filename: "c.txt", Hash: md5Hex(data), Path: srcPath, FileSize: int64(len(data)), UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := MigrateStorage(ctx, store, reg, MigrateOptions{From: "local", To: "s3", DryRun: true}, reg.Logger, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DryRun != 1 || report.Migrated != 0 || report.Bytes != int64(len(data)) {
+		t.Fatalf("预览结果不应计入已迁移: %+v", report)
+	}
+	if len(remote.objects) != 0 {
+		t.Fatal("预览时不应写入目标存储")
+	}
+}
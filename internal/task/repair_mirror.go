@@ -0,0 +1,153 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/db/model"
+	"linkit/internal/storage"
+)
+
+type RepairReport struct {
+	Checked  int      `json:"checked"`
+	Repaired int      `json:"repaired"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// mirrorRepairRecheck STORAGE_MIRROR_REPAIR_HOURS 为 0 时重新读取配置的间隔
+const mirrorRepairRecheck = time.Hour
+
+// StartMirrorRepair 配置了存储镜像时，按 STORAGE_MIRROR_REPAIR_HOURS 周期性修复主副存储不一致的对象，
+// 每轮等待前读取最新配置，管理后台修改后无需重启；ctx 取消后退出。
+func StartMirrorRepair(ctx context.Context, cfg *config.Config, store *db.DB, reg *storage.Registry) {
+	if reg == nil {
+		return
+	}
+	logger := reg.Logger
+	go func() {
+		logger.Info("启动存储镜像修复任务")
+		for {
+			hours := cfg.GetAppConfig().StorageMirrorRepairHours
+			interval := mirrorRepairRecheck
+			if hours > 0 {
+				interval = time.Duration(hours) * time.Hour
+			}
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if cfg.GetAppConfig().StorageMirrorRepairHours <= 0 || len(reg.Mirrors()) == 0 {
+				continue
+			}
+			if _, err := RepairMirrors(ctx, store, reg, logger); err != nil {
+				logger.Error("存储镜像修复失败", "err", err)
+			}
+		}
+	}()
+}
+
+// RepairMirrors 检查镜像存储中的每个对象，主副存储缺失或大小不一致时从完好的一侧复制补齐。
+func RepairMirrors(ctx context.Context, store *db.DB, reg *storage.Registry, logger *slog.Logger) (RepairReport, error) {
+	var report RepairReport
+	if len(reg.Mirrors()) == 0 {
+		return report, nil
+	}
+	objects, err := store.Resource.ListStorageObjects(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		_, stg, err := reg.Resolve(obj.Path)
+		if err != nil {
+			continue
+		}
+		mirror, ok := stg.(*storage.MirrorStorage)
+		if !ok {
+			continue
+		}
+		report.Checked++
+		repaired, err := repairObject(mirror, obj)
+		if err != nil {
+			logger.Error("修复镜像对象失败", "path", obj.Path, "err", err)
+			report.Failed++
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Path, err))
+			continue
+		}
+		if repaired {
+			report.Repaired++
+			logger.Info("已修复镜像对象", "path", obj.Path)
+		}
+	}
+	logger.Info("存储镜像检查结束", "checked", report.Checked, "repaired", report.Repaired, "failed", report.Failed)
+	return report, nil
+}
+
+func repairObject(mirror *storage.MirrorStorage, obj model.StorageObject) (bool, error) {
+	primary, secondary := mirror.Replicas()
+	secondaryPath, err := mirror.SecondaryPath(obj.Path)
+	if err != nil {
+		return false, err
+	}
+	_, _, key, err := storage.ParseStoredPath(obj.Path)
+	if err != nil {
+		return false, err
+	}
+	primaryOK := replicaHealthy(primary, obj.Path, obj.FileSize)
+	secondaryOK := replicaHealthy(secondary, secondaryPath, obj.FileSize)
+	switch {
+	case primaryOK && secondaryOK:
+		return false, nil
+	case primaryOK:
+		return true, copyReplica(primary, obj.Path, secondary, key, obj)
+	case secondaryOK:
+		return true, copyReplica(secondary, secondaryPath, primary, key, obj)
+	default:
+		return false, fmt.Errorf("主副存储中的对象均缺失或损坏")
+	}
+}
+
+func replicaHealthy(stg storage.Storage, storedPath string, size int64) bool {
+	info, err := stg.Stat(storedPath)
+	if err != nil {
+		return false
+	}
+	return size <= 0 || info.Size == size
+}
+
+// copyReplica 复制对象到另一侧并回读校验 hash。
+func copyReplica(src storage.Storage, srcPath string, dst storage.Storage, key string, obj model.StorageObject) error {
+	r, err := src.Open(srcPath, 0, -1)
+	if err != nil {
+		return err
+	}
+	contentType := obj.Type
+	if contentType == "" {
+		contentType = storage.GuessMime(key)
+	}
+	newPath, err := dst.Write(key, r, obj.FileSize, contentType)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if obj.Hash != "" {
+		sum, err := hashObject(dst, newPath)
+		if err != nil {
+			return err
+		}
+		if sum != obj.Hash {
+			return fmt.Errorf("hash 校验失败: 期望 %s，实际 %s", obj.Hash, sum)
+		}
+	}
+	return nil
+}
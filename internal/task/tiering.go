@@ -0,0 +1,79 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"linkit/internal/config"
+	"linkit/internal/db"
+	"linkit/internal/storage"
+)
+
+// StartTiering 启动时及之后每日凌晨执行冷数据分层，每次执行时读取最新配置，管理后台修改后无需重启。
+func StartTiering(ctx context.Context, cfg *config.Config, store *db.DB, reg *storage.Registry) {
+	if reg == nil {
+		return
+	}
+	logger := reg.Logger
+	go func() {
+		for {
+			if appCfg := cfg.GetAppConfig(); appCfg.TieringEnable {
+				if _, err := TierColdObjects(ctx, store, reg, appCfg, logger); err != nil {
+					logger.Error("冷数据分层失败", "err", err)
+				}
+			}
+			timer := time.NewTimer(time.Until(nextMidnight(time.Now())))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// TierColdObjects 将源存储上超过 TieringColdDays 天未被下载的对象迁移到目标存储，
+// 校验 hash 并改写 resource.path 后删除源文件。
+func TierColdObjects(ctx context.Context, store *db.DB, reg *storage.Registry, appCfg config.AppConfig, logger *slog.Logger) (MigrateReport, error) {
+	var report MigrateReport
+	if appCfg.TieringColdDays <= 0 {
+		return report, fmt.Errorf("TIERING_COLD_DAYS 必须大于 0")
+	}
+	opts := MigrateOptions{From: appCfg.TieringSource, To: appCfg.TieringTarget}
+	src, dst, err := resolveMigrateTargets(reg, &opts)
+	if err != nil {
+		return report, err
+	}
+
+	before := time.Now().AddDate(0, 0, -appCfg.TieringColdDays)
+	objects, err := store.Resource.ListColdStorageObjects(ctx, before)
+	if err != nil {
+		return report, err
+	}
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		name, _, err := reg.Resolve(obj.Path)
+		if err != nil || name != opts.From {
+			continue
+		}
+		report.Total++
+		newPath, err := migrateObject(ctx, store, src, dst, opts.To, obj, true, logger)
+		if err != nil {
+			logger.Error("迁移冷数据失败", "path", obj.Path, "err", err)
+			report.Failed++
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Path, err))
+			continue
+		}
+		report.Migrated++
+		report.Bytes += obj.FileSize
+		logger.Info("冷数据已迁移", "from", obj.Path, "to", newPath, "refs", obj.Refs)
+	}
+	logger.Info("冷数据分层结束", "from", opts.From, "to", opts.To, "coldDays", appCfg.TieringColdDays,
+		"migrated", report.Migrated, "failed", report.Failed, "bytes", report.Bytes)
+	return report, nil
+}
@@ -0,0 +1,52 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"linkit/internal/config"
+	"linkit/internal/db/model"
+)
+
+func TestStartTieringRunsImmediately(t *testing.T) {
+	store, reg, local, remote := newMigrateFixture(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := []byte("cold content")
+	srcPath, err := local.Write("cold.txt", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Resource.Insert(ctx, model.Resource{Filename: "cold.txt", Hash: md5Hex(data), Path: srcPath, FileSize: int64(len(data)), UserID: 1, CreatedAt: time.Now().AddDate(0, 0, -10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.AppConfig.TieringEnable = true
+	cfg.AppConfig.TieringColdDays = 7
+	cfg.AppConfig.TieringSource = "local"
+	cfg.AppConfig.TieringTarget = "s3"
+	StartTiering(ctx, cfg, store, reg)
+	// 与管理后台热更新并发读取配置
+	cfg.SetAppConfigValue("TIERING_COLD_DAYS", "7")
+
+	// 删除源文件是迁移的最后一步
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := local.Stat(srcPath); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("启动后应立即执行一次冷数据分层")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+	if !bytes.Equal(remote.objects["cold.txt"], data) {
+		t.Fatal("迁移后的对象内容不一致")
+	}
+}
@@ -6,7 +6,12 @@ import { useCallback, useEffect, useRef, useState } from "react";
 import clsx from "clsx";
 import { addToast, Button, Image } from "@heroui/react";
 
-import { UploadChunkResponse, UploadCompletedResponse } from "@/types/api";
+import {
+  UploadChunkResponse,
+  UploadCompletedResponse,
+  UploadSessionResponse,
+  UploadStatusResponse,
+} from "@/types/api";
 import { Icon } from "@iconify/react";
 
 type UploadType = "image" | "video" | "audio" | "other";
@@ -28,6 +33,8 @@ type UploadItem = {
 
 const CHUNK_THRESHOLD = 100 * 1024 * 1024; // 100MB
 const CHUNK_SIZE = 8 * 1024 * 1024; // 8MB
+const CHUNK_RETRY_LIMIT = 3;
+const FINALIZE_POLL_INTERVAL = 1000;
 
 const UploadGridItem: UploadItem = {
   id: "upload",
@@ -190,6 +197,16 @@ function createUploadId(file: File) {
   return `${file.name}-${file.size}-${file.lastModified}-${random}`;
 }
 
+// 计算分片的 SHA-256，非安全上下文（HTTP 访问）下 crypto.subtle 不可用时跳过校验
+async function sha256Hex(blob: Blob) {
+  if (!globalThis.crypto?.subtle) return "";
+  const digest = await crypto.subtle.digest("SHA-256", await blob.arrayBuffer());
+
+  return Array.from(new Uint8Array(digest))
+    .map((b) => b.toString(16).padStart(2, "0"))
+    .join("");
+}
+
 type UploadPanelProps = {};
 
 export default function UploadPanel({ }: UploadPanelProps = {}) {
@@ -435,12 +452,84 @@ export default function UploadPanel({ }: UploadPanelProps = {}) {
     [updateItem],
   );
 
+  // 创建分片上传会话，uploadId 由服务端生成
+  const createUploadSession = useCallback(
+    async (item: UploadItem, signal: AbortSignal) => {
+      const res = await fetch("/api/upload/session", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({
+          filename: item.file.name,
+          fileSize: item.file.size,
+          chunkSize: CHUNK_SIZE,
+        }),
+        signal,
+      });
+      const json = await res.json().catch(() => null);
+
+      if (!res.ok) {
+        const msg = json?.msg || "创建上传会话失败";
+        addToast({
+          title: msg,
+          color: "danger",
+          variant: "flat"
+        });
+        throw new Error(msg);
+      }
+
+      return json.data as UploadSessionResponse;
+    },
+    [],
+  );
+
+  // 分片全部上传后服务端在后台合并入库，轮询进度直到完成或失败
+  const waitForFinalize = useCallback(
+    async (uploadId: string, signal: AbortSignal) => {
+      for (;;) {
+        const res = await fetch(
+          `/api/upload/${encodeURIComponent(uploadId)}/status`,
+          { method: "GET", signal },
+        );
+        const json = await res.json().catch(() => null);
+
+        if (!res.ok) {
+          throw new Error(json?.msg || "查询上传进度失败");
+        }
+        const status = json.data as UploadStatusResponse;
+
+        if (status.state === "done") return status;
+        if (status.state === "failed") {
+          throw new Error(status.error || "上传失败");
+        }
+
+        await new Promise<void>((resolve, reject) => {
+          const timer = setTimeout(resolve, FINALIZE_POLL_INTERVAL);
+
+          signal.addEventListener(
+            "abort",
+            () => {
+              clearTimeout(timer);
+              reject(new DOMException("Aborted", "AbortError"));
+            },
+            { once: true },
+          );
+        });
+      }
+    },
+    [],
+  );
+
   // 大文件分片上传，按已完成分片比例更新进度
   const uploadChunked = useCallback(
     async (item: UploadItem, controller: AbortController) => {
-      const totalChunks = Math.ceil(item.file.size / CHUNK_SIZE);
+      const session = await createUploadSession(item, controller.signal);
+      const uploadId = session.uploadId;
+      const totalChunks = session.totalChunks;
+      const chunkSize = session.chunkSize;
+
+      updateItem(item.id, () => ({ uploadId }));
       let uploadedChunks = await fetchUploadedChunks(
-        item.uploadId,
+        uploadId,
         controller.signal,
       );
       let finished = uploadedChunks.size;
@@ -467,27 +556,40 @@ export default function UploadPanel({ }: UploadPanelProps = {}) {
           continue;
         }
 
-        const start = index * CHUNK_SIZE;
-        const end = Math.min(start + CHUNK_SIZE, item.file.size);
+        const start = index * chunkSize;
+        const end = Math.min(start + chunkSize, item.file.size);
         const chunk = item.file.slice(start, end);
+        const chunkHash = await sha256Hex(chunk);
 
-        const formData = new FormData();
+        let res: Response;
+        let json: any;
 
-        formData.append("file", chunk);
-        formData.append("uploadId", item.uploadId);
-        formData.append("filename", item.file.name);
-        formData.append("filesize", `${item.file.size}`);
-        formData.append("chunkIndex", `${index}`);
-        formData.append("totalChunks", `${totalChunks}`);
-        formData.append("chunkSize", `${CHUNK_SIZE}`);
-
-        const res = await fetch("/api/upload", {
-          method: "POST",
-          body: formData,
-          signal: controller.signal,
-        });
+        // 分片校验失败（422 且 retryable）时重新上传该分片
+        for (let attempt = 0; ; attempt++) {
+          const formData = new FormData();
+
+          formData.append("file", chunk);
+          formData.append("uploadId", uploadId);
+          formData.append("chunkIndex", `${index}`);
+          if (chunkHash) {
+            formData.append("chunkHash", chunkHash);
+          }
+
+          res = await fetch("/api/upload", {
+            method: "POST",
+            body: formData,
+            signal: controller.signal,
+          });
+          json = await res.json().catch(() => null);
+          if (
+            res.status !== 422 ||
+            !json?.data?.retryable ||
+            attempt >= CHUNK_RETRY_LIMIT
+          ) {
+            break;
+          }
+        }
 
-        const json = await res.json().catch(() => null);
         const data = (json?.data ?? {}) as
           | UploadChunkResponse
           | UploadCompletedResponse;
@@ -519,19 +621,36 @@ export default function UploadPanel({ }: UploadPanelProps = {}) {
           return;
         }
 
-        // 仅分片确认，继续下一片
-        if ("merged" in data && data.merged && finished >= totalChunks) {
-          // 分片层面已全部完成，但未拿到分享信息，后续由结尾逻辑兜底
+        // 最后一个分片返回 finalizing，转为轮询后台合并进度
+        if ("finalizing" in data && data.finalizing) {
           break;
         }
       }
 
+      let result: UploadStatusResponse;
+
+      try {
+        result = await waitForFinalize(uploadId, controller.signal);
+      } catch (err) {
+        if (err instanceof DOMException && err.name === "AbortError") {
+          throw err;
+        }
+        addToast({
+          title: (err as Error).message,
+          color: "danger",
+          variant: "flat"
+        });
+        throw err;
+      }
+
       updateItem(item.id, () => ({
         progress: 100,
         status: "success",
+        shareCode: result.shareCode,
+        resourceId: result.resourceId,
       }));
     },
-    [fetchUploadedChunks, updateItem],
+    [createUploadSession, fetchUploadedChunks, updateItem, waitForFinalize],
   );
 
   const startUpload = useCallback(
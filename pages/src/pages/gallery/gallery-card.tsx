@@ -48,7 +48,14 @@ export default function GalleryCard({
   const rawUrl = item.shareCode ? `/r/${item.shareCode}` : "";
   const shareUrl =
     item.shareCode && origin ? `${origin}/s/${item.shareCode}` : "";
-  const storageLabel = item.storage === "local" ? "本地" : "S3";
+  const storageLabel =
+    item.storage === "local"
+      ? "本地"
+      : item.storage === "webdav"
+        ? "WebDAV"
+        : item.storage === "sftp"
+          ? "SFTP"
+          : "S3";
 
   const cover = (() => {
     if (!rawUrl) {
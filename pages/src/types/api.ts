@@ -8,6 +8,16 @@ export type UploadFormRequest = {
   chunkSize: number | null;
 };
 
+export type UploadSessionResponse = {
+  uploadId: string;
+  filename: string;
+  fileSize: number;
+  chunkSize: number;
+  totalChunks: number;
+  expiresAt: string;
+  createdAt: string;
+};
+
 export type UploadChunkResponse = {
   merged: boolean;
   uploadId: string;
@@ -17,6 +27,28 @@ export type UploadChunkResponse = {
   chunkIndex?: number | null;
   totalChunks?: number | null;
   chunkSize?: number | null;
+  finalizing?: boolean;
+};
+
+export type UploadJobState =
+  | "pending"
+  | "queued"
+  | "merging"
+  | "hashing"
+  | "uploading"
+  | "done"
+  | "failed";
+
+export type UploadStatusResponse = {
+  uploadId: string;
+  filename: string;
+  state: UploadJobState;
+  progress: number;
+  uploaded: number;
+  totalChunks: number;
+  resourceId?: number;
+  shareCode?: string;
+  error?: string;
 };
 
 export type UploadCompletedResponse = {
@@ -31,7 +63,7 @@ export type GalleryItem = {
   id: number;
   filename: string;
   type: string;
-  storage: "local" | "s3";
+  storage: "local" | "s3" | "webdav" | "sftp";
   createdAt: string;
   shareCode: string | null;
   tags: string[];
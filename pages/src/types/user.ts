@@ -1,6 +1,14 @@
+export type UserQuota = {
+  quotaBytes: number;
+  quotaFiles: number;
+  usedBytes: number;
+  usedFiles: number;
+};
+
 export type UserProfile = {
   id: number;
   username: string;
   nickname: string;
   email: string;
+  quota?: UserQuota;
 };